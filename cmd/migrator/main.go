@@ -6,11 +6,13 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"time"
 
 	"example.com/go-migrator/internal/api"
-	"example.com/go-migrator/internal/model"
 	"example.com/go-migrator/internal/queue"
+	"example.com/go-migrator/internal/retention"
+	"example.com/go-migrator/internal/secrets"
 	"example.com/go-migrator/internal/store"
 	"example.com/go-migrator/internal/worker"
 	"github.com/joho/godotenv"
@@ -25,6 +27,12 @@ func main() {
 	}
 
 	get := func(key string) string { return os.Getenv(key) }
+	getOr := func(key, def string) string {
+		if v := get(key); v != "" {
+			return v
+		}
+		return def
+	}
 
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
 	defer stop()
@@ -35,10 +43,19 @@ func main() {
 		log.Fatal("MYSQL_DSN is required in .env")
 	}
 
-	db, _ := gorm.Open(mysql.Open(dsn), &gorm.Config{})
-	db.AutoMigrate(&model.Task{}, &model.Identity{}, &model.Project{}, &model.Connector{})
+	db, _ := gorm.Open(mysql.Open(dsn), &gorm.Config{TranslateError: true})
+	if err := store.AutoMigrate(db, store.DefaultTenantID()); err != nil {
+		log.Fatalf("failed to migrate schema: %v", err)
+	}
 
-	stm := store.NewStoreManager(db)
+	keys, err := secrets.NewKeyringFromEnv()
+	if err == secrets.ErrNoKeys {
+		log.Println("CONNECTOR_MASTER_KEYS not set; connectors cannot be created")
+	} else if err != nil {
+		log.Fatalf("failed to load connector keys: %v", err)
+	}
+
+	stm := store.NewStoreManager(db, keys)
 
 	// configure RabbitMQ
 	rabbitURL := get("RABBITMQ_URL")
@@ -54,7 +71,22 @@ func main() {
 	wk := worker.NewWorker(stm, qclient, 4)
 	wk.Start(ctx)
 
-	h := api.NewHandler(stm, qclient)
+	purgeInterval, err := time.ParseDuration(getOr("RETENTION_INTERVAL", "1h"))
+	if err != nil {
+		log.Fatalf("invalid RETENTION_INTERVAL: %v", err)
+	}
+	graceDays, err := strconv.Atoi(getOr("RETENTION_GRACE_DAYS", "7"))
+	if err != nil {
+		log.Fatalf("invalid RETENTION_GRACE_DAYS: %v", err)
+	}
+	retention.NewPurger(stm, purgeInterval, time.Duration(graceDays)*24*time.Hour).Start(ctx)
+
+	tenants, err := api.NewTokenResolverFromEnv()
+	if err != nil {
+		log.Fatalf("failed to load API tokens: %v", err)
+	}
+
+	h := api.NewHandler(stm, qclient, tenants)
 	srv := &http.Server{
 		Addr: ":" + func() string {
 			if p := get("PORT"); p != "" {
@@ -4,23 +4,81 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"os"
 
 	"example.com/go-migrator/internal/migrator"
+	teamdest "example.com/go-migrator/internal/migrator/dest/teams"
+	"example.com/go-migrator/internal/secrets"
+	"example.com/go-migrator/internal/store"
 	"github.com/joho/godotenv"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
 )
 
+// complete_migration finalizes a project: it ends migration mode on every
+// channel and team the project created, the same as
+// POST /projects/{id}/finalize. Rerun it to retry the teams that failed.
 func main() {
 	// load local .env for convenience
 	_ = godotenv.Load()
-	teamID := flag.String("teamId", "", "Teams team ID to complete migration for")
+	projectID := flag.String("projectId", "", "project to finalize")
+	tenantID := flag.String("tenantId", store.DefaultTenantID(), "tenant the project belongs to")
 	flag.Parse()
 
-	if *teamID == "" {
-		fmt.Println("Usage: go run cmd\\utils\\complete_migration\\main.go -teamId \"<team-id>\"")
-		log.Fatal("-teamId is required")
+	if *projectID == "" {
+		fmt.Println("Usage: go run cmd\\utils\\complete_migration\\main.go -projectId \"<project-id>\" [-tenantId \"<tenant-id>\"]")
+		log.Fatal("-projectId is required")
 	}
+	mysqlDSN := os.Getenv("MYSQL_DSN")
+	if mysqlDSN == "" {
+		log.Fatal("MYSQL_DSN not set in env")
+	}
+
+	db, err := gorm.Open(mysql.Open(mysqlDSN), &gorm.Config{TranslateError: true})
+	if err != nil {
+		log.Fatalf("failed to open database: %v", err)
+	}
+	// the schema belongs to the API server, which migrates it on start
+	keys, err := secrets.NewKeyringFromEnv()
+	if err != nil && err != secrets.ErrNoKeys {
+		log.Fatalf("failed to load connector keys: %v", err)
+	}
+	stm := store.NewStoreManager(db, keys).ForTenant(*tenantID)
 
-	if err := migrator.CompleteMigration(*teamID); err != nil {
+	project, err := stm.Project.GetByID(*projectID)
+	if err != nil {
+		log.Fatalf("load project: %v", err)
+	}
+	// the operator running the CLI may finalize any tenant's project with the
+	// TEAMS_* environment credentials
+	var dst *teamdest.Client
+	if project.TargetConnectorID == "" {
+		dst, err = teamdest.NewClientFromEnv()
+	} else {
+		dst, err = migrator.DestClient(stm, project.TargetConnectorID)
+	}
+	if err != nil {
+		log.Fatalf("teams client: %v", err)
+	}
+	// the same lock as the API's finalize run, so the two never overlap
+	lock, err := migrator.LockFinalize(stm, project)
+	if err != nil {
+		log.Fatalf("lock project: %v", err)
+	}
+	summary, err := migrator.FinalizeProject(dst, stm, project, lock)
+	if uerr := lock.Unlock(); uerr != nil {
+		log.Printf("unlock project: %v", uerr)
+	}
+	if summary != nil {
+		for _, t := range summary.Teams {
+			log.Printf("team %s (%s): %s %s", t.TeamName, t.TeamsTeamID, t.Status, t.Error)
+		}
+	}
+	if err != nil {
 		log.Fatalf("complete migration failed: %v", err)
 	}
+	if summary.Failed > 0 {
+		log.Fatalf("%d of %d teams failed; rerun to retry them", summary.Failed, len(summary.Teams))
+	}
+	log.Printf("project %s completed: %d teams", project.ID, summary.Completed)
 }
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"log"
+	"os"
+
+	"example.com/go-migrator/internal/secrets"
+	"example.com/go-migrator/internal/store"
+	"github.com/joho/godotenv"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+// rotate_connector_keys re-encrypts all connector secrets under the active
+// master key. Add the new key to CONNECTOR_MASTER_KEYS, point
+// CONNECTOR_ACTIVE_KEY_ID at it, run this tool, then retire the old key.
+func main() {
+	// load local .env for convenience
+	_ = godotenv.Load()
+
+	mysqlDSN := os.Getenv("MYSQL_DSN")
+	if mysqlDSN == "" {
+		log.Fatal("MYSQL_DSN not set in env")
+	}
+
+	keys, err := secrets.NewKeyringFromEnv()
+	if err != nil {
+		log.Fatalf("failed to load connector keys: %v", err)
+	}
+
+	db, err := gorm.Open(mysql.Open(mysqlDSN), &gorm.Config{TranslateError: true})
+	if err != nil {
+		log.Fatalf("failed to open database: %v", err)
+	}
+	if err := store.AutoMigrate(db, store.DefaultTenantID()); err != nil {
+		log.Fatalf("failed to migrate schema: %v", err)
+	}
+	stm := store.NewStoreManager(db, keys)
+
+	n, err := stm.Connector.RotateKeys()
+	if err != nil {
+		log.Fatalf("rotation failed after %d connectors: %v", n, err)
+	}
+	log.Printf("re-encrypted %d connectors under key %s", n, keys.ActiveKeyID())
+}
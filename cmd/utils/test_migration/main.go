@@ -6,7 +6,9 @@ import (
 	"os"
 
 	"example.com/go-migrator/internal/migrator"
+	migmodel "example.com/go-migrator/internal/migrator/model"
 	"example.com/go-migrator/internal/model"
+	"example.com/go-migrator/internal/secrets"
 	"example.com/go-migrator/internal/store"
 	"github.com/joho/godotenv"
 	"gorm.io/driver/mysql"
@@ -23,11 +25,18 @@ func main() {
 
 	teamName := flag.String("teamName", "", "Teams team Name to migrate to")
 	channelName := flag.String("channelName", "", "Teams channel Name to migrate to")
+	teamType := flag.String("teamType", string(migmodel.TeamPublic), "Teams team type: public or private")
+	channelType := flag.String("channelType", string(migmodel.ChannelStandard), "Teams channel type: standard, private or shared")
+	fallbackUserID := flag.String("fallbackUserId", "", "Teams user ID to post as for senders without an identity mapping")
+	attribute := flag.Bool("attribute", false, "keep the original Zoom sender in messages posted by the fallback user")
 	flag.Parse()
 
-	db, _ := gorm.Open(mysql.Open(mysqlDSN), &gorm.Config{})
-	db.AutoMigrate(&model.Task{}, &model.Identity{}, &model.Project{}, &model.Connector{})
-	stm := store.NewStoreManager(db)
+	db, _ := gorm.Open(mysql.Open(mysqlDSN), &gorm.Config{TranslateError: true})
+	if err := store.AutoMigrate(db, store.DefaultTenantID()); err != nil {
+		log.Fatalf("failed to migrate schema: %v", err)
+	}
+	keys, _ := secrets.NewKeyringFromEnv()
+	stm := store.NewStoreManager(db, keys).ForTenant(store.DefaultTenantID())
 
 	if zoomUserID == "" {
 		log.Fatal("ZOOM_TEST_USER_ID not set in env")
@@ -39,7 +48,29 @@ func main() {
 		log.Fatal("-channelName is required")
 	}
 
-	if err := migrator.MigrateTask(zoomUserID, zoomChannelID, *teamName, *channelName, stm); err != nil {
+	job := migrator.Job{
+		ZoomUserID:    zoomUserID,
+		ZoomChannelID: zoomChannelID,
+		TeamName:      *teamName,
+		ChannelName:   *channelName,
+		TeamType:      migmodel.TeamType(*teamType),
+		ChannelType:   migmodel.ChannelType(*channelType),
+	}
+	if *fallbackUserID != "" {
+		job.UnmappedPolicy = model.UnmappedFallback
+		if *attribute {
+			job.UnmappedPolicy = model.UnmappedFallbackAttributed
+		}
+		job.FallbackUserID = *fallbackUserID
+		job.FallbackDisplayName = "Zoom Migration"
+	}
+	report, err := migrator.MigrateTask(job, stm)
+	if report != nil {
+		for _, u := range report.UnmappedSenders {
+			log.Printf("unmapped sender %s <%s> (%s): %d messages", u.DisplayName, u.Email, u.ZoomUserID, u.Messages)
+		}
+	}
+	if err != nil {
 		log.Fatalf("migration failed: %v", err)
 	}
 	log.Println("migration finished")
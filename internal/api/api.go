@@ -1,28 +1,41 @@
 package api
 
 import (
+	"context"
 	"log"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
+	"example.com/go-migrator/internal/identity"
 	"example.com/go-migrator/internal/model"
 	"example.com/go-migrator/internal/queue"
 	"example.com/go-migrator/internal/store"
 )
 
 type Handler struct {
-	stm *store.StoreManager
-	q   queue.Client
-	mux *gin.Engine
+	stm     *store.StoreManager
+	q       queue.Client
+	tenants TenantResolver
+	mux     *gin.Engine
+	// validating holds the projects with an identity validation in flight,
+	// keyed by validationKey
+	validating sync.Map
+	// discovering holds the projects with a discovery run in flight
+	discovering sync.Map
 }
 
 // NewHandler creates an API handler. q may be nil; if provided, created task IDs
-// will be published to the queue.
-func NewHandler(s *store.StoreManager, q queue.Client) *Handler {
+// will be published to the queue. tenants resolves the calling tenant for every
+// request; all store access is scoped to it.
+func NewHandler(s *store.StoreManager, q queue.Client, tenants TenantResolver) *Handler {
 	r := gin.New()
 	r.Use(gin.Recovery())
-	h := &Handler{stm: s, q: q, mux: r}
+	h := &Handler{stm: s, q: q, tenants: tenants, mux: r}
+	r.Use(h.authenticate)
 	h.routes()
 	return h
 }
@@ -35,28 +48,164 @@ func (h *Handler) routes() {
 	h.mux.POST("/tasks", h.tasks)
 	h.mux.GET("/tasks", h.tasks)
 	h.mux.GET("/tasks/:id", h.taskByID)
+	h.mux.POST("/tasks/:id/retry", h.retryTask)
+	h.mux.GET("/tasks/:id/messages", h.taskMessages)
+	h.mux.GET("/tasks/:id/generations", h.taskGenerations)
 
 	// identities
 	h.mux.POST("/identities", h.identities)
 	h.mux.GET("/identities", h.identities)
+	h.mux.POST("/identities/import", h.importIdentities)
+	h.mux.POST("/identities/match", h.matchIdentities)
+	h.mux.GET("/identities/proposals", h.identityProposals)
+	h.mux.POST("/identities/proposals/accept", h.acceptProposals)
+	h.mux.POST("/identities/proposals/:id/accept", h.reviewProposal(true))
+	h.mux.POST("/identities/proposals/:id/reject", h.reviewProposal(false))
 	h.mux.GET("/identities/zoom/:id", h.identityByKey)
 	h.mux.GET("/identities/teams/:id", h.identityByKey)
+	h.mux.GET("/identities/:id", h.identityByID)
+	h.mux.PUT("/identities/:id", h.identityByID)
+	h.mux.PATCH("/identities/:id", h.identityByID)
+	h.mux.DELETE("/identities/:id", h.identityByID)
+	h.mux.GET("/identities/:id/aliases", h.identityAliases)
+	h.mux.POST("/identities/:id/aliases", h.identityAliases)
+	h.mux.DELETE("/identities/:id/aliases/:alias", h.deleteIdentityAlias)
+
+	// projects
+	h.mux.POST("/projects", h.projects)
+	h.mux.GET("/projects", h.projects)
+	h.mux.GET("/projects/:id", h.projectByID)
+	h.mux.PUT("/projects/:id", h.projectByID)
+	h.mux.DELETE("/projects/:id", h.projectByID)
+	h.mux.GET("/projects/:id/retention", h.projectRetention)
+	h.mux.PUT("/projects/:id/retention", h.projectRetention)
+	h.mux.GET("/projects/:id/unmapped-sender-policy", h.projectUnmappedSenderPolicy)
+	h.mux.PUT("/projects/:id/unmapped-sender-policy", h.projectUnmappedSenderPolicy)
+	h.mux.POST("/projects/:id/identities/validate", h.validateIdentities)
+	h.mux.GET("/projects/:id/identities/validation", h.identityValidation)
+	h.mux.GET("/projects/:id/state", h.projectState)
+	h.mux.POST("/projects/:id/state", h.projectState)
+	h.mux.GET("/projects/:id/progress", h.projectProgress)
+	h.mux.GET("/projects/:id/config", h.projectConfig)
+	h.mux.PUT("/projects/:id/config", h.projectConfig)
+	h.mux.POST("/projects/:id/config/plan", h.planProjectConfig)
+	h.mux.POST("/projects/:id/finalize", h.finalizeProject)
+	h.mux.GET("/projects/:id/finalization", h.projectFinalization)
+	h.mux.POST("/projects/:id/discover", h.discoverProject)
+	h.mux.GET("/projects/:id/inventory", h.projectInventory)
+	h.mux.GET("/projects/:id/plan", h.projectPlan)
+	h.mux.POST("/projects/:id/plan", h.replanProject)
+	h.mux.POST("/projects/:id/plan/execute", h.executePlan)
+	h.mux.GET("/projects/:id/mapping-rules", h.projectMappingRules)
+	h.mux.PUT("/projects/:id/mapping-rules", h.projectMappingRules)
+	h.mux.POST("/projects/:id/mapping-rules/preview", h.previewMapping)
+
+	// connectors
+	h.mux.POST("/connectors", h.connectors)
+	h.mux.GET("/connectors", h.connectors)
+	h.mux.GET("/connectors/:id", h.connectorByID)
+	h.mux.PUT("/connectors/:id", h.connectorByID)
+	h.mux.PATCH("/connectors/:id", h.connectorByID)
+	h.mux.DELETE("/connectors/:id", h.connectorByID)
+	h.mux.POST("/connectors/:id/test", h.testConnector)
 }
 
-// identities handles POST to create/update and GET to list or query identities.
+// identities handles POST to create or update (upsert on zoom_user_id within
+// project_id's scope) and GET to list identities. GET accepts ?q= to search emails, UPNs, IDs and display
+// names, and ?page= / ?page_size= for pagination.
 func (h *Handler) identities(c *gin.Context) {
-	is := h.stm.Identity
+	stm := h.store(c)
+	is := stm.Identity
 	if c.Request.Method == "POST" {
 		var in model.Identity
 		if err := c.BindJSON(&in); err != nil {
 			c.String(400, "invalid json")
 			return
 		}
-		if in.ZoomUserID == "" {
-			c.String(400, "zoom_user_id required")
+		if err := identity.Validate(&in); err != nil {
+			c.String(400, err.Error())
 			return
 		}
-		if err := is.Create(&in); err != nil {
+		if !h.checkIdentityProject(c, stm, in.ProjectID) {
+			return
+		}
+		created, err := is.Upsert(&in)
+		if err != nil {
+			log.Printf("identity store error: %v", err)
+			c.String(500, "internal")
+			return
+		}
+		if created {
+			c.JSON(201, in)
+			return
+		}
+		c.JSON(200, in)
+		return
+	}
+
+	page, pageSize := pagination(c)
+	list, total, err := is.List(strings.TrimSpace(c.Query("q")), (page-1)*pageSize, pageSize)
+	if err != nil {
+		log.Printf("identity store error: %v", err)
+		c.String(500, "internal")
+		return
+	}
+	c.JSON(200, gin.H{"items": list, "total": total, "page": page, "page_size": pageSize})
+}
+
+// identityPatch carries the fields a PATCH may change; nil fields are kept.
+type identityPatch struct {
+	ProjectID              *string `json:"project_id"`
+	ZoomUserID             *string `json:"zoom_user_id"`
+	ZoomUserEmail          *string `json:"zoom_user_email"`
+	ZoomUserDisplayName    *string `json:"zoom_user_display_name"`
+	TeamsUserID            *string `json:"teams_user_id"`
+	TeamsUserPrincipalName *string `json:"teams_user_principal_name"`
+	TeamsUserDisplayName   *string `json:"teams_user_display_name"`
+}
+
+func (p *identityPatch) apply(id *model.Identity) {
+	set := func(dst *string, src *string) {
+		if src != nil {
+			*dst = *src
+		}
+	}
+	set(&id.ProjectID, p.ProjectID)
+	set(&id.ZoomUserID, p.ZoomUserID)
+	set(&id.ZoomUserEmail, p.ZoomUserEmail)
+	set(&id.ZoomUserDisplayName, p.ZoomUserDisplayName)
+	set(&id.TeamsUserID, p.TeamsUserID)
+	set(&id.TeamsUserPrincipalName, p.TeamsUserPrincipalName)
+	set(&id.TeamsUserDisplayName, p.TeamsUserDisplayName)
+}
+
+// identityByID handles GET, PUT, PATCH and DELETE /identities/:id. PUT
+// replaces the whole mapping, PATCH changes only the fields sent.
+func (h *Handler) identityByID(c *gin.Context) {
+	stm := h.store(c)
+	is := stm.Identity
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.String(400, "invalid id")
+		return
+	}
+	existing, err := is.GetByID(uint(id))
+	if err != nil {
+		if err == store.ErrNotFound {
+			c.String(404, "not found")
+			return
+		}
+		log.Printf("identity store error: %v", err)
+		c.String(500, "internal")
+		return
+	}
+
+	switch c.Request.Method {
+	case "GET":
+		c.JSON(200, existing)
+		return
+	case "DELETE":
+		if err := is.Delete(existing.ID); err != nil && err != store.ErrNotFound {
 			log.Printf("identity store error: %v", err)
 			c.String(500, "internal")
 			return
@@ -64,13 +213,101 @@ func (h *Handler) identities(c *gin.Context) {
 		c.Status(204)
 		return
 	}
-	// GET not implemented
-	c.String(501, "not implemented")
+
+	updated := *existing
+	if c.Request.Method == "PUT" {
+		var in model.Identity
+		if err := c.BindJSON(&in); err != nil {
+			c.String(400, "invalid json")
+			return
+		}
+		updated.ProjectID = in.ProjectID
+		updated.ZoomUserID = in.ZoomUserID
+		updated.ZoomUserEmail = in.ZoomUserEmail
+		updated.ZoomUserDisplayName = in.ZoomUserDisplayName
+		updated.TeamsUserID = in.TeamsUserID
+		updated.TeamsUserPrincipalName = in.TeamsUserPrincipalName
+		updated.TeamsUserDisplayName = in.TeamsUserDisplayName
+	} else {
+		var in identityPatch
+		if err := c.BindJSON(&in); err != nil {
+			c.String(400, "invalid json")
+			return
+		}
+		in.apply(&updated)
+	}
+	if err := identity.Validate(&updated); err != nil {
+		c.String(400, err.Error())
+		return
+	}
+	if updated.ProjectID != existing.ProjectID && !h.checkIdentityProject(c, stm, updated.ProjectID) {
+		return
+	}
+	if updated.ZoomUserID != existing.ZoomUserID || updated.ProjectID != existing.ProjectID {
+		other, err := is.GetForProject(updated.ProjectID, updated.ZoomUserID)
+		if err == nil && other.ID != existing.ID {
+			c.String(409, "zoom_user_id already mapped in this scope by identity "+strconv.FormatUint(uint64(other.ID), 10))
+			return
+		}
+		if err != nil && err != store.ErrNotFound {
+			log.Printf("identity store error: %v", err)
+			c.String(500, "internal")
+			return
+		}
+	}
+	if err := is.Update(&updated); err != nil {
+		if err == store.ErrIdentityExists {
+			c.String(409, err.Error())
+			return
+		}
+		log.Printf("identity store error: %v", err)
+		c.String(500, "internal")
+		return
+	}
+	c.JSON(200, updated)
 }
 
-// identityByKey supports GET /identities/zoom/{zoomUserID} and /identities/teams/{teamsUserID}
+// checkIdentityProject verifies that a mapping's project exists, writing a 400
+// response if it does not. An empty projectID is the tenant-wide scope.
+func (h *Handler) checkIdentityProject(c *gin.Context, stm *store.StoreManager, projectID string) bool {
+	if projectID == "" {
+		return true
+	}
+	_, err := stm.Project.GetByID(projectID)
+	if err == store.ErrNotFound {
+		c.String(400, "unknown project_id")
+		return false
+	}
+	if err != nil {
+		log.Printf("project store error: %v", err)
+		c.String(500, "internal")
+		return false
+	}
+	return true
+}
+
+// pagination reads ?page= (1-based) and ?page_size= (default 50, max 500).
+func pagination(c *gin.Context) (page, pageSize int) {
+	page, _ = strconv.Atoi(c.Query("page"))
+	if page < 1 {
+		page = 1
+	}
+	pageSize, _ = strconv.Atoi(c.Query("page_size"))
+	if pageSize < 1 {
+		pageSize = 50
+	}
+	if pageSize > 500 {
+		pageSize = 500
+	}
+	return page, pageSize
+}
+
+// identityByKey supports GET /identities/zoom/{zoomUserID} and /identities/teams/{teamsUserID}.
+// Zoom lookups return the mapping a migration would use: aliases are followed
+// and ?project_id= selects a project's override over the tenant-wide mapping.
 func (h *Handler) identityByKey(c *gin.Context) {
-	is := h.stm.Identity
+	stm := h.store(c)
+	is := stm.Identity
 	// route contains either zoom/:id or teams/:id
 	typ := ""
 	if strings.HasPrefix(c.FullPath(), "/identities/zoom/") {
@@ -88,7 +325,10 @@ func (h *Handler) identityByKey(c *gin.Context) {
 		err error
 	)
 	if typ == "zoom" {
-		res, err = is.GetByZoomID(id)
+		if !h.checkIdentityProject(c, stm, c.Query("project_id")) {
+			return
+		}
+		res, err = is.Resolve(c.Query("project_id"), id)
 	} else if typ == "teams" {
 		res, err = is.GetByTeamsID(id)
 	} else {
@@ -108,18 +348,33 @@ func (h *Handler) identityByKey(c *gin.Context) {
 }
 
 func (h *Handler) tasks(c *gin.Context) {
-	ts := h.stm.Task
+	stm := h.store(c)
+	ts := stm.Task
 	if c.Request.Method == "POST" {
 		var in model.Task
 		if err := c.BindJSON(&in); err != nil {
 			c.String(400, "invalid json")
 			return
 		}
+		if !h.checkNewTask(c, stm, &in) {
+			return
+		}
 		if err := ts.Create(&in); err != nil {
+			if err == store.ErrActiveGeneration {
+				c.String(409, err.Error())
+				return
+			}
+			if err == store.ErrNoPreviousGeneration {
+				c.String(400, err.Error())
+				return
+			}
 			log.Printf("task store error: %v", err)
 			c.String(500, "internal")
 			return
 		}
+		if in.Status != model.StatusPlanned {
+			h.publish(c, in.ID)
+		}
 		c.Status(204)
 		return
 	}
@@ -135,7 +390,7 @@ func (h *Handler) tasks(c *gin.Context) {
 }
 
 func (h *Handler) taskByID(c *gin.Context) {
-	ts := h.stm.Task
+	ts := h.store(c).Task
 	id := c.Param("id")
 	if id == "" {
 		c.String(400, "missing id")
@@ -153,3 +408,94 @@ func (h *Handler) taskByID(c *gin.Context) {
 	}
 	c.JSON(200, t)
 }
+
+// retryTask re-queues a failed task. The message ledger makes the rerun skip
+// messages that were already imported.
+func (h *Handler) retryTask(c *gin.Context) {
+	stm := h.store(c)
+	ts := stm.Task
+	t, err := ts.GetByID(c.Param("id"))
+	if err != nil {
+		if err == store.ErrNotFound {
+			c.String(404, "not found")
+			return
+		}
+		log.Printf("store error: %v", err)
+		c.String(500, "internal")
+		return
+	}
+	if t.Status != model.StatusFailed {
+		c.String(409, "only failed tasks can be retried")
+		return
+	}
+	if !h.checkProjectRuns(c, stm, t.ProjectID) {
+		return
+	}
+	if err := ts.UpdateStatus(t.ID, string(model.StatusPending)); err != nil {
+		if err == store.ErrActiveGeneration {
+			c.String(409, err.Error())
+			return
+		}
+		log.Printf("task store error: %v", err)
+		c.String(500, "internal")
+		return
+	}
+	h.publish(c, t.ID)
+	c.Status(202)
+}
+
+// taskMessages lists the message ledger of a task.
+func (h *Handler) taskMessages(c *gin.Context) {
+	stm := h.store(c)
+	t, err := stm.Task.GetByID(c.Param("id"))
+	if err != nil {
+		if err == store.ErrNotFound {
+			c.String(404, "not found")
+			return
+		}
+		log.Printf("store error: %v", err)
+		c.String(500, "internal")
+		return
+	}
+	recs, err := stm.Message.ListByTask(t.ID)
+	if err != nil {
+		log.Printf("message store error: %v", err)
+		c.String(500, "internal")
+		return
+	}
+	c.JSON(200, recs)
+}
+
+// taskGenerations lists every generation of the task's source path, newest first.
+func (h *Handler) taskGenerations(c *gin.Context) {
+	ts := h.store(c).Task
+	t, err := ts.GetByID(c.Param("id"))
+	if err != nil {
+		if err == store.ErrNotFound {
+			c.String(404, "not found")
+			return
+		}
+		log.Printf("store error: %v", err)
+		c.String(500, "internal")
+		return
+	}
+	list, err := ts.ListGenerations(t.SourcePath)
+	if err != nil {
+		log.Printf("task store error: %v", err)
+		c.String(500, "internal")
+		return
+	}
+	c.JSON(200, list)
+}
+
+// publish queues a task for the workers if a queue is configured.
+func (h *Handler) publish(c *gin.Context, taskID string) {
+	if h.q == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+	if err := h.q.Publish(ctx, taskID); err != nil {
+		log.Printf("queue publish error for task %s: %v", taskID, err)
+	}
+}
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"example.com/go-migrator/internal/store"
+)
+
+// ErrUnauthenticated is returned by a TenantResolver when the request carries
+// no valid credentials.
+var ErrUnauthenticated = errors.New("unauthenticated")
+
+const callerKey = "caller"
+
+// Caller identifies the authenticated API client and the tenant it acts for.
+type Caller struct {
+	TenantID string
+	Subject  string
+}
+
+// TenantResolver resolves the calling tenant from an incoming request.
+type TenantResolver interface {
+	Resolve(r *http.Request) (*Caller, error)
+}
+
+type tokenResolver struct {
+	callers map[string]Caller
+}
+
+// NewTokenResolver returns a resolver that maps bearer tokens to callers.
+func NewTokenResolver(callers map[string]Caller) TenantResolver {
+	return &tokenResolver{callers: callers}
+}
+
+// NewTokenResolverFromEnv parses API_TOKENS, a comma separated list of
+// tenant:subject:token entries.
+func NewTokenResolverFromEnv() (TenantResolver, error) {
+	callers := make(map[string]Caller)
+	for _, entry := range strings.Split(os.Getenv("API_TOKENS"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, ":", 3)
+		if len(parts) != 3 || parts[0] == "" || parts[2] == "" {
+			return nil, fmt.Errorf("invalid API_TOKENS entry, want tenant:subject:token")
+		}
+		callers[parts[2]] = Caller{TenantID: parts[0], Subject: parts[1]}
+	}
+	if len(callers) == 0 {
+		return nil, fmt.Errorf("API_TOKENS is empty")
+	}
+	return NewTokenResolver(callers), nil
+}
+
+func (r *tokenResolver) Resolve(req *http.Request) (*Caller, error) {
+	auth := req.Header.Get("Authorization")
+	token, ok := strings.CutPrefix(auth, "Bearer ")
+	if !ok || token == "" {
+		return nil, ErrUnauthenticated
+	}
+	caller, ok := r.callers[token]
+	if !ok {
+		return nil, ErrUnauthenticated
+	}
+	return &caller, nil
+}
+
+// authenticate resolves the caller for every request and rejects requests
+// that cannot be tied to a tenant.
+func (h *Handler) authenticate(c *gin.Context) {
+	caller, err := h.tenants.Resolve(c.Request)
+	if err != nil || caller == nil || caller.TenantID == "" {
+		c.AbortWithStatus(401)
+		return
+	}
+	c.Set(callerKey, caller)
+	c.Next()
+}
+
+// caller returns the authenticated caller set by authenticate.
+func (h *Handler) caller(c *gin.Context) *Caller {
+	return c.MustGet(callerKey).(*Caller)
+}
+
+// store returns the stores scoped to the caller's tenant. Handlers must not
+// touch h.stm directly so that cross-tenant reads are impossible.
+func (h *Handler) store(c *gin.Context) *store.StoreManager {
+	return h.stm.ForTenant(h.caller(c).TenantID)
+}
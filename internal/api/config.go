@@ -0,0 +1,94 @@
+package api
+
+import (
+	"errors"
+	"log"
+
+	"github.com/gin-gonic/gin"
+
+	"example.com/go-migrator/internal/model"
+	"example.com/go-migrator/internal/projectconfig"
+	"example.com/go-migrator/internal/store"
+)
+
+// projectConfig handles GET and PUT /projects/:id/config. GET exports the
+// project's configuration as YAML; PUT applies a YAML document and returns
+// the changes it made.
+func (h *Handler) projectConfig(c *gin.Context) {
+	stm := h.store(c)
+	p, ok := h.loadProject(c, stm)
+	if !ok {
+		return
+	}
+	if c.Request.Method == "GET" {
+		doc, err := projectconfig.Export(stm, p)
+		if err == nil {
+			var out []byte
+			if out, err = projectconfig.Marshal(doc); err == nil {
+				c.Data(200, "application/yaml", out)
+				return
+			}
+		}
+		log.Printf("config export error: project %s: %v", p.ID, err)
+		c.String(500, "internal")
+		return
+	}
+
+	doc, ok := h.parseConfig(c, stm)
+	if !ok {
+		return
+	}
+	changes, err := projectconfig.Apply(stm, p, doc)
+	if errors.Is(err, projectconfig.ErrPlanLocked) {
+		c.String(409, err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("config apply error: project %s: %v", p.ID, err)
+		c.String(500, "internal")
+		return
+	}
+	c.JSON(200, gin.H{"changes": changes})
+}
+
+// planProjectConfig handles POST /projects/:id/config/plan. It returns the
+// changes applying the YAML document in the body would make, without
+// applying them.
+func (h *Handler) planProjectConfig(c *gin.Context) {
+	stm := h.store(c)
+	p, ok := h.loadProject(c, stm)
+	if !ok {
+		return
+	}
+	doc, ok := h.parseConfig(c, stm)
+	if !ok {
+		return
+	}
+	current, err := projectconfig.Export(stm, p)
+	if err != nil {
+		log.Printf("config export error: project %s: %v", p.ID, err)
+		c.String(500, "internal")
+		return
+	}
+	c.JSON(200, gin.H{"changes": projectconfig.Diff(current, doc)})
+}
+
+// parseConfig reads and validates the YAML document in the request body,
+// including its connector references, writing a 400 response if it is
+// invalid.
+func (h *Handler) parseConfig(c *gin.Context, stm *store.StoreManager) (*projectconfig.Document, bool) {
+	doc, err := projectconfig.Parse(c.Request.Body)
+	if err != nil {
+		c.String(400, err.Error())
+		return nil, false
+	}
+	refs := model.Project{
+		Name:              doc.Name,
+		SourceConnectorID: doc.Connectors.Source,
+		TargetConnectorID: doc.Connectors.Target,
+	}
+	if !h.checkProjectConnectors(c, stm, &refs) {
+		return nil, false
+	}
+	return doc, true
+}
@@ -0,0 +1,189 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+
+	"github.com/gin-gonic/gin"
+
+	"example.com/go-migrator/internal/migrator"
+	"example.com/go-migrator/internal/model"
+	"example.com/go-migrator/internal/store"
+)
+
+// connectorRequest is the body of connector writes. Data carries the
+// credentials as a JSON object; it is sealed on write and never returned.
+type connectorRequest struct {
+	UserID string              `json:"user_id"`
+	Type   model.ConnectorType `json:"type"`
+	Data   json.RawMessage     `json:"data"`
+}
+
+// connectorPatch is the body of connector updates; a nil UserID is kept. Data
+// replaces the credentials only when sent.
+type connectorPatch struct {
+	UserID *string             `json:"user_id"`
+	Type   model.ConnectorType `json:"type"`
+	Data   json.RawMessage     `json:"data"`
+}
+
+// data returns the credentials to store, or "" when none were sent, and a
+// validation message.
+func (r *connectorRequest) data() (data, msg string) {
+	return connectorData(r.Data)
+}
+
+func connectorData(raw json.RawMessage) (data, msg string) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return "", ""
+	}
+	var obj map[string]any
+	if err := json.Unmarshal(raw, &obj); err != nil {
+		return "", "data must be a JSON object"
+	}
+	return string(raw), ""
+}
+
+// connectors handles POST to create and GET to list connectors.
+func (h *Handler) connectors(c *gin.Context) {
+	cs := h.store(c).Connector
+	if c.Request.Method == "GET" {
+		list, err := cs.List()
+		if err != nil {
+			log.Printf("connector store error: %v", err)
+			c.String(500, "internal")
+			return
+		}
+		c.JSON(200, list)
+		return
+	}
+
+	var in connectorRequest
+	if err := c.BindJSON(&in); err != nil {
+		c.String(400, "invalid json")
+		return
+	}
+	if in.Type != model.Zoom && in.Type != model.Teams {
+		c.String(400, "type must be zoom or teams")
+		return
+	}
+	data, msg := in.data()
+	if msg == "" && data == "" {
+		msg = "data required"
+	}
+	if msg != "" {
+		c.String(400, msg)
+		return
+	}
+	conn := model.Connector{UserID: in.UserID, Type: in.Type, Data: data}
+	if err := migrator.CheckConnector(&conn); err != nil {
+		c.String(400, err.Error())
+		return
+	}
+	if err := cs.Create(&conn); err != nil {
+		if err == store.ErrNoKeyring {
+			c.String(503, err.Error())
+			return
+		}
+		log.Printf("connector store error: %v", err)
+		c.String(500, "internal")
+		return
+	}
+	c.JSON(201, conn)
+}
+
+// connectorByID handles GET, PUT, PATCH and DELETE /connectors/:id. PUT
+// replaces the connector and requires user_id, PATCH changes only the fields
+// sent. Both keep the stored credentials unless data is sent, since they are
+// never returned; the type cannot change. Connectors used by a project cannot
+// be deleted.
+func (h *Handler) connectorByID(c *gin.Context) {
+	stm := h.store(c)
+	conn, err := stm.Connector.GetByID(c.Param("id"))
+	if err != nil {
+		if err == store.ErrNotFound {
+			c.String(404, "not found")
+			return
+		}
+		log.Printf("connector store error: %v", err)
+		c.String(500, "internal")
+		return
+	}
+	switch c.Request.Method {
+	case "GET":
+		c.JSON(200, conn)
+	case "PUT", "PATCH":
+		var in connectorPatch
+		if err := c.BindJSON(&in); err != nil {
+			c.String(400, "invalid json")
+			return
+		}
+		if c.Request.Method == "PUT" && in.UserID == nil {
+			c.String(400, "user_id required; use PATCH to change only some fields")
+			return
+		}
+		if in.Type != "" && in.Type != conn.Type {
+			c.String(400, "type cannot be changed")
+			return
+		}
+		data, msg := connectorData(in.Data)
+		if msg != "" {
+			c.String(400, msg)
+			return
+		}
+		if in.UserID != nil {
+			conn.UserID = *in.UserID
+		}
+		conn.Data = data
+		if data != "" {
+			if err := migrator.CheckConnector(conn); err != nil {
+				c.String(400, err.Error())
+				return
+			}
+		}
+		if err := stm.Connector.Update(conn); err != nil {
+			if err == store.ErrNoKeyring {
+				c.String(503, err.Error())
+				return
+			}
+			log.Printf("connector store error: %v", err)
+			c.String(500, "internal")
+			return
+		}
+		c.JSON(200, conn)
+	case "DELETE":
+		projects, err := stm.Project.ListByConnector(conn.ID)
+		if err != nil {
+			log.Printf("project store error: %v", err)
+			c.String(500, "internal")
+			return
+		}
+		if len(projects) > 0 {
+			c.String(409, "connector is used by project "+projects[0].ID)
+			return
+		}
+		if err := stm.Connector.Delete(conn.ID); err != nil && err != store.ErrNotFound {
+			log.Printf("connector store error: %v", err)
+			c.String(500, "internal")
+			return
+		}
+		c.Status(204)
+	}
+}
+
+// testConnector handles POST /connectors/:id/test. It obtains a token with the
+// connector's credentials and reports which required permissions are missing.
+// The report is returned with 200 whether or not the connector passes.
+func (h *Handler) testConnector(c *gin.Context) {
+	conn, err := h.store(c).Connector.GetByID(c.Param("id"))
+	if err != nil {
+		if err == store.ErrNotFound {
+			c.String(404, "not found")
+			return
+		}
+		log.Printf("connector store error: %v", err)
+		c.String(500, "internal")
+		return
+	}
+	c.JSON(200, migrator.TestConnector(conn))
+}
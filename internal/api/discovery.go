@@ -0,0 +1,160 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"example.com/go-migrator/internal/discovery"
+	"example.com/go-migrator/internal/migrator"
+	"example.com/go-migrator/internal/model"
+	"example.com/go-migrator/internal/store"
+)
+
+// discoverProject handles POST /projects/:id/discover. It inventories the
+// project's Zoom account in the background and replaces the project's planned
+// tasks; poll GET /projects/:id/inventory for the result. Once migration has
+// started the plan is fixed and discovery is refused.
+func (h *Handler) discoverProject(c *gin.Context) {
+	stm := h.store(c)
+	p, ok := h.loadProject(c, stm)
+	if !ok {
+		return
+	}
+	if !p.State.CanTransition(model.ProjectDiscovered) {
+		c.String(409, fmt.Sprintf("project is %s; discovery is no longer possible", p.State))
+		return
+	}
+	src, err := migrator.SourceClient(stm, p.SourceConnectorID)
+	if err != nil {
+		log.Printf("zoom client error: %v", err)
+		c.String(502, "zoom client unavailable")
+		return
+	}
+	if _, running := h.discovering.LoadOrStore(p.ID, true); running {
+		c.String(409, "discovery already running")
+		return
+	}
+	go func() {
+		defer h.discovering.Delete(p.ID)
+		if _, err := discovery.Run(src, stm, p); err != nil {
+			log.Printf("discovery error: project %s: %v", p.ID, err)
+		}
+	}()
+	c.JSON(202, gin.H{"status": "started"})
+}
+
+// projectInventory handles GET /projects/:id/inventory.
+func (h *Handler) projectInventory(c *gin.Context) {
+	stm := h.store(c)
+	p, ok := h.loadProject(c, stm)
+	if !ok {
+		return
+	}
+	channels, err := stm.Inventory.ListChannels(p.ID)
+	if err != nil {
+		log.Printf("inventory store error: %v", err)
+		c.String(500, "internal")
+		return
+	}
+	_, running := h.discovering.Load(p.ID)
+	c.JSON(200, gin.H{
+		"running":         running,
+		"discovered_at":   p.DiscoveredAt,
+		"discovery_error": p.DiscoveryError,
+		"channels":        channels,
+	})
+}
+
+// projectPlan handles GET /projects/:id/plan, the tasks proposed by the last
+// discovery run that have not been queued yet.
+func (h *Handler) projectPlan(c *gin.Context) {
+	stm := h.store(c)
+	p, ok := h.loadProject(c, stm)
+	if !ok {
+		return
+	}
+	tasks, err := stm.Task.ListByProject(p.ID, string(model.StatusPlanned))
+	if err != nil {
+		log.Printf("task store error: %v", err)
+		c.String(500, "internal")
+		return
+	}
+	c.JSON(200, tasks)
+}
+
+// replanProject handles POST /projects/:id/plan. It rebuilds the plan from
+// the stored inventory, for instance after the mapping rules changed.
+func (h *Handler) replanProject(c *gin.Context) {
+	stm := h.store(c)
+	p, ok := h.loadProject(c, stm)
+	if !ok {
+		return
+	}
+	if !p.State.CanTransition(model.ProjectPlanned) {
+		c.String(409, fmt.Sprintf("project is %s and cannot be replanned", p.State))
+		return
+	}
+	if _, running := h.discovering.Load(p.ID); running {
+		c.String(409, "discovery running")
+		return
+	}
+	summary, err := discovery.Replan(stm, p)
+	if err != nil {
+		log.Printf("replan error: project %s: %v", p.ID, err)
+		c.String(500, "internal")
+		return
+	}
+	c.JSON(200, summary)
+}
+
+// executePlan handles POST /projects/:id/plan/execute. It queues every planned
+// task of the project. Tasks whose source path already has an active
+// generation stay planned and are reported as conflicts. The plan must have
+// been approved; executing it moves the project to migrating.
+func (h *Handler) executePlan(c *gin.Context) {
+	stm := h.store(c)
+	p, ok := h.loadProject(c, stm)
+	if !ok {
+		return
+	}
+	if !p.State.RunsTasks() {
+		c.String(409, fmt.Sprintf("project is %s; its plan must be approved first", p.State))
+		return
+	}
+	if _, running := h.discovering.Load(p.ID); running {
+		c.String(409, "discovery running")
+		return
+	}
+	if err := p.CheckSchedule(time.Now()); err != nil {
+		c.String(409, err.Error())
+		return
+	}
+	if p.State == model.ProjectApproved && !h.transitionProject(c, stm, p, model.ProjectMigrating) {
+		return
+	}
+	tasks, err := stm.Task.ListByProject(p.ID, string(model.StatusPlanned))
+	if err != nil {
+		log.Printf("task store error: %v", err)
+		c.String(500, "internal")
+		return
+	}
+	queued := 0
+	conflicts := []string{}
+	for _, t := range tasks {
+		if err := stm.Task.UpdateStatus(t.ID, string(model.StatusPending)); err != nil {
+			if err == store.ErrActiveGeneration {
+				conflicts = append(conflicts, t.ID)
+				continue
+			}
+			log.Printf("task store error: %v", err)
+			c.String(500, "internal")
+			return
+		}
+		h.publish(c, t.ID)
+		queued++
+	}
+	c.JSON(202, gin.H{"queued": queued, "conflicts": conflicts})
+}
@@ -0,0 +1,81 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"example.com/go-migrator/internal/migrator"
+	"example.com/go-migrator/internal/store"
+)
+
+// finalizeProject handles POST /projects/:id/finalize. It ends migration mode
+// on every team the project created in the background; poll
+// GET /projects/:id/finalization for the per-team outcome. Repeat it to retry
+// the teams that failed.
+func (h *Handler) finalizeProject(c *gin.Context) {
+	stm := h.store(c)
+	p, ok := h.loadProject(c, stm)
+	if !ok {
+		return
+	}
+	reason, err := migrator.FinalizeBlocker(stm, p)
+	if err != nil {
+		log.Printf("finalize check error: %v", err)
+		c.String(500, "internal")
+		return
+	}
+	if reason != "" {
+		c.String(409, reason)
+		return
+	}
+	dst, err := migrator.DestClient(stm, p.TargetConnectorID)
+	if err != nil {
+		log.Printf("teams client error: %v", err)
+		c.String(502, "teams client unavailable")
+		return
+	}
+	lock, err := migrator.LockFinalize(stm, p)
+	if errors.Is(err, store.ErrFinalizeLocked) {
+		c.String(409, "finalize already running")
+		return
+	}
+	if err != nil {
+		log.Printf("finalize lock error: %v", err)
+		c.String(500, "internal")
+		return
+	}
+	go func() {
+		defer func() {
+			if err := lock.Unlock(); err != nil {
+				log.Printf("finalize unlock error: project %s: %v", p.ID, err)
+			}
+		}()
+		if _, err := migrator.FinalizeProject(dst, stm, p, lock); err != nil {
+			log.Printf("finalize error: project %s: %v", p.ID, err)
+		}
+	}()
+	c.JSON(202, gin.H{"status": "started"})
+}
+
+// projectFinalization handles GET /projects/:id/finalization.
+func (h *Handler) projectFinalization(c *gin.Context) {
+	stm := h.store(c)
+	p, ok := h.loadProject(c, stm)
+	if !ok {
+		return
+	}
+	recs, err := stm.Finalization.List(p.ID)
+	if err != nil {
+		log.Printf("finalization store error: %v", err)
+		c.String(500, "internal")
+		return
+	}
+	c.JSON(200, gin.H{
+		"running": p.Finalizing(time.Now()),
+		"state":   p.State,
+		"teams":   recs,
+	})
+}
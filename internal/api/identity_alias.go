@@ -0,0 +1,125 @@
+package api
+
+import (
+	"log"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"example.com/go-migrator/internal/model"
+	"example.com/go-migrator/internal/store"
+)
+
+type aliasRequest struct {
+	ZoomUserID string `json:"zoom_user_id"`
+}
+
+// identityAliases handles GET and POST /identities/:id/aliases. An alias makes
+// another Zoom user ID resolve to this identity's Zoom user, in every project.
+func (h *Handler) identityAliases(c *gin.Context) {
+	is := h.store(c).Identity
+	ident, ok := h.loadIdentity(c, is)
+	if !ok {
+		return
+	}
+	if c.Request.Method == "GET" {
+		aliases, err := is.ListAliases(ident.ZoomUserID)
+		if err != nil {
+			log.Printf("identity store error: %v", err)
+			c.String(500, "internal")
+			return
+		}
+		c.JSON(200, aliases)
+		return
+	}
+
+	var in aliasRequest
+	if err := c.BindJSON(&in); err != nil {
+		c.String(400, "invalid json")
+		return
+	}
+	if in.ZoomUserID == "" {
+		c.String(400, "zoom_user_id required")
+		return
+	}
+	if in.ZoomUserID == ident.ZoomUserID {
+		c.String(400, "an identity cannot alias itself")
+		return
+	}
+	// aliases are followed one step only
+	if _, err := is.GetAlias(ident.ZoomUserID); err == nil {
+		c.String(400, "zoom_user_id "+ident.ZoomUserID+" is itself an alias")
+		return
+	} else if err != store.ErrNotFound {
+		log.Printf("identity store error: %v", err)
+		c.String(500, "internal")
+		return
+	}
+	if other, err := is.GetByZoomID(in.ZoomUserID); err == nil {
+		c.String(409, "zoom_user_id already mapped by identity "+strconv.FormatUint(uint64(other.ID), 10))
+		return
+	} else if err != store.ErrNotFound {
+		log.Printf("identity store error: %v", err)
+		c.String(500, "internal")
+		return
+	}
+
+	alias := model.IdentityAlias{AliasZoomUserID: in.ZoomUserID, ZoomUserID: ident.ZoomUserID}
+	if err := is.AddAlias(&alias); err != nil {
+		if err == store.ErrAliasExists {
+			c.String(409, err.Error())
+			return
+		}
+		log.Printf("identity store error: %v", err)
+		c.String(500, "internal")
+		return
+	}
+	c.JSON(201, alias)
+}
+
+// deleteIdentityAlias handles DELETE /identities/:id/aliases/:alias.
+func (h *Handler) deleteIdentityAlias(c *gin.Context) {
+	is := h.store(c).Identity
+	ident, ok := h.loadIdentity(c, is)
+	if !ok {
+		return
+	}
+	alias, err := is.GetAlias(c.Param("alias"))
+	if err == nil && alias.ZoomUserID != ident.ZoomUserID {
+		err = store.ErrNotFound
+	}
+	if err == nil {
+		err = is.DeleteAlias(alias.AliasZoomUserID)
+	}
+	if err != nil {
+		if err == store.ErrNotFound {
+			c.String(404, "not found")
+			return
+		}
+		log.Printf("identity store error: %v", err)
+		c.String(500, "internal")
+		return
+	}
+	c.Status(204)
+}
+
+// loadIdentity fetches the identity named by the :id parameter, writing the
+// error response and returning false if it cannot.
+func (h *Handler) loadIdentity(c *gin.Context, is store.IdentityStoreInterface) (*model.Identity, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.String(400, "invalid id")
+		return nil, false
+	}
+	ident, err := is.GetByID(uint(id))
+	if err != nil {
+		if err == store.ErrNotFound {
+			c.String(404, "not found")
+			return nil, false
+		}
+		log.Printf("identity store error: %v", err)
+		c.String(500, "internal")
+		return nil, false
+	}
+	return ident, true
+}
@@ -0,0 +1,60 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"example.com/go-migrator/internal/identity"
+)
+
+// maxImportBytes bounds the size of an identity import upload.
+const maxImportBytes = 32 << 20
+
+// importIdentities handles POST /identities/import. The body is CSV with a
+// header row or NDJSON, selected by ?format=csv|ndjson or the Content-Type.
+// ?dry_run=true reports what would change without writing.
+func (h *Handler) importIdentities(c *gin.Context) {
+	dryRun, _ := strconv.ParseBool(c.Query("dry_run"))
+
+	format := strings.ToLower(c.Query("format"))
+	if format == "" {
+		switch ct := c.ContentType(); {
+		case strings.Contains(ct, "csv"):
+			format = "csv"
+		case strings.Contains(ct, "ndjson"), strings.Contains(ct, "jsonl"), strings.Contains(ct, "json"):
+			format = "ndjson"
+		}
+	}
+
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, maxImportBytes)
+	var (
+		rows []identity.ImportRow
+		err  error
+	)
+	switch format {
+	case "csv":
+		rows, err = identity.ParseCSV(body)
+	case "ndjson":
+		rows, err = identity.ParseNDJSON(body)
+	default:
+		c.String(415, "unsupported format, use text/csv or application/x-ndjson")
+		return
+	}
+	if err != nil {
+		c.String(400, err.Error())
+		return
+	}
+
+	stm := h.store(c)
+	report, err := identity.Import(stm.Identity, stm.Project, rows, dryRun)
+	if err != nil {
+		log.Printf("identity import error: %v", err)
+		c.String(500, "internal")
+		return
+	}
+	c.JSON(200, report)
+}
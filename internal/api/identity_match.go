@@ -0,0 +1,171 @@
+package api
+
+import (
+	"log"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"example.com/go-migrator/internal/identity"
+	"example.com/go-migrator/internal/migrator"
+	"example.com/go-migrator/internal/model"
+	"example.com/go-migrator/internal/store"
+)
+
+// matchIdentities handles POST /identities/match. It pulls all Zoom and Entra
+// users and stores mapping proposals for review. ?project_id= reads the users
+// through that project's connectors instead of the environment credentials.
+func (h *Handler) matchIdentities(c *gin.Context) {
+	stm := h.store(c)
+	var sourceID, targetID string
+	if projectID := c.Query("project_id"); projectID != "" {
+		p, err := stm.Project.GetByID(projectID)
+		if err == store.ErrNotFound {
+			c.String(400, "unknown project_id")
+			return
+		}
+		if err != nil {
+			log.Printf("project store error: %v", err)
+			c.String(500, "internal")
+			return
+		}
+		sourceID, targetID = p.SourceConnectorID, p.TargetConnectorID
+	}
+	src, err := migrator.SourceClient(stm, sourceID)
+	if err != nil {
+		log.Printf("zoom client error: %v", err)
+		c.String(502, "zoom client unavailable")
+		return
+	}
+	dst, err := migrator.DestClient(stm, targetID)
+	if err != nil {
+		log.Printf("teams client error: %v", err)
+		c.String(502, "teams client unavailable")
+		return
+	}
+	summary, err := identity.RunMatching(src, dst, stm)
+	if err != nil {
+		log.Printf("identity matching error: %v", err)
+		c.String(500, "internal")
+		return
+	}
+	c.JSON(200, summary)
+}
+
+// identityProposals handles GET /identities/proposals?status=pending&min_score=0.9.
+func (h *Handler) identityProposals(c *gin.Context) {
+	minScore, _ := strconv.ParseFloat(c.Query("min_score"), 64)
+	list, err := h.store(c).Proposal.List(c.Query("status"), minScore)
+	if err != nil {
+		log.Printf("proposal store error: %v", err)
+		c.String(500, "internal")
+		return
+	}
+	c.JSON(200, list)
+}
+
+// reviewProposal handles POST /identities/proposals/:id/accept and /reject.
+func (h *Handler) reviewProposal(accept bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			c.String(400, "invalid id")
+			return
+		}
+		stm := h.store(c)
+		p, err := stm.Proposal.GetByID(uint(id))
+		if err != nil {
+			if err == store.ErrNotFound {
+				c.String(404, "not found")
+				return
+			}
+			log.Printf("proposal store error: %v", err)
+			c.String(500, "internal")
+			return
+		}
+		if p.Status != model.ProposalPending {
+			c.String(409, "proposal already "+string(p.Status))
+			return
+		}
+		if err := applyReview(stm, p, accept); err != nil {
+			log.Printf("proposal review error: %v", err)
+			c.String(500, "internal")
+			return
+		}
+		c.JSON(200, p)
+	}
+}
+
+type bulkAcceptRequest struct {
+	IDs      []uint   `json:"ids"`
+	MinScore *float64 `json:"min_score"`
+}
+
+// acceptProposals handles POST /identities/proposals/accept. It accepts the
+// listed pending proposals, or all pending proposals scoring at least
+// min_score.
+func (h *Handler) acceptProposals(c *gin.Context) {
+	var in bulkAcceptRequest
+	if err := c.BindJSON(&in); err != nil {
+		c.String(400, "invalid json")
+		return
+	}
+	if len(in.IDs) == 0 && in.MinScore == nil {
+		c.String(400, "ids or min_score required")
+		return
+	}
+	stm := h.store(c)
+	var pending []model.IdentityProposal
+	if len(in.IDs) > 0 {
+		for _, id := range in.IDs {
+			p, err := stm.Proposal.GetByID(id)
+			if err == store.ErrNotFound {
+				continue
+			}
+			if err != nil {
+				log.Printf("proposal store error: %v", err)
+				c.String(500, "internal")
+				return
+			}
+			if p.Status == model.ProposalPending {
+				pending = append(pending, *p)
+			}
+		}
+	} else {
+		var err error
+		pending, err = stm.Proposal.List(string(model.ProposalPending), *in.MinScore)
+		if err != nil {
+			log.Printf("proposal store error: %v", err)
+			c.String(500, "internal")
+			return
+		}
+	}
+	accepted := 0
+	for i := range pending {
+		if err := applyReview(stm, &pending[i], true); err != nil {
+			log.Printf("proposal review error: %v", err)
+			c.String(500, "internal")
+			return
+		}
+		accepted++
+	}
+	c.JSON(200, gin.H{"accepted": accepted})
+}
+
+// applyReview commits an accepted proposal to the identity store and records
+// the review decision.
+func applyReview(stm *store.StoreManager, p *model.IdentityProposal, accept bool) error {
+	status := model.ProposalRejected
+	if accept {
+		ident := p.Identity()
+		if _, err := stm.Identity.Upsert(&ident); err != nil {
+			return err
+		}
+		status = model.ProposalAccepted
+	}
+	if err := stm.Proposal.UpdateStatus(p.ID, status); err != nil {
+		return err
+	}
+	p.Status = status
+	return nil
+}
@@ -0,0 +1,108 @@
+package api
+
+import (
+	"log"
+
+	"github.com/gin-gonic/gin"
+
+	"example.com/go-migrator/internal/identity"
+	"example.com/go-migrator/internal/migrator"
+	"example.com/go-migrator/internal/model"
+	"example.com/go-migrator/internal/store"
+)
+
+// validationConcurrency bounds parallel Graph lookups of a validation run.
+const validationConcurrency = 8
+
+// invalidIdentityLimit caps how many broken mappings the status endpoint lists.
+const invalidIdentityLimit = 500
+
+// validateIdentities handles POST /projects/:id/identities/validate. It checks
+// the project's identity mappings, including tenant-wide ones, against its
+// destination tenant in the background and returns 202; poll
+// GET /projects/:id/identities/validation for the result.
+func (h *Handler) validateIdentities(c *gin.Context) {
+	stm := h.store(c)
+	p, ok := h.loadProject(c, stm)
+	if !ok {
+		return
+	}
+	dst, err := migrator.DestClient(stm, p.TargetConnectorID)
+	if err != nil {
+		log.Printf("teams client error: %v", err)
+		c.String(502, "teams client unavailable")
+		return
+	}
+	// results are kept per project, so one run at a time per project
+	key := validationKey(stm, p.ID)
+	if _, running := h.validating.LoadOrStore(key, true); running {
+		c.String(409, "validation already running")
+		return
+	}
+	go func() {
+		defer h.validating.Delete(key)
+		if _, err := identity.ValidateMappings(dst, stm.Identity, p.ID, validationConcurrency); err != nil {
+			log.Printf("identity validation error: %v", err)
+		}
+	}()
+	c.JSON(202, gin.H{"status": "started"})
+}
+
+// validationKey names a project's validation run in Handler.validating.
+func validationKey(stm *store.StoreManager, projectID string) string {
+	return stm.TenantID() + "/" + projectID
+}
+
+type validationStatus struct {
+	Running  bool             `json:"running"`
+	Counts   map[string]int64 `json:"counts"`
+	Invalid  []model.Identity `json:"invalid"`
+	Runnable bool             `json:"runnable"`
+}
+
+// identityValidation handles GET /projects/:id/identities/validation. It
+// reports how many of the project's mappings, including tenant-wide ones, are
+// in each validation state and lists the broken or not yet validated ones;
+// the project's tasks only run once none are left.
+func (h *Handler) identityValidation(c *gin.Context) {
+	stm := h.store(c)
+	p, ok := h.loadProject(c, stm)
+	if !ok {
+		return
+	}
+	counts, err := stm.Identity.CountByValidationStatus(p.ID)
+	if err != nil {
+		log.Printf("identity store error: %v", err)
+		c.String(500, "internal")
+		return
+	}
+	invalid, err := stm.Identity.ListInvalid(p.ID, invalidIdentityLimit)
+	if err != nil {
+		log.Printf("identity store error: %v", err)
+		c.String(500, "internal")
+		return
+	}
+	_, running := h.validating.Load(validationKey(stm, p.ID))
+	c.JSON(200, validationStatus{
+		Running:  running,
+		Counts:   counts,
+		Invalid:  invalid,
+		Runnable: len(invalid) == 0,
+	})
+}
+
+// loadProject fetches the project named by the :id parameter, writing the
+// error response and returning false if it cannot.
+func (h *Handler) loadProject(c *gin.Context, stm *store.StoreManager) (*model.Project, bool) {
+	p, err := stm.Project.GetByID(c.Param("id"))
+	if err != nil {
+		if err == store.ErrNotFound {
+			c.String(404, "not found")
+			return nil, false
+		}
+		log.Printf("project store error: %v", err)
+		c.String(500, "internal")
+		return nil, false
+	}
+	return p, true
+}
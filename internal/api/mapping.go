@@ -0,0 +1,81 @@
+package api
+
+import (
+	"log"
+
+	"github.com/gin-gonic/gin"
+
+	"example.com/go-migrator/internal/mapping"
+	"example.com/go-migrator/internal/model"
+)
+
+type mappingRules struct {
+	Rules []model.MappingRule `json:"rules"`
+}
+
+// projectMappingRules handles GET and PUT /projects/:id/mapping-rules. The
+// rules apply to plans made by later discovery runs, and cannot change once
+// the plan is approved.
+func (h *Handler) projectMappingRules(c *gin.Context) {
+	stm := h.store(c)
+	p, ok := h.loadProject(c, stm)
+	if !ok {
+		return
+	}
+	if c.Request.Method == "PUT" {
+		var in mappingRules
+		if err := c.BindJSON(&in); err != nil {
+			c.String(400, "invalid json")
+			return
+		}
+		if _, err := mapping.Compile(in.Rules); err != nil {
+			c.String(400, err.Error())
+			return
+		}
+		if !h.checkPlanEditable(c, p) {
+			return
+		}
+		if err := stm.Project.UpdateMappingRules(p.ID, in.Rules); err != nil {
+			log.Printf("project store error: %v", err)
+			c.String(500, "internal")
+			return
+		}
+		c.JSON(200, in)
+		return
+	}
+	c.JSON(200, mappingRules{Rules: p.MappingRules})
+}
+
+// previewMapping handles POST /projects/:id/mapping-rules/preview. It maps the
+// project's discovered channels with the rules in the body, or with the saved
+// rules when the body has none, without changing anything.
+func (h *Handler) previewMapping(c *gin.Context) {
+	stm := h.store(c)
+	p, ok := h.loadProject(c, stm)
+	if !ok {
+		return
+	}
+	var in mappingRules
+	if c.Request.ContentLength != 0 {
+		if err := c.BindJSON(&in); err != nil {
+			c.String(400, "invalid json")
+			return
+		}
+	}
+	rules := in.Rules
+	if rules == nil {
+		rules = p.MappingRules
+	}
+	mapper, err := mapping.Compile(rules)
+	if err != nil {
+		c.String(400, err.Error())
+		return
+	}
+	channels, err := stm.Inventory.ListChannels(p.ID)
+	if err != nil {
+		log.Printf("inventory store error: %v", err)
+		c.String(500, "internal")
+		return
+	}
+	c.JSON(200, mapper.Preview(channels))
+}
@@ -0,0 +1,69 @@
+package api
+
+import (
+	"log"
+
+	"github.com/gin-gonic/gin"
+
+	"example.com/go-migrator/internal/model"
+	"example.com/go-migrator/internal/store"
+)
+
+type unmappedSenderSettings struct {
+	Policy                       model.UnmappedSenderPolicy `json:"unmapped_sender_policy"`
+	FallbackTeamsUserID          string                     `json:"fallback_teams_user_id"`
+	FallbackTeamsUserDisplayName string                     `json:"fallback_teams_user_display_name"`
+}
+
+// validate checks that fallback policies name a fallback account.
+func (s *unmappedSenderSettings) validate() string {
+	if !s.Policy.Valid() {
+		return "unmapped_sender_policy must be fail, fallback or fallback_attributed"
+	}
+	if s.Policy != model.UnmappedFail && s.FallbackTeamsUserID == "" {
+		return "fallback_teams_user_id required for fallback policies"
+	}
+	return ""
+}
+
+// projectUnmappedSenderPolicy handles GET and PUT /projects/:id/unmapped-sender-policy.
+// The policy cannot change once the plan is approved.
+func (h *Handler) projectUnmappedSenderPolicy(c *gin.Context) {
+	ps := h.store(c).Project
+	p, err := ps.GetByID(c.Param("id"))
+	if err != nil {
+		if err == store.ErrNotFound {
+			c.String(404, "not found")
+			return
+		}
+		log.Printf("project store error: %v", err)
+		c.String(500, "internal")
+		return
+	}
+	if c.Request.Method == "PUT" {
+		var in unmappedSenderSettings
+		if err := c.BindJSON(&in); err != nil {
+			c.String(400, "invalid json")
+			return
+		}
+		if msg := in.validate(); msg != "" {
+			c.String(400, msg)
+			return
+		}
+		if !h.checkPlanEditable(c, p) {
+			return
+		}
+		if err := ps.UpdateUnmappedSenderPolicy(p.ID, in.Policy, in.FallbackTeamsUserID, in.FallbackTeamsUserDisplayName); err != nil {
+			log.Printf("project store error: %v", err)
+			c.String(500, "internal")
+			return
+		}
+		c.JSON(200, in)
+		return
+	}
+	c.JSON(200, unmappedSenderSettings{
+		Policy:                       p.UnmappedSenderPolicy,
+		FallbackTeamsUserID:          p.FallbackTeamsUserID,
+		FallbackTeamsUserDisplayName: p.FallbackTeamsUserDisplayName,
+	})
+}
@@ -0,0 +1,51 @@
+package api
+
+import (
+	"log"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"example.com/go-migrator/internal/progress"
+)
+
+// defaultProgressWindow is the throughput window when ?window= is not given.
+const defaultProgressWindow = 15 * time.Minute
+
+// projectProgress handles GET /projects/:id/progress. ?window= sets the
+// sliding window the import rate is measured over, e.g. "1h".
+func (h *Handler) projectProgress(c *gin.Context) {
+	stm := h.store(c)
+	p, ok := h.loadProject(c, stm)
+	if !ok {
+		return
+	}
+	window := defaultProgressWindow
+	if w := c.Query("window"); w != "" {
+		d, err := time.ParseDuration(w)
+		if err != nil || d <= 0 {
+			c.String(400, "invalid window")
+			return
+		}
+		window = d
+	}
+
+	tasks, err := stm.Task.ListByProject(p.ID, "")
+	if err != nil {
+		log.Printf("task store error: %v", err)
+		c.String(500, "internal")
+		return
+	}
+	now := time.Now()
+	var ledger progress.Ledger
+	ledger.Messages, ledger.Files, err = stm.Message.CountImported(p.ID, time.Time{})
+	if err == nil {
+		ledger.Recent, _, err = stm.Message.CountImported(p.ID, now.Add(-window))
+	}
+	if err != nil {
+		log.Printf("message store error: %v", err)
+		c.String(500, "internal")
+		return
+	}
+	c.JSON(200, progress.Compute(p, tasks, ledger, window, now))
+}
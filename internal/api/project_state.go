@@ -0,0 +1,197 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"example.com/go-migrator/internal/model"
+	"example.com/go-migrator/internal/store"
+)
+
+// projectState handles GET and POST /projects/:id/state. POST moves the
+// project to {"state": ...} if its current state allows it; approving
+// records the caller and the time.
+func (h *Handler) projectState(c *gin.Context) {
+	stm := h.store(c)
+	p, ok := h.loadProject(c, stm)
+	if !ok {
+		return
+	}
+	if c.Request.Method == "POST" {
+		var in struct {
+			State model.ProjectState `json:"state"`
+		}
+		if err := c.BindJSON(&in); err != nil {
+			c.String(400, "invalid json")
+			return
+		}
+		if in.State == model.ProjectApproved {
+			if _, running := h.discovering.Load(p.ID); running {
+				c.String(409, "discovery running")
+				return
+			}
+		}
+		if !h.transitionProject(c, stm, p, in.State) {
+			return
+		}
+	}
+	c.JSON(200, gin.H{
+		"state":       p.State,
+		"approved_by": p.ApprovedBy,
+		"approved_at": p.ApprovedAt,
+	})
+}
+
+// transitionProject moves p to the given state, writing a 409 response if
+// its current state does not allow it or it changed concurrently.
+func (h *Handler) transitionProject(c *gin.Context, stm *store.StoreManager, p *model.Project, to model.ProjectState) bool {
+	if !p.State.CanTransition(to) {
+		c.String(409, fmt.Sprintf("project is %s and cannot become %s", p.State, to))
+		return false
+	}
+	now := time.Now()
+	by := ""
+	if to == model.ProjectApproved {
+		by = h.caller(c).Subject
+	}
+	if err := stm.Project.SetState(p.ID, p.State, to, by, now); err != nil {
+		if err == store.ErrStateChanged {
+			c.String(409, err.Error())
+			return false
+		}
+		log.Printf("project store error: %v", err)
+		c.String(500, "internal")
+		return false
+	}
+	p.State = to
+	switch to {
+	case model.ProjectApproved:
+		p.ApprovedBy, p.ApprovedAt = by, &now
+	case model.ProjectDraft, model.ProjectDiscovered, model.ProjectPlanned:
+		p.ApprovedBy, p.ApprovedAt = "", nil
+	}
+	return true
+}
+
+// checkProjectRuns verifies that tasks of the project may run, writing a 409
+// response if the project's plan has not been approved. Tasks without a
+// project never run.
+func (h *Handler) checkProjectRuns(c *gin.Context, stm *store.StoreManager, projectID string) bool {
+	_, ok := h.runningProject(c, stm, projectID)
+	return ok
+}
+
+func (h *Handler) runningProject(c *gin.Context, stm *store.StoreManager, projectID string) (*model.Project, bool) {
+	if projectID == "" {
+		c.String(409, "tasks without a project cannot run")
+		return nil, false
+	}
+	p, ok := h.taskProject(c, stm, projectID)
+	if !ok {
+		return nil, false
+	}
+	if !p.State.RunsTasks() {
+		c.String(409, fmt.Sprintf("project is %s; its plan must be approved before tasks run", p.State))
+		return nil, false
+	}
+	if err := p.CheckSchedule(time.Now()); err != nil {
+		c.String(409, err.Error())
+		return nil, false
+	}
+	return p, true
+}
+
+// taskProject loads the project a task refers to, writing a 400 response if
+// it does not exist.
+func (h *Handler) taskProject(c *gin.Context, stm *store.StoreManager, projectID string) (*model.Project, bool) {
+	p, err := stm.Project.GetByID(projectID)
+	if err != nil {
+		if err == store.ErrNotFound {
+			c.String(400, "unknown project_id")
+			return nil, false
+		}
+		log.Printf("project store error: %v", err)
+		c.String(500, "internal")
+		return nil, false
+	}
+	return p, true
+}
+
+// checkPlanEditable writes a 409 response if the project's plan, and the
+// settings it was approved with, can no longer change.
+func (h *Handler) checkPlanEditable(c *gin.Context, p *model.Project) bool {
+	if !p.State.PlanEditable() {
+		c.String(409, fmt.Sprintf("project is %s; its plan can no longer change", p.State))
+		return false
+	}
+	return true
+}
+
+// checkNewTask verifies that a task may be added to its project, writing the
+// error response if not. Planned tasks change the plan, which is fixed once
+// approved. Queued tasks need an approved plan and may only add a generation
+// of a source path the plan already has; they take its target from the
+// latest generation, and a different target is refused.
+func (h *Handler) checkNewTask(c *gin.Context, stm *store.StoreManager, t *model.Task) bool {
+	if t.ProjectID == "" {
+		c.String(400, "project_id is required")
+		return false
+	}
+	if t.Status == model.StatusPlanned {
+		p, ok := h.taskProject(c, stm, t.ProjectID)
+		if !ok {
+			return false
+		}
+		return h.checkPlanEditable(c, p)
+	}
+	p, ok := h.runningProject(c, stm, t.ProjectID)
+	if !ok {
+		return false
+	}
+	gens, err := stm.Task.ListGenerations(t.SourcePath)
+	if err != nil {
+		log.Printf("task store error: %v", err)
+		c.String(500, "internal")
+		return false
+	}
+	// generations are newest first
+	for i := range gens {
+		if gens[i].ProjectID == p.ID {
+			if field := copyTarget(t, &gens[i]); field != "" {
+				c.String(409, fmt.Sprintf("%s of %s differs from the approved plan", field, t.SourcePath))
+				return false
+			}
+			return true
+		}
+	}
+	c.String(409, fmt.Sprintf("project is %s; %s is not in its approved plan", p.State, t.SourcePath))
+	return false
+}
+
+// copyTarget sets t's target to the one of gen, the generation of its source
+// path in the approved plan. It returns the JSON name of the first field t
+// sets to something else, leaving t unchanged.
+func copyTarget(t, gen *model.Task) string {
+	fields := []struct {
+		name     string
+		dst, src *string
+	}{
+		{"target_path", &t.TargetPath, &gen.TargetPath},
+		{"team_type", &t.TeamType, &gen.TeamType},
+		{"channel_type", &t.ChannelType, &gen.ChannelType},
+		{"teams_team_id", &t.TeamsTeamID, &gen.TeamsTeamID},
+		{"teams_channel_id", &t.TeamsChannelID, &gen.TeamsChannelID},
+	}
+	for _, f := range fields {
+		if *f.dst != "" && *f.dst != *f.src {
+			return f.name
+		}
+	}
+	for _, f := range fields[:3] {
+		*f.dst = *f.src
+	}
+	return ""
+}
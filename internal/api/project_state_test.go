@@ -0,0 +1,112 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"example.com/go-migrator/internal/model"
+	"example.com/go-migrator/internal/store"
+)
+
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{TranslateError: true, Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	if err := store.AutoMigrate(db, "default"); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// newTestHandler returns a handler over an in-memory database whose token
+// "tok" acts for tenant "a", and the stores of that tenant.
+func newTestHandler(t *testing.T) (*Handler, *store.StoreManager) {
+	stm := store.NewStoreManager(newTestDB(t), nil)
+	h := NewHandler(stm, nil, NewTokenResolver(map[string]Caller{"tok": {TenantID: "a", Subject: "alice"}}))
+	return h, stm.ForTenant("a")
+}
+
+func serve(h *Handler, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer tok")
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	h.Router().ServeHTTP(rec, req)
+	return rec
+}
+
+func TestTasks_NewGenerationKeepsTheApprovedTarget(t *testing.T) {
+	h, stm := newTestHandler(t)
+	p := &model.Project{Name: "p", State: model.ProjectMigrating}
+	if err := stm.Project.Create(p); err != nil {
+		t.Fatal(err)
+	}
+	src := "users/u1/channels/c1"
+	first := &model.Task{ProjectID: p.ID, SourcePath: src, TargetPath: "Sales/general", TeamType: "private", Status: model.StatusSuccess}
+	if err := stm.Task.Create(first); err != nil {
+		t.Fatal(err)
+	}
+
+	body := `{"project_id":"` + p.ID + `","source_path":"` + src + `","status":"pending","target_path":"Other/general"}`
+	if rec := serve(h, "POST", "/tasks", body); rec.Code != http.StatusConflict {
+		t.Fatalf("expected 409 for a different target, got %d %s", rec.Code, rec.Body)
+	}
+	body = `{"project_id":"` + p.ID + `","source_path":"` + src + `","status":"pending","team_type":"public"}`
+	if rec := serve(h, "POST", "/tasks", body); rec.Code != http.StatusConflict {
+		t.Fatalf("expected 409 for a different team type, got %d %s", rec.Code, rec.Body)
+	}
+
+	body = `{"project_id":"` + p.ID + `","source_path":"` + src + `","status":"pending"}`
+	if rec := serve(h, "POST", "/tasks", body); rec.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d %s", rec.Code, rec.Body)
+	}
+	gens, err := stm.Task.ListGenerations(src)
+	if err != nil || len(gens) != 2 {
+		t.Fatalf("expected two generations, got %d, %v", len(gens), err)
+	}
+	if got := gens[0]; got.TargetPath != "Sales/general" || got.TeamType != "private" {
+		t.Fatalf("expected the approved target copied, got %q %q", got.TargetPath, got.TeamType)
+	}
+}
+
+func TestProjectSettings_LockedOnceApproved(t *testing.T) {
+	h, stm := newTestHandler(t)
+	p := &model.Project{Name: "p", State: model.ProjectPlanned}
+	if err := stm.Project.Create(p); err != nil {
+		t.Fatal(err)
+	}
+	writes := []struct{ path, body string }{
+		{"/projects/" + p.ID, `{"name":"renamed"}`},
+		{"/projects/" + p.ID + "/mapping-rules", `{"rules":[]}`},
+		{"/projects/" + p.ID + "/unmapped-sender-policy", `{"unmapped_sender_policy":"fail"}`},
+	}
+	// the project's own PUT needs connectors, which need a keyring
+	for _, w := range writes[1:] {
+		if rec := serve(h, "PUT", w.path, w.body); rec.Code != http.StatusOK {
+			t.Fatalf("PUT %s while planned: expected 200, got %d %s", w.path, rec.Code, rec.Body)
+		}
+	}
+
+	if err := stm.Project.SetState(p.ID, model.ProjectPlanned, model.ProjectApproved, "alice", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	for _, w := range writes {
+		if rec := serve(h, "PUT", w.path, w.body); rec.Code != http.StatusConflict {
+			t.Fatalf("PUT %s while approved: expected 409, got %d %s", w.path, rec.Code, rec.Body)
+		}
+	}
+}
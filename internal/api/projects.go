@@ -0,0 +1,165 @@
+package api
+
+import (
+	"log"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"example.com/go-migrator/internal/model"
+	"example.com/go-migrator/internal/store"
+)
+
+type projectRequest struct {
+	Name              string `json:"name"`
+	SourceConnectorID string `json:"source_connector_id"`
+	TargetConnectorID string `json:"target_connector_id"`
+	// the remaining settings are only read on create; they have their own
+	// endpoints afterwards
+	RetentionDays int `json:"retention_days"`
+	unmappedSenderSettings
+}
+
+// projects handles POST to create and GET to list projects.
+func (h *Handler) projects(c *gin.Context) {
+	stm := h.store(c)
+	if c.Request.Method == "GET" {
+		list, err := stm.Project.List()
+		if err != nil {
+			log.Printf("project store error: %v", err)
+			c.String(500, "internal")
+			return
+		}
+		c.JSON(200, list)
+		return
+	}
+
+	var in projectRequest
+	if err := c.BindJSON(&in); err != nil {
+		c.String(400, "invalid json")
+		return
+	}
+	if in.Policy == "" {
+		in.Policy = model.UnmappedFail
+	}
+	if msg := in.unmappedSenderSettings.validate(); msg != "" {
+		c.String(400, msg)
+		return
+	}
+	if in.RetentionDays < 0 {
+		c.String(400, "retention_days must not be negative")
+		return
+	}
+	p := model.Project{
+		Name:                         strings.TrimSpace(in.Name),
+		SourceConnectorID:            in.SourceConnectorID,
+		TargetConnectorID:            in.TargetConnectorID,
+		RetentionDays:                in.RetentionDays,
+		UnmappedSenderPolicy:         in.Policy,
+		FallbackTeamsUserID:          in.FallbackTeamsUserID,
+		FallbackTeamsUserDisplayName: in.FallbackTeamsUserDisplayName,
+	}
+	if !h.checkProjectConnectors(c, stm, &p) {
+		return
+	}
+	if err := stm.Project.Create(&p); err != nil {
+		log.Printf("project store error: %v", err)
+		c.String(500, "internal")
+		return
+	}
+	c.JSON(201, p)
+}
+
+// projectByID handles GET, PUT and DELETE /projects/:id. PUT changes the name
+// and connectors until the plan is approved; a project with tasks or under
+// legal hold cannot be deleted.
+func (h *Handler) projectByID(c *gin.Context) {
+	stm := h.store(c)
+	p, ok := h.loadProject(c, stm)
+	if !ok {
+		return
+	}
+	switch c.Request.Method {
+	case "GET":
+		c.JSON(200, p)
+	case "PUT":
+		var in projectRequest
+		if err := c.BindJSON(&in); err != nil {
+			c.String(400, "invalid json")
+			return
+		}
+		if !h.checkPlanEditable(c, p) {
+			return
+		}
+		p.Name = strings.TrimSpace(in.Name)
+		p.SourceConnectorID = in.SourceConnectorID
+		p.TargetConnectorID = in.TargetConnectorID
+		if !h.checkProjectConnectors(c, stm, p) {
+			return
+		}
+		if err := stm.Project.Update(p); err != nil {
+			log.Printf("project store error: %v", err)
+			c.String(500, "internal")
+			return
+		}
+		c.JSON(200, p)
+	case "DELETE":
+		if p.LegalHold {
+			c.String(409, "project is under legal hold")
+			return
+		}
+		tasks, err := stm.Task.ListByProject(p.ID, "")
+		if err != nil {
+			log.Printf("task store error: %v", err)
+			c.String(500, "internal")
+			return
+		}
+		if len(tasks) > 0 {
+			c.String(409, "project has tasks")
+			return
+		}
+		if err := stm.Project.Delete(p.ID); err != nil && err != store.ErrNotFound {
+			log.Printf("project store error: %v", err)
+			c.String(500, "internal")
+			return
+		}
+		c.Status(204)
+	}
+}
+
+// checkProjectConnectors validates the project's name and verifies that its
+// source is a Zoom connector and its target a Teams connector, writing a 400
+// response if not.
+func (h *Handler) checkProjectConnectors(c *gin.Context, stm *store.StoreManager, p *model.Project) bool {
+	if p.Name == "" {
+		c.String(400, "name required")
+		return false
+	}
+	for _, ref := range []struct {
+		field, id string
+		typ       model.ConnectorType
+	}{
+		{"source_connector_id", p.SourceConnectorID, model.Zoom},
+		{"target_connector_id", p.TargetConnectorID, model.Teams},
+	} {
+		if ref.id == "" {
+			c.String(400, ref.field+" required")
+			return false
+		}
+		conn, err := stm.Connector.GetByID(ref.id)
+		if err == store.ErrNotFound {
+			c.String(400, ref.field+": connector not found")
+			return false
+		}
+		if err != nil {
+			log.Printf("connector store error: %v", err)
+			c.String(500, "internal")
+			return false
+		}
+		if conn.Type != ref.typ {
+			c.String(400, ref.field+": connector must be of type "+string(ref.typ))
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,49 @@
+package api
+
+import (
+	"log"
+
+	"github.com/gin-gonic/gin"
+
+	"example.com/go-migrator/internal/store"
+)
+
+type retentionSettings struct {
+	RetentionDays int  `json:"retention_days"`
+	LegalHold     bool `json:"legal_hold"`
+}
+
+// projectRetention handles GET and PUT /projects/:id/retention.
+func (h *Handler) projectRetention(c *gin.Context) {
+	ps := h.store(c).Project
+	id := c.Param("id")
+	p, err := ps.GetByID(id)
+	if err != nil {
+		if err == store.ErrNotFound {
+			c.String(404, "not found")
+			return
+		}
+		log.Printf("project store error: %v", err)
+		c.String(500, "internal")
+		return
+	}
+	if c.Request.Method == "PUT" {
+		var in retentionSettings
+		if err := c.BindJSON(&in); err != nil {
+			c.String(400, "invalid json")
+			return
+		}
+		if in.RetentionDays < 0 {
+			c.String(400, "retention_days must not be negative")
+			return
+		}
+		if err := ps.UpdateRetention(p.ID, in.RetentionDays, in.LegalHold); err != nil {
+			log.Printf("project store error: %v", err)
+			c.String(500, "internal")
+			return
+		}
+		c.JSON(200, in)
+		return
+	}
+	c.JSON(200, retentionSettings{RetentionDays: p.RetentionDays, LegalHold: p.LegalHold})
+}
@@ -0,0 +1,221 @@
+// Package discovery inventories the Zoom workspace of a project and proposes
+// the tasks that would migrate it.
+package discovery
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"example.com/go-migrator/internal/mapping"
+	migmodel "example.com/go-migrator/internal/migrator/model"
+	"example.com/go-migrator/internal/model"
+	"example.com/go-migrator/internal/store"
+)
+
+// Source is the part of the Zoom client discovery needs.
+type Source interface {
+	GetUsers() ([]migmodel.ZoomUser, error)
+	GetUserChannels(userID string) ([]migmodel.ZoomChannel, error)
+	FetchChannelMembers(userID, channelID string) ([]migmodel.ZoomChannelMember, error)
+}
+
+// Inventory is the outcome of walking a Zoom account.
+type Inventory struct {
+	Channels []model.DiscoveredChannel `json:"-"`
+	Users    int                       `json:"users"`
+	// Duplicates counts channels seen again through another member.
+	Duplicates int `json:"duplicates"`
+	// Errors lists users and channels that could not be read; discovery
+	// carries on past them.
+	Errors []string `json:"errors,omitempty"`
+}
+
+// Summary reports a discovery run.
+type Summary struct {
+	Inventory
+	ChannelsFound int `json:"channels_found"`
+	Planned       int `json:"planned"`
+	// Existing counts channels skipped because the project already has a
+	// task for them.
+	Existing int `json:"existing"`
+}
+
+// Discover walks every user's channels and the members of each channel.
+// Group chats are not channels and are left out.
+func Discover(src Source, now time.Time) (*Inventory, error) {
+	users, err := src.GetUsers()
+	if err != nil {
+		return nil, fmt.Errorf("list users: %w", err)
+	}
+	inv := &Inventory{Users: len(users)}
+	seen := make(map[string]*model.DiscoveredChannel)
+	var order []string
+	for _, u := range users {
+		channels, err := src.GetUserChannels(u.ID)
+		if err != nil {
+			inv.Errors = append(inv.Errors, fmt.Sprintf("user %s: %v", u.ID, err))
+			continue
+		}
+		for _, ch := range channels {
+			if ch.Type == migmodel.ZoomChannelGroupChat {
+				continue
+			}
+			if dc, ok := seen[ch.ID]; ok {
+				dc.SeenVia++
+				inv.Duplicates++
+				continue
+			}
+			seen[ch.ID] = &model.DiscoveredChannel{
+				ZoomChannelID:   ch.ID,
+				Name:            ch.DisplayName,
+				Type:            ch.Type,
+				OwnerZoomUserID: u.ID,
+				SeenVia:         1,
+				DiscoveredAt:    now,
+			}
+			order = append(order, ch.ID)
+		}
+	}
+
+	for _, id := range order {
+		dc := seen[id]
+		members, err := src.FetchChannelMembers(dc.OwnerZoomUserID, dc.ZoomChannelID)
+		if err != nil {
+			inv.Errors = append(inv.Errors, fmt.Sprintf("channel %s: %v", dc.ZoomChannelID, err))
+		}
+		dc.MemberCount = len(members)
+		inv.Channels = append(inv.Channels, *dc)
+	}
+	return inv, nil
+}
+
+// PlanTasks proposes a planned task per channel, targeting what the mapper
+// maps it to. existing holds the Zoom channel IDs the project already has
+// tasks for; those are skipped.
+func PlanTasks(projectID string, mapper *mapping.Mapper, channels []model.DiscoveredChannel, existing map[string]bool) []model.Task {
+	var tasks []model.Task
+	for i := range channels {
+		ch := &channels[i]
+		if existing[ch.ZoomChannelID] {
+			continue
+		}
+		target := mapper.Map(ch)
+		tasks = append(tasks, model.Task{
+			ProjectID:   projectID,
+			SourcePath:  ch.SourcePath(),
+			TargetPath:  model.ChannelTargetPath(target.Team, target.Channel),
+			TeamType:    string(target.TeamType),
+			ChannelType: string(target.ChannelType),
+			Status:      model.StatusPlanned,
+		})
+	}
+	sort.SliceStable(tasks, func(i, j int) bool { return tasks[i].TargetPath < tasks[j].TargetPath })
+	return tasks
+}
+
+// Run discovers the project's Zoom workspace, stores the inventory and
+// replaces the project's planned tasks with a new plan built from the
+// project's mapping rules. A successful run leaves the project planned, which
+// withdraws any earlier approval.
+func Run(src Source, stm *store.StoreManager, project *model.Project) (*Summary, error) {
+	now := time.Now()
+	summary, err := run(src, stm, project, now)
+	msg := ""
+	if err != nil {
+		msg = err.Error()
+	}
+	if serr := stm.Project.SetDiscovery(project.ID, now, msg); serr != nil && err == nil {
+		err = serr
+	}
+	if err == nil {
+		err = advance(stm, project, model.ProjectDiscovered, model.ProjectPlanned)
+	}
+	return summary, err
+}
+
+// advance moves the project through the given states in order.
+func advance(stm *store.StoreManager, project *model.Project, states ...model.ProjectState) error {
+	for _, to := range states {
+		if !project.State.CanTransition(to) {
+			return fmt.Errorf("project is %s and cannot become %s", project.State, to)
+		}
+		if err := stm.Project.SetState(project.ID, project.State, to, "", time.Time{}); err != nil {
+			return fmt.Errorf("project state %s to %s: %w", project.State, to, err)
+		}
+		project.State = to
+	}
+	return nil
+}
+
+func run(src Source, stm *store.StoreManager, project *model.Project, now time.Time) (*Summary, error) {
+	mapper, err := mapping.Compile(project.MappingRules)
+	if err != nil {
+		return nil, fmt.Errorf("mapping rules: %w", err)
+	}
+	inv, err := Discover(src, now)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range inv.Errors {
+		log.Printf("discovery: project %s: %s", project.ID, e)
+	}
+	if err := stm.Inventory.ReplaceChannels(project.ID, inv.Channels); err != nil {
+		return nil, fmt.Errorf("store inventory: %w", err)
+	}
+
+	summary := &Summary{Inventory: *inv, ChannelsFound: len(inv.Channels)}
+	summary.Planned, summary.Existing, err = replan(stm, project.ID, mapper, inv.Channels)
+	log.Printf("discovery: project %s: %d users, %d channels, %d planned, %d already have tasks, %d errors",
+		project.ID, inv.Users, len(inv.Channels), summary.Planned, summary.Existing, len(inv.Errors))
+	return summary, err
+}
+
+// Replan rebuilds the project's plan from its stored inventory with the
+// current mapping rules, without walking Zoom again. The project becomes
+// planned, withdrawing any earlier approval.
+func Replan(stm *store.StoreManager, project *model.Project) (*Summary, error) {
+	mapper, err := mapping.Compile(project.MappingRules)
+	if err != nil {
+		return nil, fmt.Errorf("mapping rules: %w", err)
+	}
+	channels, err := stm.Inventory.ListChannels(project.ID)
+	if err != nil {
+		return nil, fmt.Errorf("load inventory: %w", err)
+	}
+	summary := &Summary{ChannelsFound: len(channels)}
+	summary.Planned, summary.Existing, err = replan(stm, project.ID, mapper, channels)
+	if err == nil {
+		err = advance(stm, project, model.ProjectPlanned)
+	}
+	return summary, err
+}
+
+// replan replaces the project's planned tasks. It returns how many tasks were
+// planned and how many channels were skipped because they have tasks already.
+func replan(stm *store.StoreManager, projectID string, mapper *mapping.Mapper, channels []model.DiscoveredChannel) (planned, existing int, err error) {
+	if _, err := stm.Task.DeletePlanned(projectID); err != nil {
+		return 0, 0, fmt.Errorf("delete previous plan: %w", err)
+	}
+	tasks, err := stm.Task.ListByProject(projectID, "")
+	if err != nil {
+		return 0, 0, fmt.Errorf("list tasks: %w", err)
+	}
+	have := make(map[string]bool, len(tasks))
+	for i := range tasks {
+		if _, channelID, err := tasks[i].Source(); err == nil {
+			have[channelID] = true
+		}
+	}
+
+	plan := PlanTasks(projectID, mapper, channels, have)
+	existing = len(channels) - len(plan)
+	for i := range plan {
+		if err := stm.Task.Create(&plan[i]); err != nil {
+			return planned, existing, fmt.Errorf("plan task for %s: %w", plan[i].SourcePath, err)
+		}
+		planned++
+	}
+	return planned, existing, nil
+}
@@ -0,0 +1,85 @@
+package discovery
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"example.com/go-migrator/internal/mapping"
+	migmodel "example.com/go-migrator/internal/migrator/model"
+	"example.com/go-migrator/internal/model"
+)
+
+type fakeSource struct {
+	users    []migmodel.ZoomUser
+	channels map[string][]migmodel.ZoomChannel
+	members  map[string][]migmodel.ZoomChannelMember
+	// memberCalls records the owner used to read each channel's members
+	memberCalls map[string]string
+}
+
+func (f *fakeSource) GetUsers() ([]migmodel.ZoomUser, error) { return f.users, nil }
+
+func (f *fakeSource) GetUserChannels(userID string) ([]migmodel.ZoomChannel, error) {
+	if userID == "broken" {
+		return nil, errors.New("forbidden")
+	}
+	return f.channels[userID], nil
+}
+
+func (f *fakeSource) FetchChannelMembers(userID, channelID string) ([]migmodel.ZoomChannelMember, error) {
+	f.memberCalls[channelID] = userID
+	return f.members[channelID], nil
+}
+
+func TestDiscover_DeduplicatesChannels(t *testing.T) {
+	src := &fakeSource{
+		users: []migmodel.ZoomUser{{ID: "u1"}, {ID: "broken"}, {ID: "u2"}},
+		channels: map[string][]migmodel.ZoomChannel{
+			"u1": {{ID: "c1", DisplayName: "General", Type: migmodel.ZoomChannelPublic}, {ID: "g1", Type: migmodel.ZoomChannelGroupChat}},
+			"u2": {{ID: "c1", DisplayName: "General", Type: migmodel.ZoomChannelPublic}, {ID: "c2", DisplayName: "Ops", Type: migmodel.ZoomChannelPrivate}},
+		},
+		members: map[string][]migmodel.ZoomChannelMember{
+			"c1": {{ID: "u1"}, {ID: "u2"}},
+			"c2": {{ID: "u2"}},
+		},
+		memberCalls: map[string]string{},
+	}
+	inv, err := Discover(src, time.Now())
+	if err != nil {
+		t.Fatalf("discover: %v", err)
+	}
+	if len(inv.Channels) != 2 || inv.Duplicates != 1 || len(inv.Errors) != 1 {
+		t.Fatalf("unexpected inventory: %+v", inv)
+	}
+	c1 := inv.Channels[0]
+	if c1.ZoomChannelID != "c1" || c1.OwnerZoomUserID != "u1" || c1.SeenVia != 2 || c1.MemberCount != 2 {
+		t.Fatalf("unexpected c1: %+v", c1)
+	}
+	if src.memberCalls["c1"] != "u1" {
+		t.Fatalf("expected members of c1 to be read through u1, got %q", src.memberCalls["c1"])
+	}
+}
+
+func TestPlanTasks_SkipsExisting(t *testing.T) {
+	channels := []model.DiscoveredChannel{
+		{ZoomChannelID: "c1", Name: "Sales/EMEA", OwnerZoomUserID: "u1"},
+		{ZoomChannelID: "c2", Name: "Ops", OwnerZoomUserID: "u2"},
+	}
+	mapper, err := mapping.Compile(nil)
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	tasks := PlanTasks("p1", mapper, channels, map[string]bool{"c2": true})
+	if len(tasks) != 1 {
+		t.Fatalf("expected 1 task, got %d", len(tasks))
+	}
+	got := tasks[0]
+	if got.Status != model.StatusPlanned || got.ProjectID != "p1" || got.SourcePath != "users/u1/channels/c1" {
+		t.Fatalf("unexpected task: %+v", got)
+	}
+	team, channel, err := got.Target()
+	if err != nil || team != "Sales-EMEA" || channel != "Sales-EMEA" {
+		t.Fatalf("unexpected target %q/%q (%v)", team, channel, err)
+	}
+}
@@ -0,0 +1,264 @@
+package identity
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"example.com/go-migrator/internal/model"
+	"example.com/go-migrator/internal/store"
+)
+
+// Import actions reported per row.
+const (
+	ActionCreated  = "created"
+	ActionUpdated  = "updated"
+	ActionRejected = "rejected"
+)
+
+// ImportRow is one parsed input row. Err is set when the row could not be
+// parsed; such rows are rejected without touching the store.
+type ImportRow struct {
+	Line     int
+	Identity model.Identity
+	Err      error
+}
+
+// RowResult is the outcome of importing a single row.
+type RowResult struct {
+	Line       int    `json:"line"`
+	ZoomUserID string `json:"zoom_user_id,omitempty"`
+	Action     string `json:"action"`
+	Error      string `json:"error,omitempty"`
+}
+
+// ImportReport summarises an import.
+type ImportReport struct {
+	DryRun   bool        `json:"dry_run"`
+	Created  int         `json:"created"`
+	Updated  int         `json:"updated"`
+	Rejected int         `json:"rejected"`
+	Rows     []RowResult `json:"rows"`
+}
+
+// csvColumns maps accepted CSV header names to identity fields. The JSON
+// field names of model.Identity are accepted as well as short aliases.
+var csvColumns = map[string]string{
+	"project_id":                "project_id",
+	"zoom_user_id":              "zoom_user_id",
+	"zoom_id":                   "zoom_user_id",
+	"zoom_user_email":           "zoom_user_email",
+	"zoom_email":                "zoom_user_email",
+	"email":                     "zoom_user_email",
+	"zoom_user_display_name":    "zoom_user_display_name",
+	"zoom_name":                 "zoom_user_display_name",
+	"teams_user_id":             "teams_user_id",
+	"teams_id":                  "teams_user_id",
+	"teams_user_principal_name": "teams_user_principal_name",
+	"teams_upn":                 "teams_user_principal_name",
+	"upn":                       "teams_user_principal_name",
+	"teams_user_display_name":   "teams_user_display_name",
+	"teams_name":                "teams_user_display_name",
+}
+
+// ParseCSV reads identities from CSV with a header row.
+func ParseCSV(r io.Reader) ([]ImportRow, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, errors.New("empty csv")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read csv header: %w", err)
+	}
+	fields := make([]string, len(header))
+	for i, h := range header {
+		h = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff")))
+		if f, ok := csvColumns[h]; ok {
+			fields[i] = f
+		}
+	}
+
+	var rows []ImportRow
+	for line := 2; ; line++ {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		row := ImportRow{Line: line}
+		if err != nil {
+			var perr *csv.ParseError
+			if !errors.As(err, &perr) {
+				return nil, fmt.Errorf("read csv: %w", err)
+			}
+			row.Err = err
+			rows = append(rows, row)
+			continue
+		}
+		values := make(map[string]string)
+		for i, v := range rec {
+			if i < len(fields) && fields[i] != "" {
+				values[fields[i]] = strings.TrimSpace(v)
+			}
+		}
+		row.Identity = model.Identity{
+			ProjectID:              values["project_id"],
+			ZoomUserID:             values["zoom_user_id"],
+			ZoomUserEmail:          values["zoom_user_email"],
+			ZoomUserDisplayName:    values["zoom_user_display_name"],
+			TeamsUserID:            values["teams_user_id"],
+			TeamsUserPrincipalName: values["teams_user_principal_name"],
+			TeamsUserDisplayName:   values["teams_user_display_name"],
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// ParseNDJSON reads identities from newline-delimited JSON objects using the
+// JSON field names of model.Identity. Blank lines are ignored.
+func ParseNDJSON(r io.Reader) ([]ImportRow, error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	var rows []ImportRow
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+		if text == "" {
+			continue
+		}
+		row := ImportRow{Line: line}
+		var in model.Identity
+		if err := json.Unmarshal([]byte(text), &in); err != nil {
+			row.Err = fmt.Errorf("invalid json: %w", err)
+		} else {
+			row.Identity = model.Identity{
+				ProjectID:              strings.TrimSpace(in.ProjectID),
+				ZoomUserID:             strings.TrimSpace(in.ZoomUserID),
+				ZoomUserEmail:          strings.TrimSpace(in.ZoomUserEmail),
+				ZoomUserDisplayName:    strings.TrimSpace(in.ZoomUserDisplayName),
+				TeamsUserID:            strings.TrimSpace(in.TeamsUserID),
+				TeamsUserPrincipalName: strings.TrimSpace(in.TeamsUserPrincipalName),
+				TeamsUserDisplayName:   strings.TrimSpace(in.TeamsUserDisplayName),
+			}
+		}
+		rows = append(rows, row)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("read ndjson: %w", err)
+	}
+	return rows, nil
+}
+
+// Validate checks that an identity carries enough to be mapped.
+func Validate(id *model.Identity) error {
+	if id.ZoomUserID == "" {
+		return errors.New("zoom_user_id required")
+	}
+	return validateMapping(id)
+}
+
+// validateMapping checks an identity's fields other than its Zoom user ID.
+func validateMapping(id *model.Identity) error {
+	if id.TeamsUserID == "" && id.TeamsUserPrincipalName == "" {
+		return errors.New("teams_user_id or teams_user_principal_name required")
+	}
+	if id.ZoomUserEmail != "" && !strings.Contains(id.ZoomUserEmail, "@") {
+		return fmt.Errorf("invalid zoom_user_email %q", id.ZoomUserEmail)
+	}
+	if id.TeamsUserPrincipalName != "" && !strings.Contains(id.TeamsUserPrincipalName, "@") {
+		return fmt.Errorf("invalid teams_user_principal_name %q", id.TeamsUserPrincipalName)
+	}
+	return nil
+}
+
+// Import validates rows and upserts them on ZoomUserID within each row's
+// project scope. A row may name the Zoom user by email only; it is resolved to
+// the Zoom user ID the tenant's identities or identity proposals list for that
+// email, and rejected if none does. Fields a row leaves empty keep their
+// stored values. With dryRun set it only reports what would happen. Rows that
+// repeat an earlier ZoomUserID and ProjectID in the same input, or name a
+// project that projects does not know, are rejected. A store error aborts the
+// import and is returned along with the report so far.
+func Import(is store.IdentityStoreInterface, projects store.ProjectStoreInterface, rows []ImportRow, dryRun bool) (*ImportReport, error) {
+	report := &ImportReport{DryRun: dryRun, Rows: make([]RowResult, 0, len(rows))}
+	seen := make(map[[2]string]int)
+	known := map[string]bool{"": true}
+	for _, row := range rows {
+		res := RowResult{Line: row.Line, ZoomUserID: row.Identity.ZoomUserID}
+		err := row.Err
+		if err == nil && row.Identity.ZoomUserID == "" && row.Identity.ZoomUserEmail != "" {
+			if err = validateMapping(&row.Identity); err == nil {
+				zoomID, lerr := is.ZoomIDByEmail(row.Identity.ZoomUserEmail)
+				switch {
+				case lerr == store.ErrNotFound:
+					err = fmt.Errorf("no known zoom user has zoom_user_email %q, zoom_user_id required", row.Identity.ZoomUserEmail)
+				case lerr != nil:
+					return report, fmt.Errorf("line %d: %w", row.Line, lerr)
+				default:
+					row.Identity.ZoomUserID = zoomID
+					res.ZoomUserID = zoomID
+				}
+			}
+		} else if err == nil {
+			err = Validate(&row.Identity)
+		}
+		if projectID := row.Identity.ProjectID; err == nil {
+			exists, checked := known[projectID]
+			if !checked {
+				_, perr := projects.GetByID(projectID)
+				if perr != nil && perr != store.ErrNotFound {
+					return report, fmt.Errorf("line %d: %w", row.Line, perr)
+				}
+				exists = perr == nil
+				known[projectID] = exists
+			}
+			if !exists {
+				err = fmt.Errorf("unknown project_id %q", projectID)
+			}
+		}
+		key := [2]string{row.Identity.ProjectID, row.Identity.ZoomUserID}
+		if err == nil {
+			if first, dup := seen[key]; dup {
+				err = fmt.Errorf("duplicate zoom_user_id, first seen on line %d", first)
+			}
+		}
+		if err != nil {
+			res.Action = ActionRejected
+			res.Error = err.Error()
+			report.Rejected++
+			report.Rows = append(report.Rows, res)
+			continue
+		}
+		seen[key] = row.Line
+
+		var created bool
+		if dryRun {
+			_, err = is.GetForProject(row.Identity.ProjectID, row.Identity.ZoomUserID)
+			created = err == store.ErrNotFound
+			if created {
+				err = nil
+			}
+		} else {
+			identity := row.Identity
+			created, err = is.Upsert(&identity)
+		}
+		if err != nil {
+			return report, fmt.Errorf("line %d: %w", row.Line, err)
+		}
+		if created {
+			res.Action = ActionCreated
+			report.Created++
+		} else {
+			res.Action = ActionUpdated
+			report.Updated++
+		}
+		report.Rows = append(report.Rows, res)
+	}
+	return report, nil
+}
@@ -0,0 +1,303 @@
+package identity
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/go-migrator/internal/model"
+	"example.com/go-migrator/internal/store"
+)
+
+// memIdentityStore is an in-memory IdentityStoreInterface keyed by ProjectID
+// and ZoomUserID.
+type memIdentityStore struct {
+	byZoom map[[2]string]model.Identity
+}
+
+func memKey(id *model.Identity) [2]string { return [2]string{id.ProjectID, id.ZoomUserID} }
+
+func newMemIdentityStore(ids ...model.Identity) *memIdentityStore {
+	s := &memIdentityStore{byZoom: map[[2]string]model.Identity{}}
+	for _, id := range ids {
+		s.byZoom[memKey(&id)] = id
+	}
+	return s
+}
+
+func (s *memIdentityStore) Create(identity *model.Identity) error {
+	s.byZoom[memKey(identity)] = *identity
+	return nil
+}
+
+func (s *memIdentityStore) GetByZoomID(zoomID string) (*model.Identity, error) {
+	return s.GetForProject("", zoomID)
+}
+
+func (s *memIdentityStore) GetForProject(projectID, zoomID string) (*model.Identity, error) {
+	id, ok := s.byZoom[[2]string{projectID, zoomID}]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	return &id, nil
+}
+
+func (s *memIdentityStore) Resolve(projectID, zoomID string) (*model.Identity, error) {
+	if id, err := s.GetForProject(projectID, zoomID); err == nil {
+		return id, nil
+	}
+	return s.GetByZoomID(zoomID)
+}
+
+func (s *memIdentityStore) GetByTeamsID(teamsID string) (*model.Identity, error) {
+	for _, id := range s.byZoom {
+		if id.TeamsUserID == teamsID {
+			return &id, nil
+		}
+	}
+	return nil, store.ErrNotFound
+}
+
+func (s *memIdentityStore) ZoomIDByEmail(email string) (string, error) {
+	for _, id := range s.byZoom {
+		if strings.EqualFold(id.ZoomUserEmail, email) {
+			return id.ZoomUserID, nil
+		}
+	}
+	return "", store.ErrNotFound
+}
+
+// Upsert keeps the stored values of the fields identity leaves empty, like
+// the real store does for an unchanged Teams user.
+func (s *memIdentityStore) Upsert(identity *model.Identity) (bool, error) {
+	old, exists := s.byZoom[memKey(identity)]
+	if exists {
+		if identity.ZoomUserEmail == "" {
+			identity.ZoomUserEmail = old.ZoomUserEmail
+		}
+		if identity.TeamsUserID == "" {
+			identity.TeamsUserID = old.TeamsUserID
+		}
+	}
+	s.byZoom[memKey(identity)] = *identity
+	return !exists, nil
+}
+
+func (s *memIdentityStore) GetByID(id uint) (*model.Identity, error) {
+	for _, i := range s.byZoom {
+		if i.ID == id {
+			return &i, nil
+		}
+	}
+	return nil, store.ErrNotFound
+}
+
+func (s *memIdentityStore) List(search string, offset, limit int) ([]model.Identity, int64, error) {
+	return nil, 0, nil
+}
+
+func (s *memIdentityStore) Update(identity *model.Identity) error {
+	s.byZoom[memKey(identity)] = *identity
+	return nil
+}
+
+func (s *memIdentityStore) Delete(id uint) error { return nil }
+
+func (s *memIdentityStore) ListAfter(projectID string, afterID uint, limit int) ([]model.Identity, error) {
+	return nil, nil
+}
+
+func (s *memIdentityStore) ListOverrides(projectID string) ([]model.Identity, error) {
+	return nil, nil
+}
+
+func (s *memIdentityStore) SetValidation(projectID string, id uint, status, errMsg, teamsUserID string, at time.Time) error {
+	return nil
+}
+
+func (s *memIdentityStore) CountByValidationStatus(projectID string) (map[string]int64, error) {
+	return map[string]int64{}, nil
+}
+
+func (s *memIdentityStore) ListInvalid(projectID string, limit int) ([]model.Identity, error) {
+	return nil, nil
+}
+
+func (s *memIdentityStore) AddAlias(alias *model.IdentityAlias) error { return nil }
+
+func (s *memIdentityStore) GetAlias(aliasZoomID string) (*model.IdentityAlias, error) {
+	return nil, store.ErrNotFound
+}
+
+func (s *memIdentityStore) ListAliases(zoomID string) ([]model.IdentityAlias, error) {
+	return nil, nil
+}
+
+func (s *memIdentityStore) DeleteAlias(aliasZoomID string) error { return store.ErrNotFound }
+
+// memProjectStore knows the projects with the given IDs.
+type memProjectStore struct {
+	store.ProjectStoreInterface
+	ids map[string]bool
+}
+
+func newMemProjectStore(ids ...string) *memProjectStore {
+	s := &memProjectStore{ids: map[string]bool{}}
+	for _, id := range ids {
+		s.ids[id] = true
+	}
+	return s
+}
+
+func (s *memProjectStore) GetByID(id string) (*model.Project, error) {
+	if !s.ids[id] {
+		return nil, store.ErrNotFound
+	}
+	return &model.Project{ID: id}, nil
+}
+
+func TestParseCSV_HeaderAliases(t *testing.T) {
+	in := "zoom_id,Email,teams_id,UPN\n" +
+		"z1,a@zoom.example,t1,a@contoso.example\n" +
+		"z2,b@zoom.example,,b@contoso.example\n"
+	rows, err := ParseCSV(strings.NewReader(in))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("expected 2 rows, got %d", len(rows))
+	}
+	got := rows[0].Identity
+	if got.ZoomUserID != "z1" || got.ZoomUserEmail != "a@zoom.example" || got.TeamsUserID != "t1" || got.TeamsUserPrincipalName != "a@contoso.example" {
+		t.Fatalf("unexpected identity: %+v", got)
+	}
+	if rows[1].Line != 3 {
+		t.Fatalf("expected line 3, got %d", rows[1].Line)
+	}
+}
+
+func TestImport_Report(t *testing.T) {
+	is := newMemIdentityStore(model.Identity{ZoomUserID: "z1", TeamsUserID: "old"})
+	in := `{"zoom_user_id":"z1","teams_user_id":"t1"}
+{"zoom_user_id":"z2","teams_user_principal_name":"b@contoso.example"}
+{"zoom_user_id":"z3"}
+not json
+{"zoom_user_id":"z2","teams_user_id":"t2"}
+`
+	rows, err := ParseNDJSON(strings.NewReader(in))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	report, err := Import(is, newMemProjectStore(), rows, false)
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	if report.Created != 1 || report.Updated != 1 || report.Rejected != 3 {
+		t.Fatalf("unexpected counts: %+v", report)
+	}
+	want := []string{ActionUpdated, ActionCreated, ActionRejected, ActionRejected, ActionRejected}
+	for i, r := range report.Rows {
+		if r.Action != want[i] {
+			t.Fatalf("row %d: want %s got %s (%s)", i, want[i], r.Action, r.Error)
+		}
+	}
+	if is.byZoom[[2]string{"", "z1"}].TeamsUserID != "t1" {
+		t.Fatalf("expected z1 to be updated")
+	}
+}
+
+func TestImport_ProjectOverride(t *testing.T) {
+	is := newMemIdentityStore(model.Identity{ZoomUserID: "z1", TeamsUserID: "t1"})
+	in := "project_id,zoom_id,teams_id\n" +
+		"p1,z1,t1-p1\n" +
+		"p2,z1,t1-p2\n" +
+		"p1,z1,t1-again\n"
+	rows, err := ParseCSV(strings.NewReader(in))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	report, err := Import(is, newMemProjectStore("p1", "p2"), rows, false)
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	if report.Created != 2 || report.Rejected != 1 {
+		t.Fatalf("unexpected counts: %+v", report)
+	}
+	if got := is.byZoom[[2]string{"", "z1"}].TeamsUserID; got != "t1" {
+		t.Fatalf("tenant-wide mapping changed to %s", got)
+	}
+	if got := is.byZoom[[2]string{"p2", "z1"}].TeamsUserID; got != "t1-p2" {
+		t.Fatalf("expected p2 override, got %q", got)
+	}
+}
+
+func TestImport_DryRunDoesNotWrite(t *testing.T) {
+	is := newMemIdentityStore()
+	rows := []ImportRow{{Line: 1, Identity: model.Identity{ZoomUserID: "z1", TeamsUserID: "t1"}}}
+	report, err := Import(is, newMemProjectStore(), rows, true)
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	if report.Created != 1 || !report.DryRun {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	if len(is.byZoom) != 0 {
+		t.Fatalf("dry run wrote to the store")
+	}
+}
+
+func TestImport_RejectsUnknownProject(t *testing.T) {
+	is := newMemIdentityStore()
+	in := `{"project_id":"p1","zoom_user_id":"z1","teams_user_id":"t1"}
+{"project_id":"gone","zoom_user_id":"z1","teams_user_id":"t1"}
+{"zoom_user_id":"z1","teams_user_id":"t1"}
+`
+	rows, err := ParseNDJSON(strings.NewReader(in))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	report, err := Import(is, newMemProjectStore("p1"), rows, false)
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	if report.Created != 2 || report.Rejected != 1 {
+		t.Fatalf("unexpected counts: %+v", report)
+	}
+	if r := report.Rows[1]; r.Action != ActionRejected || !strings.Contains(r.Error, "unknown project_id") {
+		t.Fatalf("expected the unknown project rejected, got %+v", r)
+	}
+	if _, ok := is.byZoom[[2]string{"gone", "z1"}]; ok {
+		t.Fatalf("override for an unknown project was stored")
+	}
+	if _, ok := is.byZoom[[2]string{"p1", "z1"}]; !ok {
+		t.Fatalf("expected the p1 override from ndjson")
+	}
+}
+
+func TestImport_ResolvesEmailOnlyRows(t *testing.T) {
+	is := newMemIdentityStore(model.Identity{ZoomUserID: "z1", ZoomUserEmail: "ann@zoom.example", TeamsUserID: "t1"})
+	in := "email,upn\n" +
+		"Ann@zoom.example,ann@contoso.example\n" +
+		"bob@zoom.example,bob@contoso.example\n"
+	rows, err := ParseCSV(strings.NewReader(in))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	report, err := Import(is, newMemProjectStore(), rows, false)
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	if report.Updated != 1 || report.Rejected != 1 {
+		t.Fatalf("unexpected counts: %+v", report)
+	}
+	if r := report.Rows[0]; r.ZoomUserID != "z1" {
+		t.Fatalf("expected the email resolved to z1, got %+v", r)
+	}
+	if r := report.Rows[1]; !strings.Contains(r.Error, "bob@zoom.example") {
+		t.Fatalf("expected the unknown email rejected, got %+v", r)
+	}
+	got := is.byZoom[[2]string{"", "z1"}]
+	if got.TeamsUserPrincipalName != "ann@contoso.example" || got.TeamsUserID != "t1" {
+		t.Fatalf("expected z1's UPN added and its Teams ID kept, got %+v", got)
+	}
+}
@@ -0,0 +1,63 @@
+package identity
+
+import (
+	"fmt"
+	"log"
+
+	migmodel "example.com/go-migrator/internal/migrator/model"
+	"example.com/go-migrator/internal/store"
+)
+
+// ZoomUserLister lists the users of the Zoom account.
+type ZoomUserLister interface {
+	GetUsers() ([]migmodel.ZoomUser, error)
+}
+
+// EntraUserLister lists the users of the destination tenant.
+type EntraUserLister interface {
+	ListUsers() ([]migmodel.EntraUser, error)
+}
+
+// MatchSummary describes the outcome of a matching run.
+type MatchSummary struct {
+	ZoomUsers     int `json:"zoom_users"`
+	EntraUsers    int `json:"entra_users"`
+	AlreadyMapped int `json:"already_mapped"`
+	Proposals     int `json:"proposals"`
+}
+
+// RunMatching pulls all Zoom and Entra users, matches the Zoom users that have
+// no identity yet and replaces the pending proposals with the result. Nothing
+// is written to the identity store; proposals must be accepted first.
+func RunMatching(src ZoomUserLister, dst EntraUserLister, stm *store.StoreManager) (*MatchSummary, error) {
+	zoomUsers, err := src.GetUsers()
+	if err != nil {
+		return nil, fmt.Errorf("list zoom users: %w", err)
+	}
+	entraUsers, err := dst.ListUsers()
+	if err != nil {
+		return nil, fmt.Errorf("list entra users: %w", err)
+	}
+
+	summary := &MatchSummary{ZoomUsers: len(zoomUsers), EntraUsers: len(entraUsers)}
+	unmapped := zoomUsers[:0:0]
+	for _, zu := range zoomUsers {
+		_, err := stm.Identity.GetByZoomID(zu.ID)
+		switch {
+		case err == nil:
+			summary.AlreadyMapped++
+		case err == store.ErrNotFound:
+			unmapped = append(unmapped, zu)
+		default:
+			return nil, fmt.Errorf("lookup identity %s: %w", zu.ID, err)
+		}
+	}
+
+	proposals := Match(unmapped, entraUsers)
+	if err := stm.Proposal.ReplacePending(proposals); err != nil {
+		return nil, fmt.Errorf("store proposals: %w", err)
+	}
+	summary.Proposals = len(proposals)
+	log.Printf("identity: matched %d of %d unmapped zoom users", len(proposals), len(unmapped))
+	return summary, nil
+}
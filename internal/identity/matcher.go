@@ -0,0 +1,210 @@
+package identity
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	migmodel "example.com/go-migrator/internal/migrator/model"
+	"example.com/go-migrator/internal/model"
+)
+
+// Match reasons, strongest first.
+const (
+	ReasonEmail       = "email"
+	ReasonAlias       = "alias"
+	ReasonLocalPart   = "email_local_part"
+	ReasonDisplayName = "display_name"
+)
+
+const (
+	scoreEmail     = 1.0
+	scoreAlias     = 0.95
+	scoreLocalPart = 0.8
+	// display name matches are scaled by their similarity and never beat an
+	// address match
+	scoreDisplayName = 0.75
+	// minNameSimilarity is the Jaro-Winkler similarity below which display
+	// names are not considered a match.
+	minNameSimilarity = 0.9
+	// ambiguityPenalty scales a score when several Entra users tie for it.
+	ambiguityPenalty = 0.5
+)
+
+// Match proposes at most one Entra user for each Zoom user. Candidates are
+// ranked by exact email/UPN match, alias (proxy addresses and other mails),
+// email local part, then display name similarity. When several Entra users
+// tie for the best score the proposal is kept but its score is halved, so
+// reviewers see it is ambiguous.
+func Match(zoomUsers []migmodel.ZoomUser, entraUsers []migmodel.EntraUser) []model.IdentityProposal {
+	byAddress := make(map[string][]int)
+	byAlias := make(map[string][]int)
+	byLocal := make(map[string][]int)
+	names := make([]string, len(entraUsers))
+	for i, u := range entraUsers {
+		for _, a := range []string{u.Mail, u.UserPrincipalName} {
+			if a = normalizeAddress(a); a != "" {
+				byAddress[a] = appendUnique(byAddress[a], i)
+				byLocal[localPart(a)] = appendUnique(byLocal[localPart(a)], i)
+			}
+		}
+		for _, a := range u.OtherMails {
+			if a = normalizeAddress(a); a != "" {
+				byAlias[a] = appendUnique(byAlias[a], i)
+			}
+		}
+		for _, a := range u.ProxyAddresses {
+			// proxy addresses look like "SMTP:primary@x" or "smtp:alias@x"
+			if p, ok := strings.CutPrefix(strings.ToLower(a), "smtp:"); ok {
+				byAlias[normalizeAddress(p)] = appendUnique(byAlias[normalizeAddress(p)], i)
+			}
+		}
+		names[i] = normalizeName(u.DisplayName)
+	}
+
+	var proposals []model.IdentityProposal
+	for _, zu := range zoomUsers {
+		email := normalizeAddress(zu.Email)
+		var (
+			candidates []int
+			score      float64
+			reason     string
+		)
+		switch {
+		case email != "" && len(byAddress[email]) > 0:
+			candidates, score, reason = byAddress[email], scoreEmail, ReasonEmail
+		case email != "" && len(byAlias[email]) > 0:
+			candidates, score, reason = byAlias[email], scoreAlias, ReasonAlias
+		case email != "" && len(byLocal[localPart(email)]) > 0:
+			candidates, score, reason = byLocal[localPart(email)], scoreLocalPart, ReasonLocalPart
+		default:
+			candidates, score = bestByName(normalizeName(zu.DisplayName), names)
+			reason = ReasonDisplayName
+		}
+		if len(candidates) == 0 {
+			continue
+		}
+		if len(candidates) > 1 {
+			score *= ambiguityPenalty
+		}
+		eu := entraUsers[candidates[0]]
+		proposals = append(proposals, model.IdentityProposal{
+			ZoomUserID:             zu.ID,
+			ZoomUserEmail:          zu.Email,
+			ZoomUserDisplayName:    zu.DisplayName,
+			TeamsUserID:            eu.ID,
+			TeamsUserPrincipalName: eu.UserPrincipalName,
+			TeamsUserDisplayName:   eu.DisplayName,
+			Score:                  score,
+			Reason:                 reason,
+		})
+	}
+	return proposals
+}
+
+// bestByName returns the Entra users whose normalized display name is most
+// similar to name, and the resulting score.
+func bestByName(name string, names []string) ([]int, float64) {
+	if name == "" {
+		return nil, 0
+	}
+	var (
+		best    []int
+		bestSim float64
+	)
+	for i, n := range names {
+		if n == "" {
+			continue
+		}
+		sim := jaroWinkler(name, n)
+		if sim < minNameSimilarity {
+			continue
+		}
+		switch {
+		case sim > bestSim:
+			best, bestSim = []int{i}, sim
+		case sim == bestSim:
+			best = append(best, i)
+		}
+	}
+	return best, bestSim * scoreDisplayName
+}
+
+func normalizeAddress(a string) string {
+	return strings.ToLower(strings.TrimSpace(a))
+}
+
+func localPart(a string) string {
+	if i := strings.IndexByte(a, '@'); i >= 0 {
+		return a[:i]
+	}
+	return a
+}
+
+// normalizeName lowercases a display name, drops punctuation and sorts its
+// words so "Doe, Jane" and "Jane Doe" compare equal.
+func normalizeName(n string) string {
+	words := strings.FieldsFunc(strings.ToLower(n), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	sort.Strings(words)
+	return strings.Join(words, " ")
+}
+
+func appendUnique(s []int, v int) []int {
+	for _, x := range s {
+		if x == v {
+			return s
+		}
+	}
+	return append(s, v)
+}
+
+// jaroWinkler returns the Jaro-Winkler similarity of a and b in [0, 1].
+func jaroWinkler(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	if len(ra) == 0 || len(rb) == 0 {
+		return 0
+	}
+	window := max(len(ra), len(rb))/2 - 1
+	if window < 0 {
+		window = 0
+	}
+	matchedA := make([]bool, len(ra))
+	matchedB := make([]bool, len(rb))
+	matches := 0
+	for i := range ra {
+		lo, hi := max(0, i-window), min(len(rb), i+window+1)
+		for j := lo; j < hi; j++ {
+			if !matchedB[j] && ra[i] == rb[j] {
+				matchedA[i], matchedB[j] = true, true
+				matches++
+				break
+			}
+		}
+	}
+	if matches == 0 {
+		return 0
+	}
+	transpositions, j := 0, 0
+	for i := range ra {
+		if !matchedA[i] {
+			continue
+		}
+		for !matchedB[j] {
+			j++
+		}
+		if ra[i] != rb[j] {
+			transpositions++
+		}
+		j++
+	}
+	m := float64(matches)
+	jaro := (m/float64(len(ra)) + m/float64(len(rb)) + (m-float64(transpositions)/2)/m) / 3
+
+	prefix := 0
+	for prefix < min(4, len(ra), len(rb)) && ra[prefix] == rb[prefix] {
+		prefix++
+	}
+	return jaro + float64(prefix)*0.1*(1-jaro)
+}
@@ -0,0 +1,62 @@
+package identity
+
+import (
+	"testing"
+
+	migmodel "example.com/go-migrator/internal/migrator/model"
+)
+
+func TestMatch_Rules(t *testing.T) {
+	entra := []migmodel.EntraUser{
+		{ID: "e1", DisplayName: "Jane Doe", UserPrincipalName: "jane.doe@contoso.example"},
+		{ID: "e2", DisplayName: "John Smith", UserPrincipalName: "jsmith@contoso.example", ProxyAddresses: []string{"SMTP:jsmith@contoso.example", "smtp:john.smith@legacy.example"}},
+		{ID: "e3", DisplayName: "Ana María López", UserPrincipalName: "alopez@contoso.example"},
+		{ID: "e4", DisplayName: "Sam Lee", UserPrincipalName: "sam.lee@contoso.example"},
+	}
+	zoom := []migmodel.ZoomUser{
+		{ID: "z1", DisplayName: "Jane", Email: "JANE.DOE@contoso.example"},
+		{ID: "z2", DisplayName: "John", Email: "john.smith@legacy.example"},
+		{ID: "z3", DisplayName: "López, Ana María", Email: "ana@zoom-only.example"},
+		{ID: "z4", DisplayName: "Sam", Email: "sam.lee@oldcorp.example"},
+		{ID: "z5", DisplayName: "Nobody Known", Email: "nobody@zoom-only.example"},
+	}
+	got := Match(zoom, entra)
+	want := map[string]struct {
+		teams  string
+		reason string
+	}{
+		"z1": {"e1", ReasonEmail},
+		"z2": {"e2", ReasonAlias},
+		"z3": {"e3", ReasonDisplayName},
+		"z4": {"e4", ReasonLocalPart},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("expected %d proposals, got %d: %+v", len(want), len(got), got)
+	}
+	for _, p := range got {
+		w, ok := want[p.ZoomUserID]
+		if !ok {
+			t.Fatalf("unexpected proposal for %s", p.ZoomUserID)
+		}
+		if p.TeamsUserID != w.teams || p.Reason != w.reason {
+			t.Fatalf("%s: want %s/%s got %s/%s", p.ZoomUserID, w.teams, w.reason, p.TeamsUserID, p.Reason)
+		}
+		if p.Score <= 0 || p.Score > 1 {
+			t.Fatalf("%s: score out of range: %v", p.ZoomUserID, p.Score)
+		}
+	}
+}
+
+func TestMatch_AmbiguousNameIsPenalised(t *testing.T) {
+	entra := []migmodel.EntraUser{
+		{ID: "e1", DisplayName: "Alex Kim"},
+		{ID: "e2", DisplayName: "Alex Kim"},
+	}
+	got := Match([]migmodel.ZoomUser{{ID: "z1", DisplayName: "Alex Kim"}}, entra)
+	if len(got) != 1 {
+		t.Fatalf("expected one proposal, got %d", len(got))
+	}
+	if got[0].Score > scoreDisplayName*ambiguityPenalty {
+		t.Fatalf("expected ambiguous score to be penalised, got %v", got[0].Score)
+	}
+}
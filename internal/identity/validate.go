@@ -0,0 +1,122 @@
+package identity
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	migmodel "example.com/go-migrator/internal/migrator/model"
+	"example.com/go-migrator/internal/model"
+	"example.com/go-migrator/internal/store"
+)
+
+// validationBatch is how many identities are loaded per store query.
+const validationBatch = 200
+
+// EntraUserGetter looks up a single user of the destination tenant.
+type EntraUserGetter interface {
+	GetUser(idOrUPN string) (*migmodel.EntraUser, error)
+}
+
+// ValidationSummary counts the outcome of a validation run per status.
+type ValidationSummary struct {
+	Checked  int            `json:"checked"`
+	ByStatus map[string]int `json:"by_status"`
+}
+
+// ValidateMappings checks every identity visible to a project against the
+// project's destination tenant and records the result for the project. A
+// mapping is valid when the Teams user exists, is enabled and, if the mapping
+// names a UPN, has that UPN. Lookups run with the given concurrency.
+func ValidateMappings(dst EntraUserGetter, is store.IdentityStoreInterface, projectID string, concurrency int) (*ValidationSummary, error) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	summary := &ValidationSummary{ByStatus: map[string]int{}}
+	var (
+		mu       sync.Mutex
+		storeErr error
+	)
+	var afterID uint
+	for {
+		batch, err := is.ListAfter(projectID, afterID, validationBatch)
+		if err != nil {
+			return summary, err
+		}
+		if len(batch) == 0 {
+			break
+		}
+		afterID = batch[len(batch)-1].ID
+
+		sem := make(chan struct{}, concurrency)
+		var wg sync.WaitGroup
+		for i := range batch {
+			id := &batch[i]
+			sem <- struct{}{}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer func() { <-sem }()
+				status, msg, teamsUserID := CheckIdentity(dst, id)
+				if id.TeamsUserID != "" {
+					teamsUserID = ""
+				}
+				err := is.SetValidation(projectID, id.ID, status, msg, teamsUserID, time.Now())
+				mu.Lock()
+				defer mu.Unlock()
+				summary.Checked++
+				summary.ByStatus[status]++
+				if err != nil && storeErr == nil {
+					storeErr = fmt.Errorf("record validation for identity %d: %w", id.ID, err)
+				}
+			}()
+		}
+		wg.Wait()
+		if storeErr != nil {
+			return summary, storeErr
+		}
+	}
+	log.Printf("identity: validated %d mappings: %v", summary.Checked, summary.ByStatus)
+	return summary, nil
+}
+
+// CheckIdentity validates one mapping and returns its status and, for broken
+// mappings, a reason. For valid mappings it also returns the Teams user ID,
+// which mappings that only name a UPN need before messages can be posted as
+// the user.
+func CheckIdentity(dst EntraUserGetter, id *model.Identity) (status, msg, teamsUserID string) {
+	key := id.TeamsUserID
+	if key == "" {
+		key = id.TeamsUserPrincipalName
+	}
+	if key == "" {
+		return model.IdentityNotFound, "no teams_user_id or teams_user_principal_name", ""
+	}
+	user, err := dst.GetUser(key)
+	if errors.Is(err, migmodel.ErrUserNotFound) {
+		return model.IdentityNotFound, fmt.Sprintf("user %s does not exist in the destination tenant", key), ""
+	}
+	if err != nil {
+		return model.IdentityCheckFailed, truncate(err.Error(), 255), ""
+	}
+	if id.TeamsUserID != "" && !strings.EqualFold(user.ID, id.TeamsUserID) {
+		return model.IdentityNotFound, fmt.Sprintf("user resolved to %s, not %s", user.ID, id.TeamsUserID), ""
+	}
+	if user.AccountEnabled != nil && !*user.AccountEnabled {
+		return model.IdentityDisabled, fmt.Sprintf("account %s is disabled", user.UserPrincipalName), ""
+	}
+	if id.TeamsUserPrincipalName != "" && !strings.EqualFold(user.UserPrincipalName, id.TeamsUserPrincipalName) {
+		return model.IdentityUPNMismatch, fmt.Sprintf("UPN is %s, mapping says %s", user.UserPrincipalName, id.TeamsUserPrincipalName), ""
+	}
+	return model.IdentityValid, "", user.ID
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
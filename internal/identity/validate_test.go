@@ -0,0 +1,69 @@
+package identity
+
+import (
+	"strings"
+	"testing"
+
+	migmodel "example.com/go-migrator/internal/migrator/model"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"example.com/go-migrator/internal/model"
+	"example.com/go-migrator/internal/store"
+)
+
+// fakeDirectory finds users by ID or, case-insensitively, by UPN.
+type fakeDirectory []migmodel.EntraUser
+
+func (d fakeDirectory) GetUser(idOrUPN string) (*migmodel.EntraUser, error) {
+	for i := range d {
+		if d[i].ID == idOrUPN || strings.EqualFold(d[i].UserPrincipalName, idOrUPN) {
+			return &d[i], nil
+		}
+	}
+	return nil, migmodel.ErrUserNotFound
+}
+
+func TestValidateMappings_ResolvesUPNs(t *testing.T) {
+	stm := store.NewStoreManager(newTestDB(t), nil).ForTenant("a")
+	dir := fakeDirectory{{ID: "t1", UserPrincipalName: "jane@contoso.example"}}
+	for _, id := range []*model.Identity{
+		{ZoomUserID: "z1", TeamsUserPrincipalName: "Jane@contoso.example"},
+		{ZoomUserID: "z2", TeamsUserPrincipalName: "gone@contoso.example"},
+	} {
+		if err := stm.Identity.Create(id); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	summary, err := ValidateMappings(dir, stm.Identity, "", 2)
+	if err != nil || summary.ByStatus[model.IdentityValid] != 1 || summary.ByStatus[model.IdentityNotFound] != 1 {
+		t.Fatalf("unexpected summary %+v, %v", summary, err)
+	}
+	// the mapping a migration uses now carries the Teams user ID
+	z1, err := stm.Identity.Resolve("", "z1")
+	if err != nil || z1.TeamsUserID != "t1" || z1.ValidationStatus != model.IdentityValid {
+		t.Fatalf("expected z1 resolved to t1, got %+v, %v", z1, err)
+	}
+	if z2, _ := stm.Identity.Resolve("", "z2"); z2.TeamsUserID != "" {
+		t.Fatalf("expected no Teams user for the broken mapping, got %q", z2.TeamsUserID)
+	}
+}
+
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{TranslateError: true, Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	if err := store.AutoMigrate(db, "default"); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
@@ -0,0 +1,203 @@
+// Package mapping decides the Teams team and channel each Zoom channel is
+// migrated into, from a project's mapping rules.
+//
+// Team and channel templates may use {name} (the Zoom channel name), {id}
+// (the Zoom channel ID), and the capture groups of the rule's Match
+// expression, by number ({1}) or by name. A rule with a fixed team template
+// consolidates every channel it matches as channels of one team.
+package mapping
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	migmodel "example.com/go-migrator/internal/migrator/model"
+	"example.com/go-migrator/internal/model"
+)
+
+// DefaultTemplate is used for a rule's empty team or channel template and
+// for channels no rule matches.
+const DefaultTemplate = "{name}"
+
+var placeholder = regexp.MustCompile(`\{(\w+)\}`)
+
+// Target is where a Zoom channel is migrated to. Rule is the index of the
+// rule that matched, or -1 for the default mapping.
+type Target struct {
+	Team        string               `json:"team"`
+	Channel     string               `json:"channel"`
+	TeamType    migmodel.TeamType    `json:"team_type"`
+	ChannelType migmodel.ChannelType `json:"channel_type"`
+	Rule        int                  `json:"rule"`
+}
+
+type rule struct {
+	match       *regexp.Regexp
+	team        string
+	channel     string
+	teamType    migmodel.TeamType
+	channelType migmodel.ChannelType
+}
+
+// Mapper applies compiled mapping rules.
+type Mapper struct {
+	rules []rule
+}
+
+// Compile validates rules and prepares them for mapping.
+func Compile(rules []model.MappingRule) (*Mapper, error) {
+	m := &Mapper{}
+	for i, r := range rules {
+		c := rule{team: r.Team, channel: r.Channel}
+		if c.team == "" {
+			c.team = DefaultTemplate
+		}
+		if c.channel == "" {
+			c.channel = DefaultTemplate
+		}
+		re, err := regexp.Compile(r.Match)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: invalid match: %w", i, err)
+		}
+		c.match = re
+		for _, tmpl := range []string{c.team, c.channel} {
+			if err := checkTemplate(tmpl, re); err != nil {
+				return nil, fmt.Errorf("rule %d: %w", i, err)
+			}
+		}
+		switch migmodel.TeamType(r.TeamType) {
+		case "", migmodel.TeamPublic, migmodel.TeamPrivate:
+			c.teamType = migmodel.TeamType(r.TeamType)
+		default:
+			return nil, fmt.Errorf("rule %d: team_type must be public or private", i)
+		}
+		switch migmodel.ChannelType(r.ChannelType) {
+		case "", migmodel.ChannelStandard, migmodel.ChannelPrivate, migmodel.ChannelShared:
+			c.channelType = migmodel.ChannelType(r.ChannelType)
+		default:
+			return nil, fmt.Errorf("rule %d: channel_type must be standard, private or shared", i)
+		}
+		m.rules = append(m.rules, c)
+	}
+	return m, nil
+}
+
+// checkTemplate rejects placeholders the rule cannot fill.
+func checkTemplate(tmpl string, re *regexp.Regexp) error {
+	for _, ph := range placeholder.FindAllStringSubmatch(tmpl, -1) {
+		key := ph[1]
+		if key == "name" || key == "id" {
+			continue
+		}
+		if n, err := strconv.Atoi(key); err == nil {
+			if n > re.NumSubexp() {
+				return fmt.Errorf("template %q uses {%d} but match has %d groups", tmpl, n, re.NumSubexp())
+			}
+			continue
+		}
+		if re.SubexpIndex(key) < 0 {
+			return fmt.Errorf("template %q uses unknown placeholder {%s}", tmpl, key)
+		}
+	}
+	return nil
+}
+
+// Map returns the target of a Zoom channel: the first matching rule wins, and
+// channels no rule matches get a team and channel named after them.
+func (m *Mapper) Map(ch *model.DiscoveredChannel) Target {
+	for i, r := range m.rules {
+		groups := r.match.FindStringSubmatch(ch.Name)
+		if groups == nil {
+			continue
+		}
+		t := Target{
+			Team:        expand(r.team, ch, r.match, groups),
+			Channel:     expand(r.channel, ch, r.match, groups),
+			TeamType:    r.teamType,
+			ChannelType: r.channelType,
+			Rule:        i,
+		}
+		return withDefaults(t, ch)
+	}
+	return withDefaults(Target{
+		Team:    expand(DefaultTemplate, ch, nil, nil),
+		Channel: expand(DefaultTemplate, ch, nil, nil),
+		Rule:    -1,
+	}, ch)
+}
+
+// withDefaults fills unset types: teams are public, and private Zoom channels
+// become private Teams channels.
+func withDefaults(t Target, ch *model.DiscoveredChannel) Target {
+	if t.TeamType == "" {
+		t.TeamType = migmodel.TeamPublic
+	}
+	if t.ChannelType == "" {
+		t.ChannelType = migmodel.ChannelStandard
+		if ch.Type == migmodel.ZoomChannelPrivate || ch.Type == migmodel.ZoomChannelPrivateInternal {
+			t.ChannelType = migmodel.ChannelPrivate
+		}
+	}
+	return t
+}
+
+func expand(tmpl string, ch *model.DiscoveredChannel, re *regexp.Regexp, groups []string) string {
+	out := placeholder.ReplaceAllStringFunc(tmpl, func(ph string) string {
+		key := ph[1 : len(ph)-1]
+		switch key {
+		case "name":
+			return ch.Name
+		case "id":
+			return ch.ZoomChannelID
+		}
+		if n, err := strconv.Atoi(key); err == nil && n < len(groups) {
+			return groups[n]
+		}
+		if re != nil {
+			if i := re.SubexpIndex(key); i >= 0 && i < len(groups) {
+				return groups[i]
+			}
+		}
+		return ph
+	})
+	// target paths split team and channel on "/"
+	out = strings.TrimSpace(strings.ReplaceAll(out, "/", "-"))
+	if out == "" {
+		out = ch.ZoomChannelID
+	}
+	return out
+}
+
+// PreviewRow is the target of one discovered channel.
+type PreviewRow struct {
+	ZoomChannelID string `json:"zoom_channel_id"`
+	Name          string `json:"name"`
+	Target
+	// Conflict names another Zoom channel mapped to the same team and
+	// channel; both would be merged into one Teams channel.
+	Conflict string `json:"conflict,omitempty"`
+}
+
+// Preview maps every channel and flags channels that land in the same Teams
+// channel.
+func (m *Mapper) Preview(channels []model.DiscoveredChannel) []PreviewRow {
+	rows := make([]PreviewRow, 0, len(channels))
+	first := make(map[string]int)
+	for i := range channels {
+		ch := &channels[i]
+		row := PreviewRow{ZoomChannelID: ch.ZoomChannelID, Name: ch.Name, Target: m.Map(ch)}
+		key := strings.ToLower(row.Team + "/" + row.Channel)
+		if j, dup := first[key]; dup {
+			row.Conflict = rows[j].ZoomChannelID
+			if rows[j].Conflict == "" {
+				rows[j].Conflict = ch.ZoomChannelID
+			}
+		} else {
+			first[key] = len(rows)
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
@@ -0,0 +1,71 @@
+package mapping
+
+import (
+	"testing"
+
+	migmodel "example.com/go-migrator/internal/migrator/model"
+	"example.com/go-migrator/internal/model"
+)
+
+func TestMap_RulesAndDefaults(t *testing.T) {
+	m, err := Compile([]model.MappingRule{
+		{Match: `^sales-(?P<region>\w+)$`, Team: "Sales", Channel: "{region}"},
+		{Match: `^eng-(\w+)-(\w+)$`, Team: "Engineering {1}", Channel: "{2}", ChannelType: "shared"},
+	})
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	cases := []struct {
+		ch   model.DiscoveredChannel
+		want Target
+	}{
+		{
+			model.DiscoveredChannel{ZoomChannelID: "c1", Name: "sales-emea", Type: migmodel.ZoomChannelPublic},
+			Target{Team: "Sales", Channel: "emea", TeamType: migmodel.TeamPublic, ChannelType: migmodel.ChannelStandard, Rule: 0},
+		},
+		{
+			model.DiscoveredChannel{ZoomChannelID: "c2", Name: "sales-apac", Type: migmodel.ZoomChannelPrivate},
+			Target{Team: "Sales", Channel: "apac", TeamType: migmodel.TeamPublic, ChannelType: migmodel.ChannelPrivate, Rule: 0},
+		},
+		{
+			model.DiscoveredChannel{ZoomChannelID: "c3", Name: "eng-core-api", Type: migmodel.ZoomChannelPrivate},
+			Target{Team: "Engineering core", Channel: "api", TeamType: migmodel.TeamPublic, ChannelType: migmodel.ChannelShared, Rule: 1},
+		},
+		{
+			model.DiscoveredChannel{ZoomChannelID: "c4", Name: "Random/Fun", Type: migmodel.ZoomChannelPrivateInternal},
+			Target{Team: "Random-Fun", Channel: "Random-Fun", TeamType: migmodel.TeamPublic, ChannelType: migmodel.ChannelPrivate, Rule: -1},
+		},
+	}
+	for _, tc := range cases {
+		if got := m.Map(&tc.ch); got != tc.want {
+			t.Errorf("%s: want %+v got %+v", tc.ch.Name, tc.want, got)
+		}
+	}
+}
+
+func TestCompile_RejectsUnknownPlaceholders(t *testing.T) {
+	if _, err := Compile([]model.MappingRule{{Match: `^(\w+)$`, Team: "{2}"}}); err == nil {
+		t.Fatal("expected error for missing capture group")
+	}
+	if _, err := Compile([]model.MappingRule{{Team: "{region}"}}); err == nil {
+		t.Fatal("expected error for unknown named group")
+	}
+	if _, err := Compile([]model.MappingRule{{Match: "("}}); err == nil {
+		t.Fatal("expected error for invalid regex")
+	}
+}
+
+func TestPreview_FlagsConflicts(t *testing.T) {
+	m, err := Compile([]model.MappingRule{{Match: "^team-", Team: "All", Channel: "General"}})
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	rows := m.Preview([]model.DiscoveredChannel{
+		{ZoomChannelID: "c1", Name: "team-a"},
+		{ZoomChannelID: "c2", Name: "team-b"},
+		{ZoomChannelID: "c3", Name: "other"},
+	})
+	if rows[0].Conflict != "c2" || rows[1].Conflict != "c1" || rows[2].Conflict != "" {
+		t.Fatalf("unexpected conflicts: %+v", rows)
+	}
+}
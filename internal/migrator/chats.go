@@ -0,0 +1,116 @@
+package migrator
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	migmodel "example.com/go-migrator/internal/migrator/model"
+	"example.com/go-migrator/internal/model"
+	"example.com/go-migrator/internal/store"
+)
+
+// members returns the participants of the job's conversation: the channel or
+// group chat members, or the user and the contact of a 1:1 chat.
+func (o *Orchestrator) members(job Job) ([]migmodel.ZoomChannelMember, error) {
+	if job.Source != model.SourceContact {
+		members, err := o.Source.FetchChannelMembers(job.ZoomUserID, job.ZoomChannelID)
+		if err != nil {
+			return nil, fmt.Errorf("fetch channel members: %w", err)
+		}
+		return members, nil
+	}
+	var members []migmodel.ZoomChannelMember
+	for _, id := range []string{job.ZoomUserID, job.ZoomContactID} {
+		u, err := o.Source.GetUser(id)
+		if err != nil {
+			return nil, fmt.Errorf("fetch chat participant %s: %w", id, err)
+		}
+		members = append(members, migmodel.ZoomChannelMember{ID: u.ID, Email: u.Email, Name: u.DisplayName})
+	}
+	return members, nil
+}
+
+// chatMembers resolves the participants of a chat to Teams users through the
+// project's identity mappings. A chat cannot be given members later, so the
+// participants of the account without a mapping fail the task under the fail
+// policy; under the fallback policies the fallback account joins the chat in
+// their place. External participants without a mapping are left out.
+func chatMembers(job Job, members []migmodel.ZoomChannelMember, stm *store.StoreManager) ([]string, error) {
+	var ids, missing, invalid []string
+	seen := map[string]bool{}
+	for _, m := range members {
+		var identity *model.Identity
+		var err error
+		if m.ID != "" {
+			identity, err = stm.Identity.Resolve(job.ProjectID, m.ID)
+		}
+		if err != nil && err != store.ErrNotFound {
+			return nil, fmt.Errorf("resolve chat participant %s: %w", m.ID, err)
+		}
+		if m.ID == "" || err != nil {
+			if m.IsExternal {
+				log.Printf("migrator: external chat participant %s has no identity mapping and is left out", m.Email)
+				continue
+			}
+			who := m.ID
+			if who == "" {
+				who = m.Email
+			}
+			missing = append(missing, who)
+			continue
+		}
+		if identity.ValidationStatus != model.IdentityValid || identity.TeamsUserID == "" {
+			invalid = append(invalid, invalidMapping(identity))
+			continue
+		}
+		if !seen[identity.TeamsUserID] {
+			seen[identity.TeamsUserID] = true
+			ids = append(ids, identity.TeamsUserID)
+		}
+	}
+	if err := invalidMappings(invalid); err != nil {
+		return nil, err
+	}
+	if len(missing) > 0 {
+		switch job.UnmappedPolicy {
+		case model.UnmappedFallback, model.UnmappedFallbackAttributed:
+			if job.FallbackUserID == "" {
+				return nil, fmt.Errorf("%d chat participants have no identity mapping and no fallback account is configured: %s", len(missing), strings.Join(missing, ", "))
+			}
+			log.Printf("migrator: chat participants %s have no identity mapping; the fallback account joins in their place", strings.Join(missing, ", "))
+			if !seen[job.FallbackUserID] {
+				ids = append(ids, job.FallbackUserID)
+			}
+		default:
+			return nil, fmt.Errorf("%d chat participants have no identity mapping: %s", len(missing), strings.Join(missing, ", "))
+		}
+	}
+	if job.Source == model.SourceContact && len(ids) != 2 {
+		return nil, fmt.Errorf("1:1 chat participants map to %d Teams users, want 2", len(ids))
+	}
+	return ids, nil
+}
+
+// ensureChat creates the job's Teams chat with the resolved participants and
+// records it on the task.
+func (o *Orchestrator) ensureChat(job Job, members []migmodel.ZoomChannelMember, stm *store.StoreManager) (string, error) {
+	ids, err := chatMembers(job, members, stm)
+	if err != nil {
+		return "", err
+	}
+	chatType, topic := migmodel.ChatGroup, job.ChatTopic
+	if job.Source == model.SourceContact {
+		chatType, topic = migmodel.ChatOneOnOne, ""
+	}
+	chatID, err := o.Dest.CreateChat(chatType, topic, ids)
+	if err != nil {
+		return "", fmt.Errorf("create chat: %w", err)
+	}
+	if job.TaskID != "" {
+		if err := stm.Task.SetTarget(job.TaskID, "", chatID); err != nil {
+			return "", fmt.Errorf("record target: %w", err)
+		}
+	}
+	return chatID, nil
+}
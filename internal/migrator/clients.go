@@ -0,0 +1,69 @@
+package migrator
+
+import (
+	"fmt"
+
+	teamdest "example.com/go-migrator/internal/migrator/dest/teams"
+	zoomsrc "example.com/go-migrator/internal/migrator/source/zoom"
+	"example.com/go-migrator/internal/model"
+	"example.com/go-migrator/internal/store"
+)
+
+// SourceClient builds the Zoom client for a source connector. An empty
+// connectorID falls back to the ZOOM_* environment variables, for tasks
+// that do not belong to a project. Only the default tenant and the system
+// scope may use them; other tenants must configure a connector.
+func SourceClient(stm *store.StoreManager, connectorID string) (*zoomsrc.Client, error) {
+	if connectorID == "" {
+		if err := envCredentialsAllowed(stm, "source"); err != nil {
+			return nil, err
+		}
+		return zoomsrc.NewClientFromEnv()
+	}
+	conn, err := stm.Connector.GetByID(connectorID)
+	if err != nil {
+		return nil, fmt.Errorf("load connector %s: %w", connectorID, err)
+	}
+	return zoomsrc.NewClientFromConnector(conn)
+}
+
+// DestClient builds the Teams client for a target connector. An empty
+// connectorID falls back to the TEAMS_* environment variables, with the same
+// restriction as SourceClient.
+func DestClient(stm *store.StoreManager, connectorID string) (*teamdest.Client, error) {
+	if connectorID == "" {
+		if err := envCredentialsAllowed(stm, "target"); err != nil {
+			return nil, err
+		}
+		return teamdest.NewClientFromEnv()
+	}
+	conn, err := stm.Connector.GetByID(connectorID)
+	if err != nil {
+		return nil, fmt.Errorf("load connector %s: %w", connectorID, err)
+	}
+	return teamdest.NewClientFromConnector(conn)
+}
+
+// envCredentialsAllowed fails for tenants other than the default one: the
+// environment credentials belong to the operator's own accounts.
+func envCredentialsAllowed(stm *store.StoreManager, role string) error {
+	if t := stm.TenantID(); t != "" && t != store.DefaultTenantID() {
+		return fmt.Errorf("tenant %s has no %s connector configured", t, role)
+	}
+	return nil
+}
+
+// CheckConnector verifies that a connector's Data holds the credentials its
+// type needs, without contacting the provider.
+func CheckConnector(conn *model.Connector) error {
+	var err error
+	switch conn.Type {
+	case model.Zoom:
+		_, err = zoomsrc.ParseCredentials(conn)
+	case model.Teams:
+		_, err = teamdest.ParseCredentials(conn)
+	default:
+		err = fmt.Errorf("unknown connector type %q", conn.Type)
+	}
+	return err
+}
@@ -0,0 +1,23 @@
+package migrator
+
+import (
+	"strings"
+	"testing"
+
+	"example.com/go-migrator/internal/store"
+)
+
+func TestClients_TenantsNeedConnectors(t *testing.T) {
+	stm := store.NewStoreManager(nil, nil).ForTenant("acme")
+	if _, err := SourceClient(stm, ""); err == nil || !strings.Contains(err.Error(), "no source connector") {
+		t.Fatalf("expected the env fallback refused for tenant acme, got %v", err)
+	}
+	if _, err := DestClient(stm, ""); err == nil || !strings.Contains(err.Error(), "no target connector") {
+		t.Fatalf("expected the env fallback refused for tenant acme, got %v", err)
+	}
+	for _, stm := range []*store.StoreManager{store.NewStoreManager(nil, nil), store.NewStoreManager(nil, nil).ForTenant(store.DefaultTenantID())} {
+		if err := envCredentialsAllowed(stm, "source"); err != nil {
+			t.Fatalf("expected the env fallback allowed for %q, got %v", stm.TenantID(), err)
+		}
+	}
+}
@@ -2,6 +2,9 @@ package teams
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -13,19 +16,89 @@ import (
 	"time"
 
 	migmodel "example.com/go-migrator/internal/migrator/model"
+	"example.com/go-migrator/internal/migrator/oauth"
+	"example.com/go-migrator/internal/model"
 )
 
 const defaultCreatedDateTime = "2010-01-01T00:00:00.000Z"
 
 type Client struct {
-	token string
+	tokens *oauth.Source
 }
 
+// Credentials are the app registration used to call Graph in a Microsoft 365
+// tenant. They are the JSON Data of a teams Connector.
+type Credentials struct {
+	TenantID     string `json:"tenant_id"`
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+}
+
+// Validate reports the first missing credential.
+func (c Credentials) Validate() error {
+	if c.TenantID == "" {
+		return fmt.Errorf("tenant_id not set")
+	}
+	if c.ClientID == "" {
+		return fmt.Errorf("client_id not set")
+	}
+	if c.ClientSecret == "" {
+		return fmt.Errorf("client_secret not set")
+	}
+	return nil
+}
+
+// ParseCredentials reads the credentials stored in a teams Connector.
+func ParseCredentials(conn *model.Connector) (Credentials, error) {
+	var creds Credentials
+	if conn.Type != model.Teams {
+		return creds, fmt.Errorf("connector %s is a %s connector, not teams", conn.ID, conn.Type)
+	}
+	if err := json.Unmarshal([]byte(conn.Data), &creds); err != nil {
+		return creds, fmt.Errorf("connector %s: invalid credentials: %w", conn.ID, err)
+	}
+	if err := creds.Validate(); err != nil {
+		return creds, fmt.Errorf("connector %s: %w", conn.ID, err)
+	}
+	return creds, nil
+}
+
+// NewClientFromConnector obtains a Graph token for the tenant of a teams
+// Connector.
+func NewClientFromConnector(conn *model.Connector) (*Client, error) {
+	creds, err := ParseCredentials(conn)
+	if err != nil {
+		return nil, err
+	}
+	return NewClient(creds)
+}
+
+// NewClientFromEnv obtains a Graph token for the app configured by
+// TEAMS_TENANT_ID, TEAMS_CLIENT_ID and TEAMS_CLIENT_SECRET.
 func NewClientFromEnv() (*Client, error) {
-	tenantID := os.Getenv("TEAMS_TENANT_ID")
-	clientID := os.Getenv("TEAMS_CLIENT_ID")
-	clientSecret := os.Getenv("TEAMS_CLIENT_SECRET")
+	return NewClient(Credentials{
+		TenantID:     os.Getenv("TEAMS_TENANT_ID"),
+		ClientID:     os.Getenv("TEAMS_CLIENT_ID"),
+		ClientSecret: os.Getenv("TEAMS_CLIENT_SECRET"),
+	})
+}
 
+// NewClient creates a Graph client for creds using the client credentials
+// flow. Clients built from the same credentials share one token, which is
+// refreshed before it expires. The first token is obtained right away so bad
+// credentials fail here.
+func NewClient(creds Credentials) (*Client, error) {
+	sum := sha256.Sum256([]byte(creds.TenantID + "\x00" + creds.ClientID + "\x00" + creds.ClientSecret))
+	tokens := oauth.Shared("teams:"+hex.EncodeToString(sum[:]), func() (*oauth.Token, error) { return fetchToken(creds) })
+	if _, err := tokens.Token(); err != nil {
+		return nil, err
+	}
+	return &Client{tokens: tokens}, nil
+}
+
+// fetchToken requests a Graph token for creds.
+func fetchToken(creds Credentials) (*oauth.Token, error) {
+	tenantID, clientID, clientSecret := creds.TenantID, creds.ClientID, creds.ClientSecret
 	tokenURL := fmt.Sprintf("https://login.microsoftonline.com/%s/oauth2/v2.0/token", tenantID)
 
 	data := url.Values{}
@@ -52,13 +125,48 @@ func NewClientFromEnv() (*Client, error) {
 		return nil, fmt.Errorf("failed to obtain token: %s", resp.Status)
 	}
 
-	var result map[string]interface{}
+	var result struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
 	if err := json.Unmarshal(body, &result); err != nil {
 		return nil, err
 	}
+	if result.AccessToken == "" {
+		return nil, fmt.Errorf("token response has no access_token")
+	}
+
+	log.Printf("teams: obtained token (len=%d, expires in %ds)", len(result.AccessToken), result.ExpiresIn)
+	tok := &oauth.Token{AccessToken: result.AccessToken}
+	if result.ExpiresIn > 0 {
+		tok.Expiry = time.Now().Add(time.Duration(result.ExpiresIn) * time.Second)
+	}
+	return tok, nil
+}
 
-	log.Printf("teams: obtained token (len=%d)", len(result["access_token"].(string)))
-	return &Client{token: result["access_token"].(string)}, nil
+// Roles returns the application permissions granted to the client's
+// credentials, read from the "roles" claim of a new Graph access token, so
+// permissions granted since the cached token was issued are included.
+func (c *Client) Roles() ([]string, error) {
+	tok, err := c.tokens.Refresh()
+	if err != nil {
+		return nil, err
+	}
+	parts := strings.Split(tok.AccessToken, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("access token is not a JWT")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("decode access token: %w", err)
+	}
+	var claims struct {
+		Roles []string `json:"roles"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("decode access token claims: %w", err)
+	}
+	return claims.Roles, nil
 }
 
 func (c *Client) EnsureTeam(name string, t migmodel.TeamType) (string, error) {
@@ -82,10 +190,9 @@ func (c *Client) EnsureTeam(name string, t migmodel.TeamType) (string, error) {
 	}
 	b, _ := json.Marshal(payload)
 	req, _ := http.NewRequest("POST", url, bytes.NewReader(b))
-	req.Header.Set("Authorization", "Bearer "+c.token)
 	req.Header.Set("Content-Type", "application/json")
 	log.Printf("teams: POST %s (create team %q)", url, name)
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := c.tokens.Do(req)
 	if err != nil {
 		return "", err
 	}
@@ -120,9 +227,8 @@ func (c *Client) EnsureTeam(name string, t migmodel.TeamType) (string, error) {
 				return "", fmt.Errorf("timed out waiting for team creation")
 			case <-ticker.C:
 				reqOp, _ := http.NewRequest("GET", loc, nil)
-				reqOp.Header.Set("Authorization", "Bearer "+c.token)
 				log.Printf("teams: polling operation %s", loc)
-				respOp, err := http.DefaultClient.Do(reqOp)
+				respOp, err := c.tokens.Do(reqOp)
 				if err != nil {
 					// continue polling on transient errors
 					continue
@@ -207,10 +313,9 @@ func (c *Client) EnsureChannel(teamID, name string, chType migmodel.ChannelType)
 	}
 	b, _ := json.Marshal(payload)
 	req, _ := http.NewRequest("POST", url, bytes.NewReader(b))
-	req.Header.Set("Authorization", "Bearer "+c.token)
 	req.Header.Set("Content-Type", "application/json")
 	log.Printf("teams: POST %s (create channel %q)", url, name)
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := c.tokens.Do(req)
 	if err != nil {
 		return "", err
 	}
@@ -229,16 +334,26 @@ func (c *Client) EnsureChannel(teamID, name string, chType migmodel.ChannelType)
 	return out.ID, nil
 }
 
-func (c *Client) PostMessage(teamID, channelID string, tm migmodel.TeamsMessageRequest) error {
+// PostMessage imports a message into a channel and returns its Teams message ID.
+func (c *Client) PostMessage(teamID, channelID string, tm migmodel.TeamsMessageRequest) (string, error) {
 	url := fmt.Sprintf("https://graph.microsoft.com/v1.0/teams/%s/channels/%s/messages", teamID, channelID)
+	return c.importMessage(url, tm)
+}
 
+// PostReply imports a reply to the channel message parentID and returns its
+// Teams message ID.
+func (c *Client) PostReply(teamID, channelID, parentID string, tm migmodel.TeamsMessageRequest) (string, error) {
+	url := fmt.Sprintf("https://graph.microsoft.com/v1.0/teams/%s/channels/%s/messages/%s/replies", teamID, channelID, parentID)
+	return c.importMessage(url, tm)
+}
+
+func (c *Client) importMessage(url string, tm migmodel.TeamsMessageRequest) (string, error) {
 	b, _ := json.Marshal(tm)
 	req, _ := http.NewRequest("POST", url, bytes.NewReader(b))
-	req.Header.Set("Authorization", "Bearer "+c.token)
 	req.Header.Set("Content-Type", "application/json")
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := c.tokens.Do(req)
 	if err != nil {
-		return err
+		return "", err
 	}
 	defer resp.Body.Close()
 
@@ -246,9 +361,14 @@ func (c *Client) PostMessage(teamID, channelID string, tm migmodel.TeamsMessageR
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
 		body, _ := io.ReadAll(resp.Body)
 		log.Printf("teams: import message failed %s: %s", resp.Status, string(body))
-		return fmt.Errorf("graph import message error: %s: %s", resp.Status, string(body))
+		return "", fmt.Errorf("graph import message error: %s: %s", resp.Status, string(body))
 	}
-	return nil
+	var out struct {
+		ID string `json:"id"`
+	}
+	// 202 responses carry no body; the message ID is then unknown
+	_ = json.NewDecoder(resp.Body).Decode(&out)
+	return out.ID, nil
 }
 
 func (c *Client) AddMemberToTeam(teamID, userID string, owner bool) error {
@@ -257,9 +377,8 @@ func (c *Client) AddMemberToTeam(teamID, userID string, owner bool) error {
 	member := NewTeamsGraphMember(userID, owner)
 	b, _ := json.Marshal(member)
 	req, _ := http.NewRequest("POST", url, bytes.NewReader(b))
-	req.Header.Set("Authorization", "Bearer "+c.token)
 	req.Header.Set("Content-Type", "application/json")
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := c.tokens.Do(req)
 	if err != nil {
 		return err
 	}
@@ -278,9 +397,8 @@ func (c *Client) CompleteMigrationChannel(teamID, channelID string) error {
 	url := fmt.Sprintf("https://graph.microsoft.com/v1.0/teams/%s/channels/%s/completeMigration", teamID, channelID)
 
 	req, _ := http.NewRequest("POST", url, nil)
-	req.Header.Set("Authorization", "Bearer "+c.token)
 	req.Header.Set("Content-Type", "application/json")
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := c.tokens.Do(req)
 	if err != nil {
 		return err
 	}
@@ -299,9 +417,8 @@ func (c *Client) CompleteMigrationTeam(teamID string) error {
 	url := fmt.Sprintf("https://graph.microsoft.com/v1.0/teams/%s/completeMigration", teamID)
 
 	req, _ := http.NewRequest("POST", url, nil)
-	req.Header.Set("Authorization", "Bearer "+c.token)
 	req.Header.Set("Content-Type", "application/json")
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := c.tokens.Do(req)
 	if err != nil {
 		return err
 	}
@@ -316,13 +433,92 @@ func (c *Client) CompleteMigrationTeam(teamID string) error {
 	return nil
 }
 
+// chatImportBase is the Graph endpoint for chat imports, which are only
+// available in beta.
+const chatImportBase = "https://graph.microsoft.com/beta"
+
+// CreateChat creates a chat in migration mode with the given members, all of
+// them owners, and returns its ID. Until CompleteMigrationChat is called the
+// chat accepts imported messages and is hidden from its members.
+func (c *Client) CreateChat(t migmodel.ChatType, topic string, memberIDs []string) (string, error) {
+	url := chatImportBase + "/chats"
+
+	members := make([]map[string]any, 0, len(memberIDs))
+	for _, id := range memberIDs {
+		members = append(members, map[string]any{
+			"@odata.type":     "#microsoft.graph.aadUserConversationMember",
+			"roles":           []string{"owner"},
+			"user@odata.bind": fmt.Sprintf("%s/users('%s')", chatImportBase, id),
+		})
+	}
+	payload := map[string]any{
+		"@microsoft.graph.chatCreationMode": "migration",
+		"chatType":                          string(t),
+		"members":                           members,
+		"createdDateTime":                   defaultCreatedDateTime,
+	}
+	if topic != "" {
+		payload["topic"] = topic
+	}
+	b, _ := json.Marshal(payload)
+	req, _ := http.NewRequest("POST", url, bytes.NewReader(b))
+	req.Header.Set("Content-Type", "application/json")
+	log.Printf("teams: POST %s (create %s chat with %d members)", url, t, len(memberIDs))
+	resp, err := c.tokens.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(resp.Body)
+		log.Printf("teams: create chat failed %s: %s", resp.Status, string(body))
+		return "", fmt.Errorf("graph create chat error: %s: %s", resp.Status, string(body))
+	}
+	var out struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", err
+	}
+	if out.ID == "" {
+		return "", fmt.Errorf("graph create chat returned no id")
+	}
+	return out.ID, nil
+}
+
+// PostChatMessage imports a message into a chat and returns its Teams
+// message ID.
+func (c *Client) PostChatMessage(chatID string, tm migmodel.TeamsMessageRequest) (string, error) {
+	url := fmt.Sprintf("%s/chats/%s/messages", chatImportBase, chatID)
+	return c.importMessage(url, tm)
+}
+
+func (c *Client) CompleteMigrationChat(chatID string) error {
+	url := fmt.Sprintf("%s/chats/%s/completeMigration", chatImportBase, chatID)
+
+	req, _ := http.NewRequest("POST", url, nil)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.tokens.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(resp.Body)
+		log.Printf("teams: complete migration chat failed %s: %s", resp.Status, string(body))
+		return fmt.Errorf("graph complete migration chat error: %s: %s", resp.Status, string(body))
+	}
+	log.Printf("teams: completed migration for chat %s", chatID)
+	return nil
+}
+
 func (c *Client) ListChannels(teamID string) ([]migmodel.TeamsChannel, error) {
 	url := fmt.Sprintf("https://graph.microsoft.com/v1.0/teams/%s/channels", teamID)
 
 	req, _ := http.NewRequest("GET", url, nil)
-	req.Header.Set("Authorization", "Bearer "+c.token)
 	req.Header.Set("Content-Type", "application/json")
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := c.tokens.Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -343,6 +539,62 @@ func (c *Client) ListChannels(teamID string) ([]migmodel.TeamsChannel, error) {
 	return channels, nil
 }
 
+// GetUser looks up a user by object ID or user principal name.
+func (c *Client) GetUser(idOrUPN string) (*migmodel.EntraUser, error) {
+	u := fmt.Sprintf("https://graph.microsoft.com/v1.0/users/%s?$select=id,displayName,mail,userPrincipalName,accountEnabled", url.PathEscape(idOrUPN))
+
+	req, _ := http.NewRequest("GET", u, nil)
+	resp, err := c.tokens.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, migmodel.ErrUserNotFound
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(resp.Body)
+		log.Printf("teams: get user failed %s: %s", resp.Status, string(body))
+		return nil, fmt.Errorf("graph get user error: %s: %s", resp.Status, string(body))
+	}
+	var user migmodel.EntraUser
+	if err := json.NewDecoder(resp.Body).Decode(&user); err != nil {
+		return nil, fmt.Errorf("decode user response: %w", err)
+	}
+	return &user, nil
+}
+
+// ListUsers returns every user of the tenant, following Graph paging.
+func (c *Client) ListUsers() ([]migmodel.EntraUser, error) {
+	url := "https://graph.microsoft.com/v1.0/users?$top=999&$select=id,displayName,mail,userPrincipalName,proxyAddresses,otherMails,accountEnabled"
+
+	var users []migmodel.EntraUser
+	for url != "" {
+		req, _ := http.NewRequest("GET", url, nil)
+		resp, err := c.tokens.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			log.Printf("teams: list users failed %s: %s", resp.Status, string(body))
+			return nil, fmt.Errorf("graph list users error: %s: %s", resp.Status, string(body))
+		}
+		var page migmodel.EntraUserListResponse
+		err = json.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("decode users response: %w", err)
+		}
+		users = append(users, page.Value...)
+		url = page.NextLink
+	}
+	log.Printf("teams: listed %d users", len(users))
+	return users, nil
+}
+
 func NewTeamsGraphMember(userID string, owner bool) *migmodel.TeamsGraphMember {
 	var roles []string
 	if owner {
@@ -0,0 +1,241 @@
+package migrator
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	migmodel "example.com/go-migrator/internal/migrator/model"
+	"example.com/go-migrator/internal/model"
+	"example.com/go-migrator/internal/store"
+)
+
+// TeamFinalizer ends migration mode on Teams channels, teams and chats.
+type TeamFinalizer interface {
+	ListChannels(teamID string) ([]migmodel.TeamsChannel, error)
+	CompleteMigrationChannel(teamID, channelID string) error
+	CompleteMigrationTeam(teamID string) error
+	CompleteMigrationChat(chatID string) error
+}
+
+// FinalizeSummary is the outcome of a finalize run, one record per team.
+type FinalizeSummary struct {
+	Teams     []model.TeamFinalization `json:"teams"`
+	Completed int                      `json:"completed"`
+	Failed    int                      `json:"failed"`
+}
+
+// finalizeLease is how long a finalize run holds the project without
+// renewing its lock. Runs renew it before each team, so a run that died keeps
+// others out for no longer than this.
+const finalizeLease = 15 * time.Minute
+
+// FinalizeLock is a finalize run's hold on a project. It is kept in the
+// database, so runs from API servers and the CLI exclude one another.
+type FinalizeLock struct {
+	projects  store.ProjectStoreInterface
+	projectID string
+	holder    string
+}
+
+// LockFinalize takes the project's finalize lock. It fails with
+// store.ErrFinalizeLocked while another run holds it.
+func LockFinalize(stm *store.StoreManager, project *model.Project) (*FinalizeLock, error) {
+	l := &FinalizeLock{projects: stm.Project, projectID: project.ID, holder: uuid.NewString()}
+	if err := l.renew(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *FinalizeLock) renew() error {
+	now := time.Now()
+	return l.projects.LockFinalize(l.projectID, l.holder, now, now.Add(finalizeLease))
+}
+
+// Unlock releases the lock.
+func (l *FinalizeLock) Unlock() error {
+	return l.projects.UnlockFinalize(l.projectID, l.holder)
+}
+
+// FinalizeBlocker returns why the project cannot be finalized yet, or "" if
+// it can. Finalizing is possible once migration has started and no task is
+// pending or running, since completed channels accept no more imports.
+func FinalizeBlocker(stm *store.StoreManager, project *model.Project) (string, error) {
+	_, reason, err := finalizeTasks(stm, project)
+	return reason, err
+}
+
+func finalizeTasks(stm *store.StoreManager, project *model.Project) ([]model.Task, string, error) {
+	if project.State != model.ProjectFinalizing && !project.State.CanTransition(model.ProjectFinalizing) {
+		return nil, fmt.Sprintf("project is %s and cannot be finalized", project.State), nil
+	}
+	tasks, err := stm.Task.ListByProject(project.ID, "")
+	if err != nil {
+		return nil, "", fmt.Errorf("list tasks: %w", err)
+	}
+	for _, t := range tasks {
+		if t.Status.Active() {
+			return nil, fmt.Sprintf("task %s is still %s", t.ID, t.Status), nil
+		}
+	}
+	return tasks, "", nil
+}
+
+// FinalizeProject ends migration mode for every team and chat the project's
+// tasks created: each channel is completed, then the team. A failure is recorded
+// on its team and the run carries on with the next one. Completed teams are
+// skipped and completed channels are not retried, so the run can be
+// repeated until every team succeeds. The project ends up completed if every
+// team did, and failed otherwise. The caller must hold lock, which the run
+// renews as it goes.
+func FinalizeProject(dst TeamFinalizer, stm *store.StoreManager, project *model.Project, lock *FinalizeLock) (*FinalizeSummary, error) {
+	tasks, reason, err := finalizeTasks(stm, project)
+	if err != nil {
+		return nil, err
+	}
+	if reason != "" {
+		return nil, fmt.Errorf("%s", reason)
+	}
+	if err := setProjectState(stm, project, model.ProjectFinalizing); err != nil {
+		return nil, err
+	}
+
+	recs, err := stm.Finalization.List(project.ID)
+	if err != nil {
+		return nil, fmt.Errorf("list finalization records: %w", err)
+	}
+	byTeam := make(map[string]*model.TeamFinalization, len(recs))
+	for i := range recs {
+		byTeam[recs[i].TeamsTeamID] = &recs[i]
+	}
+
+	summary := &FinalizeSummary{}
+	teams := projectTeams(tasks)
+	for i := range teams {
+		rec, ok := byTeam[teams[i].TeamsTeamID]
+		if !ok {
+			rec = &teams[i]
+		}
+		if rec.Status != model.FinalizationCompleted {
+			if err := lock.renew(); err != nil {
+				return summary, fmt.Errorf("renew finalize lock: %w", err)
+			}
+			finalizeTeam(dst, rec, time.Now())
+			rec.Attempts++
+			if err := stm.Finalization.Save(rec); err != nil {
+				return summary, fmt.Errorf("record finalization of team %s: %w", rec.TeamsTeamID, err)
+			}
+		}
+		if rec.Status == model.FinalizationCompleted {
+			summary.Completed++
+		} else {
+			summary.Failed++
+			log.Printf("finalize: project %s: team %s: %s", project.ID, rec.TeamsTeamID, rec.Error)
+		}
+		summary.Teams = append(summary.Teams, *rec)
+	}
+
+	final := model.ProjectCompleted
+	if summary.Failed > 0 {
+		final = model.ProjectFailed
+	}
+	return summary, setProjectState(stm, project, final)
+}
+
+// projectTeams returns the Teams teams the tasks created, ordered by name,
+// followed by the chats they created.
+func projectTeams(tasks []model.Task) []model.TeamFinalization {
+	seen := map[string]bool{}
+	var teams, chats []model.TeamFinalization
+	for _, t := range tasks {
+		kind, _, _, _ := t.ParseSource()
+		if kind.Chat() {
+			if t.TeamsChannelID == "" || seen[t.TeamsChannelID] {
+				continue
+			}
+			seen[t.TeamsChannelID] = true
+			name := t.TargetPath
+			if name == "" {
+				// 1:1 chats have no topic
+				name = t.SourcePath
+			}
+			chats = append(chats, model.TeamFinalization{ProjectID: t.ProjectID, TeamsTeamID: t.TeamsChannelID, TeamName: name, Chat: true})
+			continue
+		}
+		if t.TeamsTeamID == "" || seen[t.TeamsTeamID] {
+			continue
+		}
+		seen[t.TeamsTeamID] = true
+		name, _, _ := t.Target()
+		teams = append(teams, model.TeamFinalization{ProjectID: t.ProjectID, TeamsTeamID: t.TeamsTeamID, TeamName: name})
+	}
+	sort.Slice(teams, func(i, j int) bool { return teams[i].TeamName < teams[j].TeamName })
+	return append(teams, chats...)
+}
+
+// finalizeTeam completes the team's channels that are not completed yet and
+// then the team, recording the outcome on rec. A channel failure does not
+// stop the other channels, but leaves the team in migration mode. Chats are
+// completed in one call.
+func finalizeTeam(dst TeamFinalizer, rec *model.TeamFinalization, now time.Time) {
+	rec.Status = model.FinalizationFailed
+	if rec.Chat {
+		if err := dst.CompleteMigrationChat(rec.TeamsTeamID); err != nil {
+			rec.Error = fmt.Sprintf("chat: %v", err)
+			return
+		}
+		rec.Status = model.FinalizationCompleted
+		rec.Error = ""
+		rec.FinalizedAt = &now
+		return
+	}
+	channels, err := dst.ListChannels(rec.TeamsTeamID)
+	if err != nil {
+		rec.Error = fmt.Sprintf("list channels: %v", err)
+		return
+	}
+	done := make(map[string]bool, len(rec.CompletedChannels))
+	for _, id := range rec.CompletedChannels {
+		done[id] = true
+	}
+	var errs []string
+	for _, ch := range channels {
+		if done[ch.ID] {
+			continue
+		}
+		if err := dst.CompleteMigrationChannel(rec.TeamsTeamID, ch.ID); err != nil {
+			errs = append(errs, fmt.Sprintf("channel %s: %v", ch.Name, err))
+			continue
+		}
+		rec.CompletedChannels = append(rec.CompletedChannels, ch.ID)
+	}
+	if len(errs) > 0 {
+		rec.Error = strings.Join(errs, "; ")
+		return
+	}
+	if err := dst.CompleteMigrationTeam(rec.TeamsTeamID); err != nil {
+		rec.Error = fmt.Sprintf("team: %v", err)
+		return
+	}
+	rec.Status = model.FinalizationCompleted
+	rec.Error = ""
+	rec.FinalizedAt = &now
+}
+
+// setProjectState moves the project to the given state unless it is there
+// already.
+func setProjectState(stm *store.StoreManager, project *model.Project, to model.ProjectState) error {
+	if project.State == to {
+		return nil
+	}
+	if err := stm.Project.SetState(project.ID, project.State, to, "", time.Time{}); err != nil {
+		return fmt.Errorf("project state %s to %s: %w", project.State, to, err)
+	}
+	project.State = to
+	return nil
+}
@@ -0,0 +1,95 @@
+package migrator
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	migmodel "example.com/go-migrator/internal/migrator/model"
+	"example.com/go-migrator/internal/model"
+)
+
+type fakeFinalizer struct {
+	channels  []migmodel.TeamsChannel
+	failing   map[string]bool
+	completed []string
+	team      bool
+	chats     []string
+}
+
+func (f *fakeFinalizer) ListChannels(teamID string) ([]migmodel.TeamsChannel, error) {
+	return f.channels, nil
+}
+
+func (f *fakeFinalizer) CompleteMigrationChannel(teamID, channelID string) error {
+	if f.failing[channelID] {
+		return errors.New("boom")
+	}
+	f.completed = append(f.completed, channelID)
+	return nil
+}
+
+func (f *fakeFinalizer) CompleteMigrationTeam(teamID string) error {
+	f.team = true
+	return nil
+}
+
+func (f *fakeFinalizer) CompleteMigrationChat(chatID string) error {
+	f.chats = append(f.chats, chatID)
+	return nil
+}
+
+func TestFinalizeTeam_ContinuesPastChannelFailures(t *testing.T) {
+	dst := &fakeFinalizer{
+		channels: []migmodel.TeamsChannel{{ID: "c1", Name: "General"}, {ID: "c2", Name: "sales"}, {ID: "c3", Name: "eng"}},
+		failing:  map[string]bool{"c2": true},
+	}
+	rec := &model.TeamFinalization{TeamsTeamID: "t1"}
+	finalizeTeam(dst, rec, time.Now())
+
+	if rec.Status != model.FinalizationFailed || rec.Error != "channel sales: boom" {
+		t.Fatalf("unexpected outcome: %s %q", rec.Status, rec.Error)
+	}
+	if !reflect.DeepEqual(rec.CompletedChannels, []string{"c1", "c3"}) || dst.team {
+		t.Fatalf("expected c1 and c3 completed and the team left open, got %v team=%v", rec.CompletedChannels, dst.team)
+	}
+
+	// a rerun only retries the failed channel, then completes the team
+	dst.failing = nil
+	dst.completed = nil
+	finalizeTeam(dst, rec, time.Now())
+	if rec.Status != model.FinalizationCompleted || rec.Error != "" || rec.FinalizedAt == nil {
+		t.Fatalf("unexpected outcome: %s %q", rec.Status, rec.Error)
+	}
+	if !reflect.DeepEqual(dst.completed, []string{"c2"}) || !dst.team {
+		t.Fatalf("expected only c2 retried and the team completed, got %v team=%v", dst.completed, dst.team)
+	}
+}
+
+func TestProjectTeams(t *testing.T) {
+	tasks := []model.Task{
+		{ProjectID: "p1", TargetPath: "Sales/emea", TeamsTeamID: "t2"},
+		{ProjectID: "p1", TargetPath: "Engineering/api", TeamsTeamID: "t1"},
+		{ProjectID: "p1", TargetPath: "Sales/apac", TeamsTeamID: "t2"},
+		{ProjectID: "p1", TargetPath: "Support/general"},
+		{ProjectID: "p1", SourcePath: "users/u1/contacts/u2", TeamsChannelID: "chat1"},
+		{ProjectID: "p1", SourcePath: "users/u1/groupchats/g1", TargetPath: "Launch crew"},
+	}
+	teams := projectTeams(tasks)
+	if len(teams) != 3 || teams[0].TeamsTeamID != "t1" || teams[1].TeamName != "Sales" {
+		t.Fatalf("unexpected teams: %+v", teams)
+	}
+	if chat := teams[2]; !chat.Chat || chat.TeamsTeamID != "chat1" || chat.TeamName != "users/u1/contacts/u2" {
+		t.Fatalf("expected the 1:1 chat last, got %+v", chat)
+	}
+}
+
+func TestFinalizeTeam_Chat(t *testing.T) {
+	dst := &fakeFinalizer{}
+	rec := &model.TeamFinalization{TeamsTeamID: "chat1", Chat: true}
+	finalizeTeam(dst, rec, time.Now())
+	if rec.Status != model.FinalizationCompleted || !reflect.DeepEqual(dst.chats, []string{"chat1"}) || dst.team {
+		t.Fatalf("expected only the chat completed, got %s chats=%v team=%v", rec.Status, dst.chats, dst.team)
+	}
+}
@@ -1,15 +1,30 @@
 package model
 
+import "errors"
+
+// ErrUserNotFound is returned by destination clients when a user does not
+// exist in the tenant.
+var ErrUserNotFound = errors.New("user not found")
+
 type ZoomUser struct {
 	ID          string `json:"id"`
 	DisplayName string `json:"name"`
 	Email       string `json:"email"`
 }
 
+// Zoom channel types as returned in ZoomChannel.Type.
+const (
+	ZoomChannelPrivate         = 1
+	ZoomChannelPrivateInternal = 2
+	ZoomChannelPublic          = 3
+	ZoomChannelGroupChat       = 4
+)
+
 type ZoomChannel struct {
 	ID          string `json:"id"`
 	JID         string `json:"jid"`
 	DisplayName string `json:"name"`
+	Type        int    `json:"type"`
 }
 
 type ZoomChannelMember struct {
@@ -50,6 +65,12 @@ type ZoomMessage struct {
 	MessageType       string     `json:"message_type"`
 	CustomEmoji       bool       `json:"custom_emoji"`
 	Files             []ZoomFile `json:"files,omitempty"`
+	// ReplyMainMessageID is set on thread replies to the ID of the message
+	// they reply to.
+	ReplyMainMessageID string `json:"reply_main_message_id,omitempty"`
+	// ReplyCount is the size of the message's thread; nil when Zoom did not
+	// say, in which case the thread has to be fetched to find out.
+	ReplyCount *int `json:"reply_count,omitempty"`
 	// Zoom sometimes includes top-level file fields duplicated for convenience
 	FileID      string `json:"file_id,omitempty"`
 	FileName    string `json:"file_name,omitempty"`
@@ -82,6 +103,14 @@ const (
 	ChannelShared   ChannelType = "shared"
 )
 
+// ChatType is the type of a Teams chat.
+type ChatType string
+
+const (
+	ChatOneOnOne ChatType = "oneOnOne"
+	ChatGroup    ChatType = "group"
+)
+
 // Teams models to mirror the Graph message shape used by Teams APIs.
 type TeamsUserIdentity struct {
 	ODataType        string `json:"@odata.type,omitempty"`
@@ -164,17 +193,62 @@ type TeamsChannelListResponse struct {
 	Value []TeamsChannel `json:"value"`
 }
 
+// EntraUser is a user of the destination tenant as returned by Graph /users.
+type EntraUser struct {
+	ID                string   `json:"id"`
+	DisplayName       string   `json:"displayName"`
+	Mail              string   `json:"mail"`
+	UserPrincipalName string   `json:"userPrincipalName"`
+	ProxyAddresses    []string `json:"proxyAddresses"`
+	OtherMails        []string `json:"otherMails"`
+	AccountEnabled    *bool    `json:"accountEnabled,omitempty"`
+}
+
+type EntraUserListResponse struct {
+	Value    []EntraUser `json:"value"`
+	NextLink string      `json:"@odata.nextLink"`
+}
+
+// Iterator walks a paginated list one item at a time, fetching pages as
+// needed. Next reports whether there is another item; Err returns the error
+// that ended the iteration early, if any.
+type Iterator[T any] interface {
+	Next() bool
+	Item() T
+	Err() error
+}
+
 // SourceClient fetches messages from a provider (Zoom, Slack...)
 type SourceClient interface {
 	GetUsers() ([]ZoomUser, error)
+	GetUser(userID string) (ZoomUser, error)
 	GetUserChannels(userID string) ([]ZoomChannel, error)
-	FetchMessages(userID string, channelID string) ([]ZoomMessage, error)
+	// FetchMessages returns the channel's messages sent at or after from, an
+	// RFC3339 timestamp; an empty from fetches the whole history.
+	FetchMessages(userID string, channelID string, from string) ([]ZoomMessage, error)
+	// IterateMessages streams the same messages as FetchMessages a page at
+	// a time.
+	IterateMessages(userID string, channelID string, from string) Iterator[ZoomMessage]
 	FetchChannelMembers(userID string, channelID string) ([]ZoomChannelMember, error)
+	// FetchReplies returns the replies in the thread of a channel message,
+	// oldest first.
+	FetchReplies(userID string, channelID string, messageID string) ([]ZoomMessage, error)
+	// IterateContactMessages streams the 1:1 messages between userID and a
+	// contact sent at or after from.
+	IterateContactMessages(userID string, contactID string, from string) Iterator[ZoomMessage]
+	// FetchContactReplies returns the replies in the thread of a 1:1
+	// message, oldest first.
+	FetchContactReplies(userID string, contactID string, messageID string) ([]ZoomMessage, error)
 }
 
 // DestinationClient posts messages and ensures destination resources.
 type DestinationClient interface {
 	EnsureTeam(name string, t TeamType) (teamID string, err error)
 	EnsureChannel(teamID, name string, c ChannelType) (channelID string, err error)
-	PostMessage(teamID, channelID string, m TeamsMessageRequest) error
+	PostMessage(teamID, channelID string, m TeamsMessageRequest) (messageID string, err error)
+	PostReply(teamID, channelID, parentID string, m TeamsMessageRequest) (messageID string, err error)
+	// CreateChat creates a chat between the given Teams users in migration
+	// mode. topic must be empty for 1:1 chats.
+	CreateChat(t ChatType, topic string, memberIDs []string) (chatID string, err error)
+	PostChatMessage(chatID string, m TeamsMessageRequest) (messageID string, err error)
 }
@@ -0,0 +1,168 @@
+// Package oauth caches provider access tokens and refreshes them before they
+// expire, so long migrations do not fail once their first token runs out.
+package oauth
+
+import (
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// RefreshBefore is how long before its expiry a token is replaced.
+const RefreshBefore = 5 * time.Minute
+
+// Token is an access token and when it expires. A zero Expiry never expires;
+// such a token is only replaced after a 401.
+type Token struct {
+	AccessToken string
+	Expiry      time.Time
+	// Scopes are the OAuth scopes granted with the token, if the provider
+	// reports them.
+	Scopes []string
+}
+
+// FetchFunc requests a new token from the provider.
+type FetchFunc func() (*Token, error)
+
+// Source hands out a cached token and fetches a new one when the cached one
+// is about to expire or was rejected. It is safe for concurrent use; callers
+// that need a new token at the same time wait for a single fetch.
+type Source struct {
+	mu    sync.Mutex
+	fetch FetchFunc
+	tok   *Token
+	now   func() time.Time
+}
+
+// NewSource creates a source that obtains tokens with fetch.
+func NewSource(fetch FetchFunc) *Source {
+	return &Source{fetch: fetch, now: time.Now}
+}
+
+var (
+	shared    sync.Map
+	sweepMu   sync.Mutex
+	lastSweep time.Time
+)
+
+// sweepEvery is how often Shared drops sources whose token has expired.
+const sweepEvery = time.Minute
+
+// Shared returns the process-wide source for key, creating it with fetch the
+// first time. Clients built from the same credentials pass the same key, so
+// every worker in the process shares one token per account.
+func Shared(key string, fetch FetchFunc) *Source {
+	sweep(time.Now())
+	if s, ok := shared.Load(key); ok {
+		return s.(*Source)
+	}
+	s, _ := shared.LoadOrStore(key, NewSource(fetch))
+	return s.(*Source)
+}
+
+// sweep drops the shared sources whose token has expired, at most once per
+// sweepEvery, so sources of rotated credentials do not pile up. Clients still
+// holding a dropped source keep using it; new clients get a new source.
+func sweep(now time.Time) {
+	sweepMu.Lock()
+	if now.Sub(lastSweep) < sweepEvery {
+		sweepMu.Unlock()
+		return
+	}
+	lastSweep = now
+	sweepMu.Unlock()
+	shared.Range(func(key, s any) bool {
+		if s.(*Source).expired(now) {
+			shared.CompareAndDelete(key, s)
+		}
+		return true
+	})
+}
+
+// expired reports whether the source holds no token that is valid at now.
+func (s *Source) expired(now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tok == nil || !s.tok.Expiry.IsZero() && !now.Before(s.tok.Expiry)
+}
+
+// Token returns the cached token, fetching a new one if there is none or it
+// expires within RefreshBefore. If the fetch fails while the cached token is
+// still valid, the cached token is returned.
+func (s *Source) Token() (*Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	if s.tok != nil && (s.tok.Expiry.IsZero() || now.Before(s.tok.Expiry.Add(-RefreshBefore))) {
+		return s.tok, nil
+	}
+	tok, err := s.fetch()
+	if err != nil {
+		if s.tok != nil && !s.tok.Expiry.IsZero() && now.Before(s.tok.Expiry) {
+			return s.tok, nil
+		}
+		return nil, err
+	}
+	s.tok = tok
+	return tok, nil
+}
+
+// Refresh fetches a new token whatever the cached one is and caches it. It
+// is meant for reading what the provider grants right now, such as after
+// permissions changed.
+func (s *Source) Refresh() (*Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tok, err := s.fetch()
+	if err != nil {
+		return nil, err
+	}
+	s.tok = tok
+	return tok, nil
+}
+
+// Invalidate drops the cached token if it is still accessToken, so the next
+// Token call fetches a new one. A request that failed with an older token
+// does not discard a token another caller has just fetched.
+func (s *Source) Invalidate(accessToken string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.tok != nil && s.tok.AccessToken == accessToken {
+		s.tok = nil
+	}
+}
+
+// Do sends req with a bearer token. If the provider answers 401, the token is
+// invalidated and the request is retried once with a new one. Requests with a
+// body are only retried if req.GetBody is set, which http.NewRequest does for
+// in-memory bodies.
+func (s *Source) Do(req *http.Request) (*http.Response, error) {
+	tok, err := s.Token()
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+tok.AccessToken)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return resp, nil
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	s.Invalidate(tok.AccessToken)
+	if tok, err = s.Token(); err != nil {
+		return nil, err
+	}
+	retry := req.Clone(req.Context())
+	if req.GetBody != nil {
+		if retry.Body, err = req.GetBody(); err != nil {
+			return nil, err
+		}
+	}
+	retry.Header.Set("Authorization", "Bearer "+tok.AccessToken)
+	return http.DefaultClient.Do(retry)
+}
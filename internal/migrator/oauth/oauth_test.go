@@ -0,0 +1,177 @@
+package oauth
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// counter fetches numbered tokens valid for an hour from now.
+type counter struct {
+	mu  sync.Mutex
+	n   int
+	now time.Time
+	err error
+}
+
+func (c *counter) fetch() (*Token, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return nil, c.err
+	}
+	c.n++
+	return &Token{AccessToken: fmt.Sprintf("tok%d", c.n), Expiry: c.now.Add(time.Hour)}, nil
+}
+
+func TestToken_CachesAndRefreshesBeforeExpiry(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := &counter{now: now}
+	s := NewSource(c.fetch)
+	s.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if tok, _ := s.Token(); tok.AccessToken != "tok1" {
+			t.Fatalf("expected the cached token, got %s", tok.AccessToken)
+		}
+	}
+	// inside the refresh window a new token is fetched
+	now = now.Add(time.Hour - RefreshBefore + time.Second)
+	if tok, _ := s.Token(); tok.AccessToken != "tok2" {
+		t.Fatalf("expected a refreshed token, got %s", tok.AccessToken)
+	}
+
+	// a failed refresh keeps a token that has not expired yet
+	c.err = fmt.Errorf("down")
+	now = c.now.Add(time.Hour - time.Minute)
+	if tok, err := s.Token(); err != nil || tok.AccessToken != "tok2" {
+		t.Fatalf("expected the still valid token, got %v %v", tok, err)
+	}
+	now = c.now.Add(time.Hour + time.Minute)
+	if _, err := s.Token(); err == nil {
+		t.Fatal("expected an error once the token expired")
+	}
+}
+
+func TestToken_ConcurrentCallersShareOneFetch(t *testing.T) {
+	c := &counter{now: time.Now()}
+	s := NewSource(c.fetch)
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.Token()
+		}()
+	}
+	wg.Wait()
+	if c.n != 1 {
+		t.Fatalf("expected a single fetch, got %d", c.n)
+	}
+}
+
+func TestInvalidate_KeepsNewerToken(t *testing.T) {
+	c := &counter{now: time.Now()}
+	s := NewSource(c.fetch)
+	s.Token()
+	s.Invalidate("tok1")
+	s.Token() // tok2
+	s.Invalidate("tok1")
+	if tok, _ := s.Token(); tok.AccessToken != "tok2" {
+		t.Fatalf("a stale invalidation dropped the new token: %s", tok.AccessToken)
+	}
+}
+
+func TestDo_RetriesOnceOn401(t *testing.T) {
+	var seen []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		seen = append(seen, r.Header.Get("Authorization")+" "+string(body))
+		if r.Header.Get("Authorization") == "Bearer tok1" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	s := NewSource((&counter{now: time.Now()}).fetch)
+	req, _ := http.NewRequest("POST", srv.URL, strings.NewReader("payload"))
+	resp, err := s.Do(req)
+	if err != nil {
+		t.Fatalf("do: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected the retry to succeed, got %s", resp.Status)
+	}
+	want := "[Bearer tok1 payload Bearer tok2 payload]"
+	if fmt.Sprint(seen) != want {
+		t.Fatalf("want %s got %v", want, seen)
+	}
+}
+
+func TestDo_GivesUpAfterOneRetry(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+
+	s := NewSource((&counter{now: time.Now()}).fetch)
+	req, _ := http.NewRequest("GET", srv.URL, nil)
+	resp, err := s.Do(req)
+	if err != nil {
+		t.Fatalf("do: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized || calls != 2 {
+		t.Fatalf("expected one retry then the 401, got %s after %d calls", resp.Status, calls)
+	}
+}
+
+func TestRefresh_BypassesTheCache(t *testing.T) {
+	c := &counter{now: time.Now()}
+	s := NewSource(c.fetch)
+	if tok, _ := s.Token(); tok.AccessToken != "tok1" {
+		t.Fatalf("expected tok1, got %s", tok.AccessToken)
+	}
+	if tok, err := s.Refresh(); err != nil || tok.AccessToken != "tok2" {
+		t.Fatalf("expected a new token, got %v %v", tok, err)
+	}
+	if tok, _ := s.Token(); tok.AccessToken != "tok2" {
+		t.Fatalf("expected the refreshed token cached, got %s", tok.AccessToken)
+	}
+}
+
+func TestShared_DropsExpiredSources(t *testing.T) {
+	now := time.Now()
+	old := &counter{now: now.Add(-2 * time.Hour)}
+	stale := Shared("test:rotated", old.fetch)
+	if _, err := stale.Token(); err != nil {
+		t.Fatal(err)
+	}
+	live := &counter{now: now}
+	fresh := Shared("test:live", live.fetch)
+	if _, err := fresh.Token(); err != nil {
+		t.Fatal(err)
+	}
+
+	sweepMu.Lock()
+	lastSweep = time.Time{}
+	sweepMu.Unlock()
+	sweep(now)
+
+	if _, ok := shared.Load("test:rotated"); ok {
+		t.Fatal("expected the source with an expired token to be dropped")
+	}
+	if s, ok := shared.Load("test:live"); !ok || s != fresh {
+		t.Fatal("expected the source with a valid token to be kept")
+	}
+}
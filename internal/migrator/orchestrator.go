@@ -2,13 +2,102 @@ package migrator
 
 import (
 	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
 
 	migmodel "example.com/go-migrator/internal/migrator/model"
 	"example.com/go-migrator/internal/migrator/translator"
+	"example.com/go-migrator/internal/model"
 	"example.com/go-migrator/internal/store"
-	"github.com/google/uuid"
 )
 
+// Job describes a single channel or chat migration.
+type Job struct {
+	// TaskID and ProjectID tie ledger entries to the task being run; both may
+	// be empty for ad-hoc runs.
+	TaskID    string
+	ProjectID string
+	// SourceConnectorID and TargetConnectorID pick the Zoom account and
+	// Teams tenant; empty means the environment credentials.
+	SourceConnectorID string
+	TargetConnectorID string
+	ZoomUserID        string
+	ZoomChannelID     string
+	TeamName          string
+	ChannelName       string
+	TeamType          migmodel.TeamType
+	ChannelType       migmodel.ChannelType
+	// TeamID and ChannelID are set when the destination was created by an
+	// earlier run; the orchestrator then reuses it.
+	TeamID    string
+	ChannelID string
+	// Source is the kind of Zoom conversation; empty means a channel. Chat
+	// jobs read the 1:1 messages with ZoomContactID, or the group chat
+	// ZoomChannelID, and post into the Teams chat ChannelID, creating it with
+	// ChatTopic if it does not exist yet.
+	Source        model.SourceKind
+	ZoomContactID string
+	ChatTopic     string
+	// From limits the run to messages at or after this RFC3339 timestamp; it
+	// is the previous generation's cursor for delta tasks.
+	From string
+	// UnmappedPolicy decides how senders without an identity mapping are
+	// posted; empty means model.UnmappedFail.
+	UnmappedPolicy      model.UnmappedSenderPolicy
+	FallbackUserID      string
+	FallbackDisplayName string
+}
+
+// JobFromTask builds the Job for a task. project may be nil for tasks that do
+// not belong to a project.
+func JobFromTask(t *model.Task, project *model.Project) (Job, error) {
+	kind, zoomUserID, id, err := t.ParseSource()
+	if err != nil {
+		return Job{}, err
+	}
+	job := Job{
+		TaskID:     t.ID,
+		ProjectID:  t.ProjectID,
+		ZoomUserID: zoomUserID,
+		Source:     kind,
+		TeamID:     t.TeamsTeamID,
+		ChannelID:  t.TeamsChannelID,
+		From:       t.Cursor,
+	}
+	switch kind {
+	case model.SourceContact:
+		// 1:1 chats have no topic
+		job.ZoomContactID = id
+	case model.SourceGroupChat:
+		job.ZoomChannelID = id
+		job.ChatTopic = t.TargetPath
+	default:
+		job.ZoomChannelID = id
+		if job.TeamName, job.ChannelName, err = t.Target(); err != nil {
+			return Job{}, err
+		}
+		job.TeamType = migmodel.TeamPublic
+		job.ChannelType = migmodel.ChannelStandard
+		if t.TeamType != "" {
+			job.TeamType = migmodel.TeamType(t.TeamType)
+		}
+		if t.ChannelType != "" {
+			job.ChannelType = migmodel.ChannelType(t.ChannelType)
+		}
+	}
+	if project != nil {
+		job.SourceConnectorID = project.SourceConnectorID
+		job.TargetConnectorID = project.TargetConnectorID
+		job.UnmappedPolicy = project.UnmappedSenderPolicy
+		job.FallbackUserID = project.FallbackTeamsUserID
+		job.FallbackDisplayName = project.FallbackTeamsUserDisplayName
+	}
+	return job, nil
+}
+
 // Orchestrator runs a migration from source to destination.
 type Orchestrator struct {
 	Source migmodel.SourceClient
@@ -19,56 +108,391 @@ func NewOrchestrator(s migmodel.SourceClient, d migmodel.DestinationClient) *Orc
 	return &Orchestrator{Source: s, Dest: d}
 }
 
-// Run migrates messages from the conversation on source to a team/channel on destination.
-// It accepts the Store so it can resolve Zoom user IDs to Teams identities.
-func (o *Orchestrator) Run(zoomUserID, zoomChannelID, teamName, channelName string, teamType migmodel.TeamType, channelType migmodel.ChannelType, stm *store.StoreManager) error {
-	msgs, err := o.Source.FetchMessages(zoomUserID, zoomChannelID)
+// Run migrates messages from the conversation on source to a team/channel, or
+// a chat, on destination.
+// It accepts the Store so it can resolve Zoom user IDs to Teams identities and
+// record every message in the ledger. Messages the ledger already lists as
+// imported into the destination channel are skipped, so Run can be retried
+// and a new generation of a task does not post its history again.
+//
+// Thread replies are imported as Teams replies to their parent, oldest first,
+// right after the parent. New replies to a parent an earlier generation
+// imported are posted as replies to the parent the ledger records. Teams may
+// accept a message without returning its ID; replies to such a parent are
+// posted as messages and logged, since they have nothing to reply to. Teams
+// chats have no threads, so in chats replies are posted as messages right
+// after their parent.
+//
+// Senders are resolved before anything is created or posted, so a task that
+// fails because of unmapped senders leaves no trace in Teams. To do so the
+// channel history is streamed twice, a page at a time, instead of being held
+// in memory, and the ledger is looked up one thread at a time. The returned
+// report is non-nil once the channel members could be
+// fetched, even on error.
+func (o *Orchestrator) Run(job Job, stm *store.StoreManager) (*model.TaskReport, error) {
+	zmembers, err := o.members(job)
 	if err != nil {
-		return fmt.Errorf("fetch messages: %w", err)
+		return nil, err
 	}
 
-	// Get zoom channel members
-	zmembers, err := o.Source.FetchChannelMembers(zoomUserID, zoomChannelID)
+	report := &model.TaskReport{}
+
+	// resolve every sender up front
+	resolver := newSenderResolver(job, zmembers, stm)
+	err = o.walk(job, func(zm migmodel.ZoomMessage, replies []migmodel.ZoomMessage) error {
+		imported, err := importedIn(stm, job.ChannelID, zm, replies)
+		if err != nil {
+			return err
+		}
+		for _, m := range append([]migmodel.ZoomMessage{zm}, replies...) {
+			report.MessagesFound++
+			report.FilesFound += fileCount(m)
+			if _, ok := imported[m.ID]; ok {
+				continue
+			}
+			if _, err := resolver.resolve(m); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 	if err != nil {
-		return fmt.Errorf("fetch channel members: %w", err)
+		return report, err
+	}
+	report.UnmappedSenders = resolver.unmappedSenders()
+	if err := resolver.check(); err != nil {
+		return report, err
+	}
+
+	teamID, chID := job.TeamID, job.ChannelID
+	switch {
+	case job.Source.Chat():
+		if chID == "" {
+			if chID, err = o.ensureChat(job, zmembers, stm); err != nil {
+				return report, err
+			}
+		}
+	case teamID == "" || chID == "":
+		if teamID, chID, err = o.ensureTarget(job, stm); err != nil {
+			return report, err
+		}
 	}
 
-	// Build memberID to userID map
-	memberIDToUserID := make(map[string]string)
-	for _, member := range zmembers {
-		memberIDToUserID[member.MemberID] = member.ID
+	// an earlier generation, or a run that failed before recording the
+	// destination, may already have posted into the channel
+	imp := &importer{dest: o.Dest, stm: stm, job: job, resolver: resolver, teamID: teamID, channelID: chID, report: report}
+	cursor := job.From
+	err = o.walk(job, func(zm migmodel.ZoomMessage, replies []migmodel.ZoomMessage) error {
+		var err error
+		if imp.imported, err = importedIn(stm, chID, zm, replies); err != nil {
+			return err
+		}
+		if created := translator.CreatedDateTime(zm); created > cursor {
+			cursor = created
+		}
+		if zm.ReplyMainMessageID != "" && !job.Source.Chat() {
+			// a new reply in a thread an earlier generation imported
+			parentID, known := imp.imported[zm.ReplyMainMessageID]
+			_, done := imp.imported[zm.ID]
+			switch {
+			case done:
+			case !known:
+				return fmt.Errorf("parent %s of reply %s is not in the ledger of channel %s", zm.ReplyMainMessageID, zm.ID, chID)
+			case parentID == "":
+				log.Printf("migrator: the ledger has no Teams ID for parent %s in channel %s; posting reply %s as a message", zm.ReplyMainMessageID, chID, zm.ID)
+			}
+			_, err := imp.post(zm, parentID)
+			return err
+		}
+		parentID, err := imp.post(zm, "")
+		if err != nil {
+			return err
+		}
+		if len(replies) > 0 && parentID == "" && !job.Source.Chat() {
+			log.Printf("migrator: the ledger has no Teams ID for message %s in channel %s; posting its %d replies as messages", zm.ID, chID, len(replies))
+		}
+		for _, r := range replies {
+			if _, err := imp.post(r, parentID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	report.UnmappedSenders = resolver.unmappedSenders()
+	if err != nil {
+		return report, err
+	}
+	if report.MessagesSkipped > 0 {
+		log.Printf("migrator: skipped %d messages already imported into channel %s", report.MessagesSkipped, chID)
+	}
+	if job.TaskID != "" && cursor != job.From {
+		if err := stm.Task.SetCursor(job.TaskID, cursor); err != nil {
+			return report, fmt.Errorf("record cursor: %w", err)
+		}
 	}
+	return report, nil
+}
 
-	teamID, err := o.Dest.EnsureTeam(teamName, teamType)
+// importedIn looks up which messages of a thread the ledger lists as imported
+// into a Teams channel; for a reply passed on its own that includes its
+// parent. It returns an empty map when there is no channel yet.
+func importedIn(stm *store.StoreManager, channelID string, zm migmodel.ZoomMessage, replies []migmodel.ZoomMessage) (map[string]string, error) {
+	if channelID == "" {
+		return map[string]string{}, nil
+	}
+	ids := []string{zm.ID}
+	if zm.ReplyMainMessageID != "" {
+		ids = append(ids, zm.ReplyMainMessageID)
+	}
+	for _, r := range replies {
+		ids = append(ids, r.ID)
+	}
+	imported, err := stm.Message.ImportedIn(channelID, ids)
 	if err != nil {
-		return fmt.Errorf("ensure team: %w", err)
+		return nil, fmt.Errorf("load message ledger: %w", err)
+	}
+	return imported, nil
+}
+
+// walk streams the job's conversation history and calls fn with each
+// top-level message and its replies, oldest reply first. Replies are fetched
+// per thread, so only one thread is held in memory at a time.
+//
+// A delta generation may list replies to a parent sent before its window.
+// Those are passed to fn on their own, oldest first, after the listing; the
+// parent was imported by an earlier generation.
+func (o *Orchestrator) walk(job Job, fn func(zm migmodel.ZoomMessage, replies []migmodel.ZoomMessage) error) error {
+	var it migmodel.Iterator[migmodel.ZoomMessage]
+	if job.Source == model.SourceContact {
+		it = o.Source.IterateContactMessages(job.ZoomUserID, job.ZoomContactID, job.From)
+	} else {
+		it = o.Source.IterateMessages(job.ZoomUserID, job.ZoomChannelID, job.From)
+	}
+	seen := map[string]bool{}
+	var listedReplies []migmodel.ZoomMessage
+	for it.Next() {
+		zm := it.Item()
+		if zm.ReplyMainMessageID != "" {
+			// replies are handled with their thread
+			listedReplies = append(listedReplies, zm)
+			continue
+		}
+		seen[zm.ID] = true
+		var replies []migmodel.ZoomMessage
+		if zm.ReplyCount == nil || *zm.ReplyCount > 0 {
+			var err error
+			if replies, err = o.replies(job, zm.ID); err != nil {
+				return fmt.Errorf("fetch replies to %s: %w", zm.ID, err)
+			}
+		}
+		if err := fn(zm, replies); err != nil {
+			return err
+		}
+	}
+	if err := it.Err(); err != nil {
+		return fmt.Errorf("fetch messages: %w", err)
+	}
+
+	var orphans []migmodel.ZoomMessage
+	for _, r := range listedReplies {
+		if !seen[r.ReplyMainMessageID] && !seen[r.ID] {
+			seen[r.ID] = true
+			orphans = append(orphans, r)
+		}
+	}
+	sort.SliceStable(orphans, func(i, j int) bool {
+		return translator.CreatedDateTime(orphans[i]) < translator.CreatedDateTime(orphans[j])
+	})
+	for _, r := range orphans {
+		if err := fn(r, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (o *Orchestrator) replies(job Job, messageID string) ([]migmodel.ZoomMessage, error) {
+	if job.Source == model.SourceContact {
+		return o.Source.FetchContactReplies(job.ZoomUserID, job.ZoomContactID, messageID)
+	}
+	return o.Source.FetchReplies(job.ZoomUserID, job.ZoomChannelID, messageID)
+}
+
+// importer posts messages into one Teams channel or chat and keeps the
+// ledger.
+type importer struct {
+	dest      migmodel.DestinationClient
+	stm       *store.StoreManager
+	job       Job
+	resolver  *senderResolver
+	teamID    string
+	channelID string
+	// imported maps the messages of the current thread that are already in
+	// the channel to their Teams IDs
+	imported map[string]string
+	report   *model.TaskReport
+}
+
+// post imports a message, as a reply to the Teams message parentID if set,
+// and returns its Teams message ID. Messages the ledger lists as imported are
+// skipped and return the ID they were imported as.
+func (i *importer) post(zm migmodel.ZoomMessage, parentID string) (string, error) {
+	if teamsID, ok := i.imported[zm.ID]; ok {
+		i.report.MessagesSkipped++
+		return teamsID, nil
+	}
+
+	// messages sent since the first pass may come from new senders
+	s, err := i.resolver.lookup(zm)
+	if err == nil && s == nil {
+		err = i.resolver.check()
 	}
-	chID, err := o.Dest.EnsureChannel(teamID, channelName, channelType)
 	if err != nil {
-		return fmt.Errorf("ensure channel: %w", err)
+		return "", err
+	}
+	tm := translator.TranslateZoomToTeams(zm, s.teamsUserID, s.displayName)
+	if s.attribute {
+		translator.AttributeSender(&tm, s.zoomName, s.zoomEmail)
+	}
+
+	rec := &model.MessageRecord{
+		ProjectID:      i.job.ProjectID,
+		TaskID:         i.job.TaskID,
+		ZoomMessageID:  zm.ID,
+		TeamsTeamID:    i.teamID,
+		TeamsChannelID: i.channelID,
+		Status:         model.MessageImported,
+		Files:          fileCount(zm),
+	}
+	var msgID string
+	var postErr error
+	switch {
+	case i.job.Source.Chat():
+		msgID, postErr = i.dest.PostChatMessage(i.channelID, tm)
+	case parentID == "":
+		msgID, postErr = i.dest.PostMessage(i.teamID, i.channelID, tm)
+	default:
+		msgID, postErr = i.dest.PostReply(i.teamID, i.channelID, parentID, tm)
+	}
+	if postErr != nil {
+		rec.Status = model.MessageFailed
+		rec.Error = postErr.Error()
+	}
+	rec.TeamsMessageID = msgID
+	if err := i.stm.Message.Record(rec); err != nil {
+		return "", fmt.Errorf("record message %s: %w", zm.ID, err)
+	}
+	if postErr != nil {
+		return "", fmt.Errorf("post message: %w", postErr)
+	}
+	i.report.MessagesImported++
+	return msgID, nil
+}
+
+// fileCount returns the number of files attached to a Zoom message. Older
+// payloads carry a single file in the top-level fields only.
+func fileCount(zm migmodel.ZoomMessage) int {
+	if len(zm.Files) == 0 && zm.FileID != "" {
+		return 1
 	}
+	return len(zm.Files)
+}
+
+// teamClaimStale is how long a claim on a team name holds without the team
+// being recorded before another task may take it over. Teams can take a
+// while to create a team.
+const teamClaimStale = 10 * time.Minute
 
-	for _, zm := range msgs {
-		// Find Teams user ID and display name from identity mapping
-		zoomUserID := memberIDToUserID[zm.SendMemberID]
-		var teamUserID, teamUserDisplayName string
-		identity, err := stm.Identity.GetByZoomID(zoomUserID)
-		if identity == nil {
-			teamUserID = uuid.New().String()
-			teamUserDisplayName = "Unknown User"
-		} else {
-			teamUserID = identity.TeamsUserID
-			teamUserDisplayName = identity.TeamsUserDisplayName
+// teamClaimPoll is how often a task waiting for another one to create its
+// team checks again.
+var teamClaimPoll = 2 * time.Second
+
+// ensureTarget creates the job's Teams channel, and its team unless another
+// task of the project already created a team of that name, and records both
+// on the task.
+func (o *Orchestrator) ensureTarget(job Job, stm *store.StoreManager) (teamID, chID string, err error) {
+	teamID = job.TeamID
+	if teamID == "" && job.ProjectID != "" {
+		if teamID, err = o.projectTeam(job, stm); err != nil {
+			return "", "", err
 		}
+	}
+	if teamID == "" {
+		// jobs without a project have no team to share
+		teamID, err = o.Dest.EnsureTeam(job.TeamName, job.TeamType)
 		if err != nil {
-			return fmt.Errorf("unable to get identity by zoom user ID: %w", err)
+			return "", "", fmt.Errorf("ensure team: %w", err)
 		}
+	}
+	chID, err = o.Dest.EnsureChannel(teamID, job.ChannelName, job.ChannelType)
+	if err != nil {
+		return "", "", fmt.Errorf("ensure channel: %w", err)
+	}
+	if job.TaskID != "" {
+		if err := stm.Task.SetTarget(job.TaskID, teamID, chID); err != nil {
+			return "", "", fmt.Errorf("record target: %w", err)
+		}
+	}
+	return teamID, chID, nil
+}
 
-		tm := translator.TranslateZoomToTeams(zm, teamUserID, teamUserDisplayName)
+// projectTeam returns the team named job.TeamName of the job's project,
+// creating it unless another task already did. Tasks consolidated into one
+// team claim its name in the database first, so only one of them creates it,
+// whichever worker process runs them; the others wait for its ID. A task whose
+// claim went stale and was taken over while it created the team uses the team
+// recorded by the new holder instead.
+func (o *Orchestrator) projectTeam(job Job, stm *store.StoreManager) (string, error) {
+	holder := uuid.NewString()
+	for {
+		teamID, claimed, err := awaitTeam(job, stm, holder)
+		if err != nil || !claimed {
+			return teamID, err
+		}
 
-		if err := o.Dest.PostMessage(teamID, chID, tm); err != nil {
-			return fmt.Errorf("post message: %w", err)
+		// teams created before claims were recorded are only known to their tasks
+		created := false
+		teamID, err = stm.Task.FindTeamID(job.ProjectID, job.TeamName)
+		if err != nil {
+			err = fmt.Errorf("look up team: %w", err)
+		} else if teamID == "" {
+			if teamID, err = o.Dest.EnsureTeam(job.TeamName, job.TeamType); err != nil {
+				err = fmt.Errorf("ensure team: %w", err)
+			}
+			created = err == nil
+		}
+		if err != nil {
+			if rerr := stm.TeamClaim.Release(job.ProjectID, job.TeamName, holder); rerr != nil {
+				log.Printf("release team claim %s: %v", job.TeamName, rerr)
+			}
+			return "", err
+		}
+		recorded, err := stm.TeamClaim.SetTeamID(job.ProjectID, job.TeamName, holder, teamID)
+		if err != nil {
+			return "", fmt.Errorf("record team: %w", err)
+		}
+		if recorded {
+			return teamID, nil
+		}
+		if created {
+			log.Printf("team %s of project %s: claim was taken over while creating it; team %s is not used and should be deleted", job.TeamName, job.ProjectID, teamID)
 		}
 	}
-	return nil
+}
+
+// awaitTeam claims the job's team name for holder, waiting while another
+// task holds the claim. It returns the team once one is recorded, or
+// claimed if holder has to create it.
+func awaitTeam(job Job, stm *store.StoreManager, holder string) (string, bool, error) {
+	for {
+		now := time.Now()
+		claim, claimed, err := stm.TeamClaim.Claim(job.ProjectID, job.TeamName, holder, now, now.Add(-teamClaimStale))
+		if err != nil {
+			return "", false, fmt.Errorf("claim team: %w", err)
+		}
+		if claim.TeamsTeamID != "" || claimed {
+			return claim.TeamsTeamID, claimed, nil
+		}
+		time.Sleep(teamClaimPoll)
+	}
 }
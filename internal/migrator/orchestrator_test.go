@@ -0,0 +1,568 @@
+package migrator
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	migmodel "example.com/go-migrator/internal/migrator/model"
+	"example.com/go-migrator/internal/model"
+	"example.com/go-migrator/internal/store"
+)
+
+// sliceIterator is a migmodel.Iterator over a slice.
+type sliceIterator struct {
+	items []migmodel.ZoomMessage
+	pos   int
+}
+
+func (it *sliceIterator) Next() bool {
+	if it.pos >= len(it.items) {
+		return false
+	}
+	it.pos++
+	return true
+}
+
+func (it *sliceIterator) Item() migmodel.ZoomMessage { return it.items[it.pos-1] }
+func (it *sliceIterator) Err() error                 { return nil }
+
+type fakeSource struct {
+	messages []migmodel.ZoomMessage
+	replies  map[string][]migmodel.ZoomMessage
+	fetched  []string
+	// contact is the 1:1 history, read with to_contact
+	contact []migmodel.ZoomMessage
+}
+
+func (f *fakeSource) GetUsers() ([]migmodel.ZoomUser, error) { return nil, nil }
+func (f *fakeSource) GetUser(userID string) (migmodel.ZoomUser, error) {
+	return migmodel.ZoomUser{ID: userID, Email: userID + "@example.com"}, nil
+}
+func (f *fakeSource) GetUserChannels(userID string) ([]migmodel.ZoomChannel, error) {
+	return nil, nil
+}
+func (f *fakeSource) FetchMessages(userID, channelID, from string) ([]migmodel.ZoomMessage, error) {
+	return f.messages, nil
+}
+func (f *fakeSource) IterateMessages(userID, channelID, from string) migmodel.Iterator[migmodel.ZoomMessage] {
+	return &sliceIterator{items: f.messages}
+}
+func (f *fakeSource) FetchChannelMembers(userID, channelID string) ([]migmodel.ZoomChannelMember, error) {
+	return nil, nil
+}
+func (f *fakeSource) FetchReplies(userID, channelID, messageID string) ([]migmodel.ZoomMessage, error) {
+	f.fetched = append(f.fetched, messageID)
+	return f.replies[messageID], nil
+}
+
+func (f *fakeSource) IterateContactMessages(userID, contactID, from string) migmodel.Iterator[migmodel.ZoomMessage] {
+	return &sliceIterator{items: f.contact}
+}
+func (f *fakeSource) FetchContactReplies(userID, contactID, messageID string) ([]migmodel.ZoomMessage, error) {
+	f.fetched = append(f.fetched, "contact:"+messageID)
+	return f.replies[messageID], nil
+}
+
+func TestWalk_GroupsThreads(t *testing.T) {
+	zero := 0
+	src := &fakeSource{
+		messages: []migmodel.ZoomMessage{
+			{ID: "m1"},
+			// replies listed among channel messages are imported with their thread
+			{ID: "r1", ReplyMainMessageID: "m1"},
+			{ID: "m2", ReplyCount: &zero},
+		},
+		replies: map[string][]migmodel.ZoomMessage{
+			"m1": {{ID: "r1", ReplyMainMessageID: "m1"}, {ID: "r2", ReplyMainMessageID: "m1"}},
+		},
+	}
+	o := NewOrchestrator(src, nil)
+	var got []string
+	err := o.walk(Job{}, func(zm migmodel.ZoomMessage, replies []migmodel.ZoomMessage) error {
+		got = append(got, zm.ID)
+		for _, r := range replies {
+			got = append(got, zm.ID+">"+r.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("walk: %v", err)
+	}
+	if want := []string{"m1", "m1>r1", "m1>r2", "m2"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("want %v got %v", want, got)
+	}
+	// a thread Zoom reports as empty is not fetched
+	if !reflect.DeepEqual(src.fetched, []string{"m1"}) {
+		t.Fatalf("expected only m1's thread fetched, got %v", src.fetched)
+	}
+}
+
+func TestWalk_ContactReadsOneToOneHistory(t *testing.T) {
+	src := &fakeSource{
+		messages: []migmodel.ZoomMessage{{ID: "channel"}},
+		contact:  []migmodel.ZoomMessage{{ID: "d1"}},
+		replies:  map[string][]migmodel.ZoomMessage{"d1": {{ID: "d2", ReplyMainMessageID: "d1"}}},
+	}
+	o := NewOrchestrator(src, nil)
+	var got []string
+	job := Job{Source: model.SourceContact, ZoomUserID: "u1", ZoomContactID: "u2"}
+	err := o.walk(job, func(zm migmodel.ZoomMessage, replies []migmodel.ZoomMessage) error {
+		got = append(got, zm.ID)
+		for _, r := range replies {
+			got = append(got, zm.ID+">"+r.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("walk: %v", err)
+	}
+	if want := []string{"d1", "d1>d2"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("want %v got %v", want, got)
+	}
+	if !reflect.DeepEqual(src.fetched, []string{"contact:d1"}) {
+		t.Fatalf("expected the thread read with to_contact, got %v", src.fetched)
+	}
+}
+
+func TestJobFromTask_Chats(t *testing.T) {
+	dm := &model.Task{SourcePath: model.ContactSourcePath("u1", "u2"), TargetPath: "ignored", TeamsChannelID: "chat1"}
+	job, err := JobFromTask(dm, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Source != model.SourceContact || job.ZoomContactID != "u2" || job.ChatTopic != "" || job.ChannelID != "chat1" {
+		t.Fatalf("unexpected 1:1 job %+v", job)
+	}
+
+	group := &model.Task{SourcePath: model.GroupChatSourcePath("u1", "g1"), TargetPath: "Launch crew"}
+	if job, err = JobFromTask(group, nil); err != nil {
+		t.Fatal(err)
+	}
+	if job.Source != model.SourceGroupChat || job.ZoomChannelID != "g1" || job.ChatTopic != "Launch crew" {
+		t.Fatalf("unexpected group chat job %+v", job)
+	}
+
+	if _, err := JobFromTask(&model.Task{SourcePath: "users/u1/meetings/m1", TargetPath: "a/b"}, nil); err == nil {
+		t.Fatal("expected an unknown source kind to be rejected")
+	}
+}
+
+// fakeIdentities resolves Zoom user IDs from a map; other methods are not
+// used by these tests.
+type fakeIdentities struct {
+	store.IdentityStoreInterface
+	teams map[string]string
+	// invalid marks mappings that failed validation
+	invalid map[string]bool
+}
+
+func (f *fakeIdentities) Resolve(projectID, zoomID string) (*model.Identity, error) {
+	id, ok := f.teams[zoomID]
+	if !ok {
+		return nil, store.ErrNotFound
+	}
+	status := model.IdentityValid
+	if f.invalid[zoomID] {
+		status = model.IdentityNotFound
+	}
+	return &model.Identity{ZoomUserID: zoomID, TeamsUserID: id, ValidationStatus: status}, nil
+}
+
+func TestChatMembers(t *testing.T) {
+	stm := &store.StoreManager{Identity: &fakeIdentities{teams: map[string]string{"u1": "t1", "u2": "t2", "u3": "t2"}}}
+	group := Job{Source: model.SourceGroupChat}
+
+	ids, err := chatMembers(group, []migmodel.ZoomChannelMember{
+		{ID: "u1"}, {ID: "u2"},
+		// an alias of u2 is not added twice
+		{ID: "u3"},
+		{Email: "guest@partner.example", IsExternal: true},
+	}, stm)
+	if err != nil || !reflect.DeepEqual(ids, []string{"t1", "t2"}) {
+		t.Fatalf("expected t1 and t2, got %v, %v", ids, err)
+	}
+
+	_, err = chatMembers(group, []migmodel.ZoomChannelMember{{ID: "u1"}, {ID: "u9"}, {Email: "x@example.com"}}, stm)
+	if err == nil || !strings.Contains(err.Error(), "2 chat participants") || !strings.Contains(err.Error(), "u9") {
+		t.Fatalf("expected the unmapped participants listed, got %v", err)
+	}
+
+	// under a fallback policy the fallback account stands in, once
+	fallback := Job{Source: model.SourceGroupChat, UnmappedPolicy: model.UnmappedFallbackAttributed, FallbackUserID: "fb"}
+	ids, err = chatMembers(fallback, []migmodel.ZoomChannelMember{{ID: "u1"}, {ID: "u9"}, {Email: "x@example.com"}}, stm)
+	if err != nil || !reflect.DeepEqual(ids, []string{"t1", "fb"}) {
+		t.Fatalf("expected t1 and the fallback account, got %v, %v", ids, err)
+	}
+	fallback.FallbackUserID = ""
+	if _, err := chatMembers(fallback, []migmodel.ZoomChannelMember{{ID: "u1"}, {ID: "u9"}}, stm); err == nil {
+		t.Fatal("expected an error without a fallback account")
+	}
+
+	dm := Job{Source: model.SourceContact}
+	if _, err := chatMembers(dm, []migmodel.ZoomChannelMember{{ID: "u2"}, {ID: "u3"}}, stm); err == nil {
+		t.Fatal("expected a 1:1 chat mapping to a single Teams user to be rejected")
+	}
+}
+
+func TestSenderResolver_MatchesMembersByEmail(t *testing.T) {
+	stm := &store.StoreManager{Identity: &fakeIdentities{teams: map[string]string{"u2": "t2"}}}
+	members := []migmodel.ZoomChannelMember{{ID: "u2", Email: "Bob@example.com", Name: "Bob"}}
+	r := newSenderResolver(Job{}, members, stm)
+	s, err := r.resolve(migmodel.ZoomMessage{ID: "d1", Sender: "bob@example.com"})
+	if err != nil || s == nil || s.teamsUserID != "t2" {
+		t.Fatalf("expected the sender matched by email, got %+v, %v", s, err)
+	}
+}
+
+// newTestStore returns the stores of tenant "a" over an in-memory database
+// with the full schema.
+// createValidated creates an identity that passed validation for jobs
+// without a project.
+func createValidated(t *testing.T, stm *store.StoreManager, identity *model.Identity) {
+	t.Helper()
+	if err := stm.Identity.Create(identity); err != nil {
+		t.Fatal(err)
+	}
+	if err := stm.Identity.SetValidation("", identity.ID, model.IdentityValid, "", "", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newTestStore(t *testing.T) *store.StoreManager {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{TranslateError: true, Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	if err := store.AutoMigrate(db, "default"); err != nil {
+		t.Fatal(err)
+	}
+	return store.NewStoreManager(db, nil).ForTenant("a")
+}
+
+// fakeDest is a destination with one team and channel that records what was
+// posted.
+type fakeDest struct {
+	posts []string
+}
+
+func (f *fakeDest) EnsureTeam(name string, t migmodel.TeamType) (string, error) { return "team-1", nil }
+func (f *fakeDest) EnsureChannel(teamID, name string, c migmodel.ChannelType) (string, error) {
+	return "channel-1", nil
+}
+func (f *fakeDest) PostMessage(teamID, channelID string, m migmodel.TeamsMessageRequest) (string, error) {
+	f.posts = append(f.posts, "message")
+	return fmt.Sprintf("tm%d", len(f.posts)), nil
+}
+func (f *fakeDest) PostReply(teamID, channelID, parentID string, m migmodel.TeamsMessageRequest) (string, error) {
+	f.posts = append(f.posts, "reply to "+parentID)
+	return fmt.Sprintf("tm%d", len(f.posts)), nil
+}
+func (f *fakeDest) CreateChat(t migmodel.ChatType, topic string, memberIDs []string) (string, error) {
+	return "chat-1", nil
+}
+func (f *fakeDest) PostChatMessage(chatID string, m migmodel.TeamsMessageRequest) (string, error) {
+	f.posts = append(f.posts, "chat message")
+	return fmt.Sprintf("tm%d", len(f.posts)), nil
+}
+
+func TestRun_NewGenerationSkipsImportedMessages(t *testing.T) {
+	stm := newTestStore(t)
+	createValidated(t, stm, &model.Identity{ZoomUserID: "u1", TeamsUserID: "t1"})
+	one := 1
+	src := &fakeSource{
+		messages: []migmodel.ZoomMessage{
+			{ID: "m1", SendMemberID: "u1", DateTime: "2024-05-01T10:00:00Z", ReplyCount: &one},
+			{ID: "m2", SendMemberID: "u1", DateTime: "2024-05-01T11:00:00Z"},
+		},
+		replies: map[string][]migmodel.ZoomMessage{
+			"m1": {{ID: "r1", SendMemberID: "u1", DateTime: "2024-05-01T10:30:00Z", ReplyMainMessageID: "m1"}},
+		},
+	}
+	dest := &fakeDest{}
+	job := Job{ZoomUserID: "owner", ZoomChannelID: "c1", TeamName: "Team", ChannelName: "general"}
+
+	if _, err := NewOrchestrator(src, dest).Run(job, stm); err != nil {
+		t.Fatal(err)
+	}
+	if len(dest.posts) != 3 {
+		t.Fatalf("expected 3 posts, got %v", dest.posts)
+	}
+
+	// a new full generation has no destination recorded yet
+	dest.posts = nil
+	report, err := NewOrchestrator(src, dest).Run(job, stm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dest.posts) != 0 || report.MessagesSkipped != 3 {
+		t.Fatalf("expected nothing posted again, got %v and %d skipped", dest.posts, report.MessagesSkipped)
+	}
+}
+
+func TestWalk_RepliesToOlderThreadsComeLast(t *testing.T) {
+	zero := 0
+	src := &fakeSource{
+		messages: []migmodel.ZoomMessage{
+			// p0 was sent before the window of this delta generation
+			{ID: "r2", ReplyMainMessageID: "p0", DateTime: "2024-05-02T09:00:00Z"},
+			{ID: "m1", ReplyCount: &zero},
+			{ID: "r1", ReplyMainMessageID: "p0", DateTime: "2024-05-01T09:00:00Z"},
+		},
+	}
+	var got []string
+	err := NewOrchestrator(src, nil).walk(Job{}, func(zm migmodel.ZoomMessage, replies []migmodel.ZoomMessage) error {
+		got = append(got, zm.ID)
+		for _, r := range replies {
+			got = append(got, zm.ID+">"+r.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("walk: %v", err)
+	}
+	if want := []string{"m1", "r1", "r2"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("want %v got %v", want, got)
+	}
+}
+
+func TestRun_DeltaReplyToImportedParent(t *testing.T) {
+	stm := newTestStore(t)
+	createValidated(t, stm, &model.Identity{ZoomUserID: "u1", TeamsUserID: "t1"})
+	err := stm.Message.Record(&model.MessageRecord{ZoomMessageID: "p0", TeamsChannelID: "channel-1", TeamsMessageID: "tm-p0", Status: model.MessageImported})
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := &fakeSource{messages: []migmodel.ZoomMessage{
+		{ID: "r1", SendMemberID: "u1", ReplyMainMessageID: "p0", DateTime: "2024-05-02T09:00:00Z"},
+	}}
+	dest := &fakeDest{}
+	job := Job{TeamID: "team-1", ChannelID: "channel-1", From: "2024-05-02T00:00:00Z"}
+	if _, err := NewOrchestrator(src, dest).Run(job, stm); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"reply to tm-p0"}; !reflect.DeepEqual(dest.posts, want) {
+		t.Fatalf("want %v got %v", want, dest.posts)
+	}
+
+	// without the parent in the ledger the reply has nowhere to go
+	src.messages[0] = migmodel.ZoomMessage{ID: "r2", SendMemberID: "u1", ReplyMainMessageID: "p9"}
+	if _, err := NewOrchestrator(src, dest).Run(job, stm); err == nil || !strings.Contains(err.Error(), "p9") {
+		t.Fatalf("expected an error naming the missing parent, got %v", err)
+	}
+}
+
+func TestRun_RepliesToAParentWithoutTeamsID(t *testing.T) {
+	stm := newTestStore(t)
+	createValidated(t, stm, &model.Identity{ZoomUserID: "u1", TeamsUserID: "t1"})
+	// Teams accepted p0 but returned no ID for it
+	err := stm.Message.Record(&model.MessageRecord{ZoomMessageID: "p0", TeamsChannelID: "channel-1", Status: model.MessageImported})
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := &fakeSource{
+		messages: []migmodel.ZoomMessage{{ID: "p0", SendMemberID: "u1"}},
+		replies:  map[string][]migmodel.ZoomMessage{"p0": {{ID: "r1", SendMemberID: "u1", ReplyMainMessageID: "p0"}}},
+	}
+	dest := &fakeDest{}
+	job := Job{TeamID: "team-1", ChannelID: "channel-1"}
+	report, err := NewOrchestrator(src, dest).Run(job, stm)
+	if err != nil {
+		t.Fatalf("expected the reply posted as a message, got %v", err)
+	}
+	if want := []string{"message"}; !reflect.DeepEqual(dest.posts, want) || report.MessagesImported != 1 {
+		t.Fatalf("want %v got %v, %d imported", want, dest.posts, report.MessagesImported)
+	}
+
+	// a delta generation replying to p0 does not fail either
+	src.messages = []migmodel.ZoomMessage{{ID: "r2", SendMemberID: "u1", ReplyMainMessageID: "p0", DateTime: "2024-05-03T09:00:00Z"}}
+	if _, err := NewOrchestrator(src, dest).Run(job, stm); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"message", "message"}; !reflect.DeepEqual(dest.posts, want) {
+		t.Fatalf("want %v got %v", want, dest.posts)
+	}
+}
+
+func TestImporter_PostRoutesByParentAndSource(t *testing.T) {
+	stm := newTestStore(t)
+	createValidated(t, stm, &model.Identity{ZoomUserID: "u1", TeamsUserID: "t1"})
+	tests := []struct {
+		name     string
+		source   model.SourceKind
+		parentID string
+		want     string
+	}{
+		{"top-level channel message", model.SourceChannel, "", "message"},
+		{"thread reply", model.SourceChannel, "tm-p", "reply to tm-p"},
+		{"chat message", model.SourceGroupChat, "", "chat message"},
+		{"chat reply is a plain message", model.SourceGroupChat, "tm-p", "chat message"},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dest := &fakeDest{}
+			job := Job{Source: tt.source}
+			imp := &importer{dest: dest, stm: stm, job: job, resolver: newSenderResolver(job, nil, stm),
+				teamID: "team-1", channelID: "channel-1", imported: map[string]string{}, report: &model.TaskReport{}}
+			if _, err := imp.post(migmodel.ZoomMessage{ID: fmt.Sprintf("m%d", i), SendMemberID: "u1"}, tt.parentID); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(dest.posts, []string{tt.want}) {
+				t.Fatalf("want %q got %v", tt.want, dest.posts)
+			}
+		})
+	}
+}
+
+func TestSenderResolver_RefusesInvalidMappings(t *testing.T) {
+	stm := &store.StoreManager{Identity: &fakeIdentities{
+		teams:   map[string]string{"u1": "t1", "u2": "t2"},
+		invalid: map[string]bool{"u2": true},
+	}}
+	// even a fallback account does not stand in for a broken mapping
+	r := newSenderResolver(Job{UnmappedPolicy: model.UnmappedFallback, FallbackUserID: "fb"}, nil, stm)
+	if s, err := r.resolve(migmodel.ZoomMessage{ID: "m1", SendMemberID: "u1"}); err != nil || s == nil {
+		t.Fatalf("expected u1 resolved, got %+v, %v", s, err)
+	}
+	if s, err := r.resolve(migmodel.ZoomMessage{ID: "m2", SendMemberID: "u2"}); err != nil || s != nil {
+		t.Fatalf("expected no sender for u2, got %+v, %v", s, err)
+	}
+	if err := r.check(); err == nil || !strings.Contains(err.Error(), "u2 (not_found)") {
+		t.Fatalf("expected u2's mapping reported, got %v", err)
+	}
+
+	_, err := chatMembers(Job{Source: model.SourceGroupChat}, []migmodel.ZoomChannelMember{{ID: "u1"}, {ID: "u2"}}, stm)
+	if err == nil || !strings.Contains(err.Error(), "u2 (not_found)") {
+		t.Fatalf("expected u2's mapping reported for the chat, got %v", err)
+	}
+}
+
+func TestSenderResolver_UnresolvedUPNIsNotValid(t *testing.T) {
+	stm := newTestStore(t)
+	createValidated(t, stm, &model.Identity{ZoomUserID: "u1", TeamsUserPrincipalName: "jane@contoso.example"})
+	r := newSenderResolver(Job{}, nil, stm)
+	if s, err := r.resolve(migmodel.ZoomMessage{ID: "m1", SendMemberID: "u1"}); err != nil || s != nil {
+		t.Fatalf("expected no sender, got %+v, %v", s, err)
+	}
+	if len(r.unmappedSenders()) != 0 {
+		t.Fatalf("expected the UPN-only mapping not reported as unmapped, got %v", r.unmappedSenders())
+	}
+	if err := r.check(); err == nil || !strings.Contains(err.Error(), "UPN not resolved") {
+		t.Fatalf("expected the mapping to need validation, got %v", err)
+	}
+}
+
+// teamDest counts the teams it creates.
+type teamDest struct {
+	fakeDest
+	mu    sync.Mutex
+	teams int
+}
+
+func (d *teamDest) EnsureTeam(name string, t migmodel.TeamType) (string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.teams++
+	return fmt.Sprintf("team-%d", d.teams), nil
+}
+
+func TestEnsureTarget_ConsolidatedTasksShareOneTeam(t *testing.T) {
+	stm := newTestStore(t)
+	poll := teamClaimPoll
+	teamClaimPoll = time.Millisecond
+	defer func() { teamClaimPoll = poll }()
+
+	dest := &teamDest{}
+	// another worker holds the claim and creates the team meanwhile
+	now := time.Now()
+	if _, claimed, err := stm.TeamClaim.Claim("p1", "Sales", "other", now, now.Add(-teamClaimStale)); err != nil || !claimed {
+		t.Fatalf("claim: %v, %v", claimed, err)
+	}
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		if _, err := stm.TeamClaim.SetTeamID("p1", "Sales", "other", "team-other"); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	var wg sync.WaitGroup
+	ids := make([]string, 3)
+	for i := range ids {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			job := Job{ProjectID: "p1", TeamName: "Sales", ChannelName: fmt.Sprintf("c%d", i)}
+			teamID, _, err := NewOrchestrator(nil, dest).ensureTarget(job, stm)
+			if err != nil {
+				t.Error(err)
+			}
+			ids[i] = teamID
+		}(i)
+	}
+	wg.Wait()
+	for i, id := range ids {
+		if id != "team-other" {
+			t.Fatalf("task %d: expected the claimed team, got %q", i, id)
+		}
+	}
+	if dest.teams != 0 {
+		t.Fatalf("expected no team created while another task held the claim, got %d", dest.teams)
+	}
+
+	// the first task of another team creates it once
+	for i := 0; i < 2; i++ {
+		teamID, _, err := NewOrchestrator(nil, dest).ensureTarget(Job{ProjectID: "p1", TeamName: "Support", ChannelName: "c"}, stm)
+		if err != nil || teamID != "team-1" {
+			t.Fatalf("expected team-1, got %q, %v", teamID, err)
+		}
+	}
+	if dest.teams != 1 {
+		t.Fatalf("expected one team created, got %d", dest.teams)
+	}
+}
+
+// takeoverDest lets another worker take over the team claim while it
+// creates a team, as if creating it had taken longer than teamClaimStale.
+type takeoverDest struct {
+	teamDest
+	stm *store.StoreManager
+}
+
+func (d *takeoverDest) EnsureTeam(name string, t migmodel.TeamType) (string, error) {
+	later := time.Now().Add(2 * teamClaimStale)
+	if _, claimed, err := d.stm.TeamClaim.Claim("p1", name, "other", later, later.Add(-teamClaimStale)); err != nil || !claimed {
+		return "", fmt.Errorf("take over: %v, %v", claimed, err)
+	}
+	if _, err := d.stm.TeamClaim.SetTeamID("p1", name, "other", "team-other"); err != nil {
+		return "", err
+	}
+	return d.teamDest.EnsureTeam(name, t)
+}
+
+func TestEnsureTarget_LostClaimUsesTheRecordedTeam(t *testing.T) {
+	stm := newTestStore(t)
+	dest := &takeoverDest{stm: stm}
+	teamID, _, err := NewOrchestrator(nil, dest).ensureTarget(Job{ProjectID: "p1", TeamName: "Sales", ChannelName: "c"}, stm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if teamID != "team-other" {
+		t.Fatalf("expected the team recorded by the new holder, got %q", teamID)
+	}
+	if dest.teams != 1 {
+		t.Fatalf("expected the orphan team to be the only one created, got %d", dest.teams)
+	}
+}
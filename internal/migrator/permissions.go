@@ -0,0 +1,114 @@
+package migrator
+
+import (
+	teamdest "example.com/go-migrator/internal/migrator/dest/teams"
+	zoomsrc "example.com/go-migrator/internal/migrator/source/zoom"
+	"example.com/go-migrator/internal/model"
+)
+
+// Permission is something a connector's token must be granted. Any of AnyOf
+// satisfies it, since Zoom offers both classic and granular scopes.
+type Permission struct {
+	Name    string
+	AnyOf   []string
+	Purpose string
+}
+
+// RequiredPermissions lists what migration needs from each connector type.
+var RequiredPermissions = map[model.ConnectorType][]Permission{
+	model.Teams: {
+		{Name: "Teamwork.Migrate.All", Purpose: "create teams and channels in migration mode and import messages"},
+		{Name: "Channel.Create", Purpose: "create channels"},
+		{Name: "TeamMember.ReadWrite.All", Purpose: "add members to migrated teams"},
+		{Name: "User.Read.All", AnyOf: []string{"User.Read.All", "Directory.Read.All"}, Purpose: "match and validate identity mappings"},
+	},
+	model.Zoom: {
+		{Name: "user:read:admin", AnyOf: []string{"user:read:admin", "user:read:list_users:admin"}, Purpose: "list users"},
+		{Name: "chat_channel:read:admin", AnyOf: []string{"chat_channel:read:admin", "team_chat:read:list_user_channels:admin"}, Purpose: "list channels"},
+		{Name: "team_chat:read:list_members:admin", AnyOf: []string{"team_chat:read:list_members:admin", "chat_channel:read:admin"}, Purpose: "list channel members"},
+		{Name: "chat_message:read:admin", AnyOf: []string{"chat_message:read:admin", "team_chat:read:list_user_messages:admin"}, Purpose: "read messages"},
+	},
+}
+
+// PermissionCheck is the outcome of one required permission.
+type PermissionCheck struct {
+	Permission string `json:"permission"`
+	Purpose    string `json:"purpose"`
+	Granted    bool   `json:"granted"`
+}
+
+// ConnectorTestReport is the result of testing a connector.
+type ConnectorTestReport struct {
+	ConnectorID string              `json:"connector_id"`
+	Type        model.ConnectorType `json:"type"`
+	Passed      bool                `json:"passed"`
+	// Error is set when no token could be obtained or decoded; the checks
+	// are then missing.
+	Error   string            `json:"error,omitempty"`
+	Granted []string          `json:"granted"`
+	Checks  []PermissionCheck `json:"checks"`
+	Missing []string          `json:"missing"`
+}
+
+// CheckPermissions compares the permissions granted to a token with what a
+// connector of the given type needs.
+func CheckPermissions(ctype model.ConnectorType, granted []string) ([]PermissionCheck, []string) {
+	have := make(map[string]bool, len(granted))
+	for _, g := range granted {
+		have[g] = true
+	}
+	checks := []PermissionCheck{}
+	missing := []string{}
+	for _, p := range RequiredPermissions[ctype] {
+		anyOf := p.AnyOf
+		if len(anyOf) == 0 {
+			anyOf = []string{p.Name}
+		}
+		ok := false
+		for _, name := range anyOf {
+			if have[name] {
+				ok = true
+				break
+			}
+		}
+		checks = append(checks, PermissionCheck{Permission: p.Name, Purpose: p.Purpose, Granted: ok})
+		if !ok {
+			missing = append(missing, p.Name)
+		}
+	}
+	return checks, missing
+}
+
+// TestConnector obtains a new token with the connector's credentials, not the
+// cached one, and checks the permissions granted to it.
+func TestConnector(conn *model.Connector) *ConnectorTestReport {
+	report := &ConnectorTestReport{ConnectorID: conn.ID, Type: conn.Type, Granted: []string{}}
+	var (
+		granted []string
+		err     error
+	)
+	switch conn.Type {
+	case model.Zoom:
+		var c *zoomsrc.Client
+		if c, err = zoomsrc.NewClientFromConnector(conn); err == nil {
+			granted, err = c.Scopes()
+		}
+	case model.Teams:
+		var c *teamdest.Client
+		if c, err = teamdest.NewClientFromConnector(conn); err == nil {
+			granted, err = c.Roles()
+		}
+	default:
+		err = CheckConnector(conn)
+	}
+	if err != nil {
+		report.Error = err.Error()
+		return report
+	}
+	if granted != nil {
+		report.Granted = granted
+	}
+	report.Checks, report.Missing = CheckPermissions(conn.Type, granted)
+	report.Passed = len(report.Missing) == 0
+	return report
+}
@@ -0,0 +1,34 @@
+package migrator
+
+import (
+	"reflect"
+	"testing"
+
+	"example.com/go-migrator/internal/model"
+)
+
+func TestCheckPermissions_Teams(t *testing.T) {
+	checks, missing := CheckPermissions(model.Teams, []string{"Teamwork.Migrate.All", "Directory.Read.All"})
+	if len(checks) != len(RequiredPermissions[model.Teams]) {
+		t.Fatalf("expected a check per required permission, got %d", len(checks))
+	}
+	want := []string{"Channel.Create", "TeamMember.ReadWrite.All"}
+	if !reflect.DeepEqual(missing, want) {
+		t.Fatalf("missing: want %v got %v", want, missing)
+	}
+}
+
+func TestCheckPermissions_ZoomGranularScopes(t *testing.T) {
+	granted := []string{
+		"user:read:list_users:admin",
+		"team_chat:read:list_user_channels:admin",
+		"team_chat:read:list_members:admin",
+		"team_chat:read:list_user_messages:admin",
+	}
+	if _, missing := CheckPermissions(model.Zoom, granted); len(missing) != 0 {
+		t.Fatalf("expected granular scopes to pass, missing %v", missing)
+	}
+	if _, missing := CheckPermissions(model.Zoom, nil); len(missing) != len(RequiredPermissions[model.Zoom]) {
+		t.Fatalf("expected everything missing, got %v", missing)
+	}
+}
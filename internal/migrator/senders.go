@@ -0,0 +1,196 @@
+package migrator
+
+import (
+	"fmt"
+	"strings"
+
+	migmodel "example.com/go-migrator/internal/migrator/model"
+	"example.com/go-migrator/internal/model"
+	"example.com/go-migrator/internal/store"
+)
+
+// sender is the Teams identity a Zoom message is posted as.
+type sender struct {
+	teamsUserID string
+	displayName string
+	// attribute is set when the body must name the original Zoom sender
+	attribute bool
+	zoomName  string
+	zoomEmail string
+}
+
+// senderResolver maps Zoom senders to Teams identities, applying the
+// project's policy to senders without a mapping.
+type senderResolver struct {
+	stm          *store.StoreManager
+	projectID    string
+	policy       model.UnmappedSenderPolicy
+	fallbackID   string
+	fallbackName string
+	// members maps channel member IDs to the member record, and byEmail
+	// lower-cased emails, for messages that carry no member ID
+	members  map[string]migmodel.ZoomChannelMember
+	byEmail  map[string]migmodel.ZoomChannelMember
+	cache    map[string]*sender
+	unmapped map[string]*model.UnmappedSender
+	order    []string
+	// invalid lists the mappings used that failed or missed validation
+	invalid []string
+}
+
+func newSenderResolver(job Job, members []migmodel.ZoomChannelMember, stm *store.StoreManager) *senderResolver {
+	r := &senderResolver{
+		stm:          stm,
+		projectID:    job.ProjectID,
+		policy:       job.UnmappedPolicy,
+		fallbackID:   job.FallbackUserID,
+		fallbackName: job.FallbackDisplayName,
+		members:      make(map[string]migmodel.ZoomChannelMember, len(members)),
+		byEmail:      make(map[string]migmodel.ZoomChannelMember, len(members)),
+		cache:        make(map[string]*sender),
+		unmapped:     make(map[string]*model.UnmappedSender),
+	}
+	if r.policy == "" {
+		r.policy = model.UnmappedFail
+	}
+	for _, m := range members {
+		if m.MemberID != "" {
+			r.members[m.MemberID] = m
+		}
+		if m.Email != "" {
+			r.byEmail[strings.ToLower(m.Email)] = m
+		}
+	}
+	return r
+}
+
+// resolve returns the Teams identity for a message's sender. For unmapped
+// senders under the fail policy it returns nil; the caller must check
+// unmappedSenders before posting anything.
+func (r *senderResolver) resolve(zm migmodel.ZoomMessage) (*sender, error) {
+	zoomUserID, email, name, key := r.identify(zm)
+	if s, ok := r.cache[key]; ok {
+		if u, ok := r.unmapped[key]; ok {
+			u.Messages++
+		}
+		return s, nil
+	}
+
+	// project overrides and aliases are applied by the store
+	identity, err := r.stm.Identity.Resolve(r.projectID, zoomUserID)
+	if err == nil {
+		if identity.ValidationStatus != model.IdentityValid || identity.TeamsUserID == "" {
+			// Graph would reject its messages part-way through the import
+			r.invalid = append(r.invalid, invalidMapping(identity))
+			r.cache[key] = nil
+			return nil, nil
+		}
+		s := &sender{teamsUserID: identity.TeamsUserID, displayName: identity.TeamsUserDisplayName}
+		r.cache[key] = s
+		return s, nil
+	}
+	if err != nil && err != store.ErrNotFound {
+		return nil, fmt.Errorf("unable to get identity by zoom user ID: %w", err)
+	}
+
+	r.unmapped[key] = &model.UnmappedSender{ZoomUserID: zoomUserID, Email: email, DisplayName: name, Messages: 1}
+	r.order = append(r.order, key)
+	var s *sender
+	switch r.policy {
+	case model.UnmappedFallback:
+		s = &sender{teamsUserID: r.fallbackID, displayName: r.fallbackName}
+	case model.UnmappedFallbackAttributed:
+		s = &sender{teamsUserID: r.fallbackID, displayName: r.fallbackName, attribute: true, zoomName: name, zoomEmail: email}
+	}
+	r.cache[key] = s
+	return s, nil
+}
+
+// lookup returns the sender of a message that was resolved before, without
+// counting the message again. Senders not seen before are resolved.
+func (r *senderResolver) lookup(zm migmodel.ZoomMessage) (*sender, error) {
+	if s, ok := r.cache[r.key(zm)]; ok {
+		return s, nil
+	}
+	return r.resolve(zm)
+}
+
+// identify returns the Zoom user behind a message's sender, preferring the
+// member record, and the key senders are cached under.
+func (r *senderResolver) identify(zm migmodel.ZoomMessage) (zoomUserID, email, name, key string) {
+	zoomUserID, email, name = zm.SendMemberID, zm.Sender, zm.SenderDisplayName
+	m, ok := r.members[zm.SendMemberID]
+	if !ok && zm.Sender != "" {
+		m, ok = r.byEmail[strings.ToLower(zm.Sender)]
+	}
+	if ok {
+		zoomUserID = m.ID
+		if m.Email != "" {
+			email = m.Email
+		}
+		if m.Name != "" {
+			name = m.Name
+		}
+	}
+	key = zoomUserID
+	if key == "" {
+		key = email
+	}
+	return zoomUserID, email, name, key
+}
+
+func (r *senderResolver) key(zm migmodel.ZoomMessage) string {
+	_, _, _, key := r.identify(zm)
+	return key
+}
+
+// unmappedSenders returns the senders without a mapping in the order they
+// were first seen.
+func (r *senderResolver) unmappedSenders() []model.UnmappedSender {
+	out := make([]model.UnmappedSender, 0, len(r.order))
+	for _, k := range r.order {
+		out = append(out, *r.unmapped[k])
+	}
+	return out
+}
+
+// check fails when senders have a mapping that is not valid, or unmapped
+// senders cannot be posted under the policy.
+func (r *senderResolver) check() error {
+	if err := invalidMappings(r.invalid); err != nil {
+		return err
+	}
+	if len(r.order) == 0 {
+		return nil
+	}
+	switch r.policy {
+	case model.UnmappedFallback, model.UnmappedFallbackAttributed:
+		if r.fallbackID == "" {
+			return fmt.Errorf("%d senders have no identity mapping and no fallback account is configured", len(r.order))
+		}
+		return nil
+	default:
+		return fmt.Errorf("%d senders have no identity mapping", len(r.order))
+	}
+}
+
+// invalidMapping describes a mapping that is not valid for error messages.
+// A mapping that only names a UPN is usable once validation has resolved the
+// UPN to a Teams user ID.
+func invalidMapping(id *model.Identity) string {
+	status := id.ValidationStatus
+	switch {
+	case status == "":
+		status = "not validated"
+	case status == model.IdentityValid && id.TeamsUserID == "":
+		status = "UPN not resolved to a teams_user_id"
+	}
+	return fmt.Sprintf("%s (%s)", id.ZoomUserID, status)
+}
+
+func invalidMappings(invalid []string) error {
+	if len(invalid) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d identity mappings are not valid: %s; run POST /projects/{id}/identities/validate and fix broken mappings first", len(invalid), strings.Join(invalid, ", "))
+}
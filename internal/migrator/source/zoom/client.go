@@ -2,21 +2,83 @@ package zoom
 
 import (
 	"context"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	migmodel "example.com/go-migrator/internal/migrator/model"
+	"example.com/go-migrator/internal/migrator/oauth"
+	"example.com/go-migrator/internal/model"
 )
 
+// defaultBaseURL is the Zoom REST API root.
+const defaultBaseURL = "https://api.zoom.us/v2"
+
 type Client struct {
-	token string
+	tokens  *oauth.Source
+	limits  *Limiter
+	baseURL string
+}
+
+// Credentials are the Server-to-Server OAuth credentials of a Zoom account.
+// They are the JSON Data of a zoom Connector.
+type Credentials struct {
+	AccountID    string `json:"account_id"`
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+}
+
+// Validate reports the first missing credential.
+func (c Credentials) Validate() error {
+	if c.AccountID == "" {
+		return fmt.Errorf("account_id not set")
+	}
+	if c.ClientID == "" {
+		return fmt.Errorf("client_id not set")
+	}
+	if c.ClientSecret == "" {
+		return fmt.Errorf("client_secret not set")
+	}
+	return nil
+}
+
+// ParseCredentials reads the credentials stored in a zoom Connector.
+func ParseCredentials(conn *model.Connector) (Credentials, error) {
+	var creds Credentials
+	if conn.Type != model.Zoom {
+		return creds, fmt.Errorf("connector %s is a %s connector, not zoom", conn.ID, conn.Type)
+	}
+	if err := json.Unmarshal([]byte(conn.Data), &creds); err != nil {
+		return creds, fmt.Errorf("connector %s: invalid credentials: %w", conn.ID, err)
+	}
+	if err := creds.Validate(); err != nil {
+		return creds, fmt.Errorf("connector %s: %w", conn.ID, err)
+	}
+	return creds, nil
+}
+
+// NewClientFromConnector obtains a token for the account of a zoom Connector.
+func NewClientFromConnector(conn *model.Connector) (*Client, error) {
+	creds, err := ParseCredentials(conn)
+	if err != nil {
+		return nil, err
+	}
+	return NewClient(creds)
 }
 
+// NewClientFromEnv obtains a token for the account configured by
+// ZOOM_ACCOUNT_ID, ZOOM_CLIENT_ID and ZOOM_CLIENT_SECRET.
 func NewClientFromEnv() (*Client, error) {
 	account_id := os.Getenv("ZOOM_ACCOUNT_ID")
 	client_id := os.Getenv("ZOOM_CLIENT_ID")
@@ -30,12 +92,35 @@ func NewClientFromEnv() (*Client, error) {
 	if client_secret == "" {
 		return nil, fmt.Errorf("ZOOM_CLIENT_SECRET not set")
 	}
+	return NewClient(Credentials{AccountID: account_id, ClientID: client_id, ClientSecret: client_secret})
+}
+
+// NewClient creates a client for creds. Clients built from the same
+// credentials share one token, which is refreshed before it expires, and
+// clients of the same account share one rate limiter. The first token is
+// obtained right away so bad credentials fail here.
+func NewClient(creds Credentials) (*Client, error) {
+	sum := sha256.Sum256([]byte(creds.AccountID + "\x00" + creds.ClientID + "\x00" + creds.ClientSecret))
+	key := "zoom:" + hex.EncodeToString(sum[:])
+	limits, err := sharedLimiter(creds.AccountID)
+	if err != nil {
+		return nil, err
+	}
+	tokens := oauth.Shared(key, func() (*oauth.Token, error) { return fetchToken(creds) })
+	if _, err := tokens.Token(); err != nil {
+		return nil, err
+	}
+	return &Client{tokens: tokens, limits: limits, baseURL: defaultBaseURL}, nil
+}
 
+// fetchToken requests an account credentials token.
+func fetchToken(creds Credentials) (*oauth.Token, error) {
+	account_id, client_id, client_secret := creds.AccountID, creds.ClientID, creds.ClientSecret
 	tokenURL := fmt.Sprintf("https://api.zoom.us/oauth/token?grant_type=account_credentials&account_id=%s", account_id)
 	ctx := context.Background()
 	req, _ := http.NewRequestWithContext(ctx, "POST", tokenURL, nil)
-	creds := base64.StdEncoding.EncodeToString([]byte(client_id + ":" + client_secret))
-	req.Header.Set("Authorization", "Basic "+creds)
+	basic := base64.StdEncoding.EncodeToString([]byte(client_id + ":" + client_secret))
+	req.Header.Set("Authorization", "Basic "+basic)
 	req.Header.Set("Accept", "application/json")
 	log.Printf("zoom: requesting token POST %s", tokenURL)
 	resp, err := http.DefaultClient.Do(req)
@@ -51,115 +136,281 @@ func NewClientFromEnv() (*Client, error) {
 	}
 	var respData struct {
 		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+		Scope       string `json:"scope"`
 	}
 	if err := json.Unmarshal(body, &respData); err != nil {
 		log.Printf("zoom: invalid token response: %v: %s", err, string(body))
 		return nil, fmt.Errorf("invalid token response: %v: %s", err, string(body))
 	}
-	log.Printf("zoom: obtained token (len=%d)", len(respData.AccessToken))
+	log.Printf("zoom: obtained token (len=%d, expires in %ds)", len(respData.AccessToken), respData.ExpiresIn)
 
-	return &Client{token: respData.AccessToken}, nil
+	tok := &oauth.Token{AccessToken: respData.AccessToken, Scopes: strings.Fields(respData.Scope)}
+	if respData.ExpiresIn > 0 {
+		tok.Expiry = time.Now().Add(time.Duration(respData.ExpiresIn) * time.Second)
+	}
+	return tok, nil
 }
 
-func (c *Client) GetUsers() ([]migmodel.ZoomUser, error) {
-	ctx := context.Background()
-	url := "https://api.zoom.us/v2/users"
-	req, _ := http.NewRequestWithContext(ctx, "GET", url, nil)
-	req.Header.Set("Authorization", "Bearer "+c.token)
-	req.Header.Set("Accept", "application/json")
-	resp, err := http.DefaultClient.Do(req)
+// Scopes returns the OAuth scopes granted to the client's credentials. It
+// fetches a new token, so permissions granted since the cached token was
+// issued are included.
+func (c *Client) Scopes() ([]string, error) {
+	tok, err := c.tokens.Refresh()
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode >= 400 {
-		b, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("zoom api error: %s: %s", resp.Status, string(b))
+	return tok.Scopes, nil
+}
+
+// get performs a GET against the Zoom API and decodes the JSON response into
+// out. Requests are paced by the client's limiter for cat. A 429 holds back
+// every request of its category until Retry-After; 429 and 5xx responses are
+// retried up to maxRetries times.
+func (c *Client) get(cat Category, path string, query url.Values, out any) error {
+	u := c.baseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
 	}
-	var parsed struct {
-		Users []migmodel.ZoomUser `json:"users"`
+	for attempt := 1; ; attempt++ {
+		if err := c.limits.Wait(cat); err != nil {
+			return err
+		}
+		req, _ := http.NewRequestWithContext(context.Background(), "GET", u, nil)
+		req.Header.Set("Accept", "application/json")
+		resp, err := c.tokens.Do(req)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode < 400 {
+			err := json.NewDecoder(resp.Body).Decode(out)
+			resp.Body.Close()
+			return err
+		}
+		b, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		apiErr := fmt.Errorf("zoom api error: %s: %s", resp.Status, string(b))
+		if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode < 500 {
+			return apiErr
+		}
+
+		now := c.limits.now()
+		wait := retryAfter(resp.Header, now)
+		if wait == 0 {
+			wait = backoff(attempt)
+		}
+		if resp.StatusCode == http.StatusTooManyRequests {
+			limited := limitCategory(resp.Header, cat)
+			c.limits.Block(limited, now.Add(wait))
+			if wait > maxRetryWait {
+				return &RateLimitError{Category: limited, RetryAt: now.Add(wait)}
+			}
+		}
+		if attempt > maxRetries || wait > maxRetryWait {
+			return apiErr
+		}
+		log.Printf("zoom: %s on %s, retry %d in %s", resp.Status, path, attempt, wait.Round(time.Millisecond))
+		// the 429 may have named another category than cat, so the next Wait
+		// need not hold this request back
+		c.limits.sleep(wait)
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
-		return nil, err
+}
+
+// Pager walks a paginated Zoom list endpoint one item at a time, fetching
+// the next page when the current one is used up:
+//
+//	for it.Next() {
+//		use(it.Item())
+//	}
+//	if err := it.Err(); err != nil { ... }
+//
+// Only one page is held in memory at a time.
+type Pager[T any] struct {
+	c     *Client
+	cat   Category
+	path  string
+	query url.Values
+	// key is the JSON field of the response that holds the items
+	key   string
+	items []T
+	pos   int
+	pages int
+	done  bool
+	err   error
+}
+
+func newPager[T any](c *Client, cat Category, path string, query url.Values, key string) *Pager[T] {
+	return &Pager[T]{c: c, cat: cat, path: path, query: query, key: key}
+}
+
+// Next advances to the next item and reports whether there is one.
+func (p *Pager[T]) Next() bool {
+	// a page may be empty and still carry a next_page_token
+	for p.pos >= len(p.items) {
+		if p.done || p.err != nil {
+			return false
+		}
+		p.fetch()
 	}
-	return parsed.Users, nil
+	p.pos++
+	return true
 }
 
-func (c *Client) GetUserChannels(userID string) ([]migmodel.ZoomChannel, error) {
-	ctx := context.Background()
-	url := fmt.Sprintf("https://api.zoom.us/v2/chat/users/%s/channels", userID)
-	req, _ := http.NewRequestWithContext(ctx, "GET", url, nil)
-	req.Header.Set("Authorization", "Bearer "+c.token)
-	req.Header.Set("Accept", "application/json")
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return nil, err
+// Item returns the current item.
+func (p *Pager[T]) Item() T { return p.items[p.pos-1] }
+
+// Err returns the error that stopped the iteration, if any.
+func (p *Pager[T]) Err() error { return p.err }
+
+func (p *Pager[T]) fetch() {
+	var page map[string]json.RawMessage
+	if err := p.c.get(p.cat, p.path, p.query, &page); err != nil {
+		p.err = err
+		return
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode >= 400 {
-		b, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("zoom api error: %s: %s", resp.Status, string(b))
+	p.pages++
+	p.items, p.pos = nil, 0
+	if raw, ok := page[p.key]; ok {
+		if err := json.Unmarshal(raw, &p.items); err != nil {
+			p.err = fmt.Errorf("decode %s page %d: %w", p.key, p.pages, err)
+			return
+		}
 	}
-	var parsed struct {
-		Channels []migmodel.ZoomChannel `json:"channels"`
+	var token string
+	if raw, ok := page["next_page_token"]; ok {
+		if err := json.Unmarshal(raw, &token); err != nil {
+			p.err = fmt.Errorf("decode next_page_token: %w", err)
+			return
+		}
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
-		return nil, err
+	p.done = token == ""
+	p.query.Set("next_page_token", token)
+}
+
+// collect drains a pager into a slice.
+func collect[T any](p *Pager[T]) ([]T, error) {
+	var items []T
+	for p.Next() {
+		items = append(items, p.Item())
 	}
-	return parsed.Channels, nil
+	return items, p.Err()
 }
 
-func (c *Client) FetchMessages(userID string, channelID string) ([]migmodel.ZoomMessage, error) {
-	ctx := context.Background()
+func pageQuery(size int) url.Values {
+	return url.Values{"page_size": {strconv.Itoa(size)}}
+}
 
-	defaultFrom := "1970-01-01T00:00:00Z"
-	url := fmt.Sprintf("https://api.zoom.us/v2/chat/users/%s/messages?to_channel=%s&from=%s&page_size=50", userID, channelID, defaultFrom)
+// IterateUsers walks every user of the account.
+func (c *Client) IterateUsers() *Pager[migmodel.ZoomUser] {
+	return newPager[migmodel.ZoomUser](c, Medium, "/users", pageQuery(300), "users")
+}
 
-	req, _ := http.NewRequestWithContext(ctx, "GET", url, nil)
-	req.Header.Set("Authorization", "Bearer "+c.token)
-	req.Header.Set("Accept", "application/json")
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-	if resp.StatusCode >= 400 {
-		b, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("zoom api error: %s: %s", resp.Status, string(b))
+func (c *Client) GetUsers() ([]migmodel.ZoomUser, error) {
+	return collect(c.IterateUsers())
+}
+
+// GetUser returns a user of the account by ID or email.
+func (c *Client) GetUser(userID string) (migmodel.ZoomUser, error) {
+	var u migmodel.ZoomUser
+	err := c.get(Light, "/users/"+url.PathEscape(userID), nil, &u)
+	return u, err
+}
+
+// IterateUserChannels walks the channels a user is a member of.
+func (c *Client) IterateUserChannels(userID string) *Pager[migmodel.ZoomChannel] {
+	return newPager[migmodel.ZoomChannel](c, Medium, "/chat/users/"+url.PathEscape(userID)+"/channels", pageQuery(50), "channels")
+}
+
+func (c *Client) GetUserChannels(userID string) ([]migmodel.ZoomChannel, error) {
+	return collect(c.IterateUserChannels(userID))
+}
+
+// IterateMessages walks the channel's messages sent at or after from, an
+// RFC3339 timestamp; an empty from walks the whole history.
+func (c *Client) IterateMessages(userID string, channelID string, from string) migmodel.Iterator[migmodel.ZoomMessage] {
+	return c.messages(userID, channelID, from)
+}
+
+func (c *Client) messages(userID string, channelID string, from string) *Pager[migmodel.ZoomMessage] {
+	return c.conversation(userID, "to_channel", channelID, from)
+}
+
+// conversation walks the messages of a channel or, with to set to
+// "to_contact", of the 1:1 conversation with a contact.
+func (c *Client) conversation(userID string, to string, id string, from string) *Pager[migmodel.ZoomMessage] {
+	if from == "" {
+		from = "1970-01-01T00:00:00Z"
 	}
+	query := pageQuery(50)
+	query.Set(to, id)
+	query.Set("from", from)
+	return newPager[migmodel.ZoomMessage](c, Medium, "/chat/users/"+url.PathEscape(userID)+"/messages", query, "messages")
+}
+
+// IterateContactMessages walks the 1:1 messages between the user and a
+// contact sent at or after from.
+func (c *Client) IterateContactMessages(userID string, contactID string, from string) migmodel.Iterator[migmodel.ZoomMessage] {
+	return c.conversation(userID, "to_contact", contactID, from)
+}
 
-	var parsed migmodel.ZoomMessagesResponse
-	if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
+// FetchMessages returns the whole result of IterateMessages. Prefer the
+// iterator for channels with a long history.
+func (c *Client) FetchMessages(userID string, channelID string, from string) ([]migmodel.ZoomMessage, error) {
+	msgs, err := collect(c.messages(userID, channelID, from))
+	if err != nil {
 		return nil, err
 	}
+	log.Printf("zoom: fetched %d messages from channel %s", len(msgs), channelID)
+	return msgs, nil
+}
 
-	log.Printf("zoom: fetched %d messages from channel %s", len(parsed.Messages), channelID)
-	// Log message content
-	for _, msg := range parsed.Messages {
-		log.Printf("zoom: message from %s: %s", msg.Sender, msg.Message)
-	}
+// IterateReplies walks the replies in the thread of a channel message.
+func (c *Client) IterateReplies(userID string, channelID string, messageID string) *Pager[migmodel.ZoomMessage] {
+	return c.thread(userID, "to_channel", channelID, messageID)
+}
 
-	return parsed.Messages, nil
+func (c *Client) thread(userID string, to string, id string, messageID string) *Pager[migmodel.ZoomMessage] {
+	query := pageQuery(50)
+	query.Set(to, id)
+	path := "/chat/users/" + url.PathEscape(userID) + "/messages/" + url.PathEscape(messageID) + "/thread"
+	return newPager[migmodel.ZoomMessage](c, Medium, path, query, "messages")
 }
 
-func (c *Client) FetchChannelMembers(userID string, channelID string) ([]migmodel.ZoomChannelMember, error) {
-	ctx := context.Background()
-	url := fmt.Sprintf("https://api.zoom.us/v2/chat/users/%s/channels/%s/members", userID, channelID)
-	req, _ := http.NewRequestWithContext(ctx, "GET", url, nil)
-	req.Header.Set("Authorization", "Bearer "+c.token)
-	req.Header.Set("Accept", "application/json")
-	resp, err := http.DefaultClient.Do(req)
+// FetchReplies returns the replies to a channel message, oldest first.
+func (c *Client) FetchReplies(userID string, channelID string, messageID string) ([]migmodel.ZoomMessage, error) {
+	return oldestFirst(c.IterateReplies(userID, channelID, messageID))
+}
+
+// FetchContactReplies returns the replies to a 1:1 message, oldest first.
+func (c *Client) FetchContactReplies(userID string, contactID string, messageID string) ([]migmodel.ZoomMessage, error) {
+	return oldestFirst(c.thread(userID, "to_contact", contactID, messageID))
+}
+
+func oldestFirst(p *Pager[migmodel.ZoomMessage]) ([]migmodel.ZoomMessage, error) {
+	replies, err := collect(p)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode >= 400 {
-		b, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("zoom api error: %s: %s", resp.Status, string(b))
-	}
-	var parsed migmodel.ZoomChannelMembersResponse
-	if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
-		return nil, err
+	sort.SliceStable(replies, func(i, j int) bool { return sentAt(replies[i]).Before(sentAt(replies[j])) })
+	return replies, nil
+}
+
+// sentAt returns when a message was sent, from its millisecond timestamp or
+// else its RFC3339 date_time.
+func sentAt(m migmodel.ZoomMessage) time.Time {
+	if m.Timestamp > 0 {
+		return time.UnixMilli(m.Timestamp)
 	}
-	return parsed.Members, nil
+	t, _ := time.Parse(time.RFC3339, m.DateTime)
+	return t
+}
+
+// IterateChannelMembers walks the members of a channel.
+func (c *Client) IterateChannelMembers(userID string, channelID string) *Pager[migmodel.ZoomChannelMember] {
+	path := "/chat/users/" + url.PathEscape(userID) + "/channels/" + url.PathEscape(channelID) + "/members"
+	return newPager[migmodel.ZoomChannelMember](c, Medium, path, pageQuery(100), "members")
+}
+
+func (c *Client) FetchChannelMembers(userID string, channelID string) ([]migmodel.ZoomChannelMember, error) {
+	return collect(c.IterateChannelMembers(userID, channelID))
 }
@@ -0,0 +1,101 @@
+package zoom
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"example.com/go-migrator/internal/migrator/oauth"
+)
+
+func TestIterateMessages_FollowsNextPageToken(t *testing.T) {
+	var tokens []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/chat/users/u1/messages" || r.URL.Query().Get("to_channel") != "c1" {
+			t.Errorf("unexpected request %s", r.URL)
+		}
+		token := r.URL.Query().Get("next_page_token")
+		tokens = append(tokens, token)
+		switch token {
+		case "":
+			fmt.Fprint(w, `{"messages":[{"id":"m1"},{"id":"m2"}],"next_page_token":"p2"}`)
+		case "p2":
+			// Zoom may return an empty page that still has a next page
+			fmt.Fprint(w, `{"messages":[],"next_page_token":"p3"}`)
+		case "p3":
+			fmt.Fprint(w, `{"messages":[{"id":"m3"}],"next_page_token":""}`)
+		}
+	}))
+	defer srv.Close()
+
+	c := testClient(srv.URL)
+	msgs, err := c.FetchMessages("u1", "c1", "")
+	if err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	if len(msgs) != 3 || msgs[2].ID != "m3" {
+		t.Fatalf("expected all three messages, got %+v", msgs)
+	}
+	if fmt.Sprint(tokens) != "[ p2 p3]" {
+		t.Fatalf("unexpected page tokens %v", tokens)
+	}
+}
+
+func TestPager_StopsOnError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("next_page_token") == "" {
+			fmt.Fprint(w, `{"users":[{"id":"a"}],"next_page_token":"p2"}`)
+			return
+		}
+		http.Error(w, "boom", http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	c := testClient(srv.URL)
+	it := c.IterateUsers()
+	n := 0
+	for it.Next() {
+		n++
+	}
+	if n != 1 || it.Err() == nil {
+		t.Fatalf("expected one user then an error, got %d users and %v", n, it.Err())
+	}
+}
+
+func TestFetchReplies_OldestFirst(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/chat/users/u1/messages/m1/thread" {
+			t.Errorf("unexpected request %s", r.URL)
+		}
+		fmt.Fprint(w, `{"messages":[
+			{"id":"r3","timestamp":3000},
+			{"id":"r1","date_time":"1970-01-01T00:00:01Z"},
+			{"id":"r2","timestamp":2000}
+		]}`)
+	}))
+	defer srv.Close()
+
+	c := testClient(srv.URL)
+	replies, err := c.FetchReplies("u1", "c1", "m1")
+	if err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	var ids []string
+	for _, r := range replies {
+		ids = append(ids, r.ID)
+	}
+	if fmt.Sprint(ids) != "[r1 r2 r3]" {
+		t.Fatalf("expected replies oldest first, got %v", ids)
+	}
+}
+
+// testClient returns a client for a test server. Its limiter paces nothing
+// and retries without sleeping.
+func testClient(baseURL string) *Client {
+	tokens := oauth.NewSource(func() (*oauth.Token, error) { return &oauth.Token{AccessToken: "t"}, nil })
+	limits := NewLimiter(nil)
+	limits.sleep = func(time.Duration) {}
+	return &Client{tokens: tokens, limits: limits, baseURL: baseURL}
+}
@@ -0,0 +1,237 @@
+package zoom
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Category is a Zoom rate limit category. Zoom assigns every endpoint one and
+// limits the requests per second, or for resource-intensive requests per
+// minute, of each category across the whole account.
+type Category string
+
+const (
+	Light             Category = "light"
+	Medium            Category = "medium"
+	Heavy             Category = "heavy"
+	ResourceIntensive Category = "resource-intensive"
+)
+
+// DefaultLimits are the requests per second allowed per category, Zoom's
+// limits for Pro accounts: resource-intensive requests are limited to 10 a
+// minute. Larger plans may raise them with ZOOM_RATE_LIMITS.
+var DefaultLimits = map[Category]float64{
+	Light:             30,
+	Medium:            20,
+	Heavy:             10,
+	ResourceIntensive: 10.0 / 60,
+}
+
+// perMinute lists the categories Zoom counts per minute rather than per
+// second. ZOOM_RATE_LIMITS gives their limits in requests per minute.
+var perMinute = map[Category]bool{ResourceIntensive: true}
+
+// maxRetries is how many times a request answered with 429 or 5xx is retried.
+const maxRetries = 4
+
+// maxRetryWait is the longest a request waits for Zoom to accept requests
+// again. Longer waits, such as for a spent daily limit, fail at once.
+const maxRetryWait = time.Minute
+
+// RateLimitError is returned when Zoom asked to wait longer than the client
+// is willing to.
+type RateLimitError struct {
+	Category Category
+	RetryAt  time.Time
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("zoom rate limit (%s) exceeded until %s", e.Category, e.RetryAt.UTC().Format(time.RFC3339))
+}
+
+// ParseLimits reads a comma separated list of category=requests per second
+// pairs, e.g. "medium=60,heavy=40", on top of DefaultLimits. Limits of the
+// resource-intensive category are requests per minute.
+func ParseLimits(s string) (map[Category]float64, error) {
+	limits := make(map[Category]float64, len(DefaultLimits))
+	for cat, rps := range DefaultLimits {
+		limits[cat] = rps
+	}
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid rate limit %q, want category=requests per second", entry)
+		}
+		cat := Category(strings.ToLower(strings.TrimSpace(name)))
+		if _, known := DefaultLimits[cat]; !known {
+			return nil, fmt.Errorf("unknown rate limit category %q", name)
+		}
+		rps, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil || rps <= 0 {
+			return nil, fmt.Errorf("invalid rate limit for %s: %q", cat, value)
+		}
+		if perMinute[cat] {
+			rps /= 60
+		}
+		limits[cat] = rps
+	}
+	return limits, nil
+}
+
+// Limiter paces requests per category and holds them back while Zoom has
+// asked to wait. One limiter is shared by every client of an account, so all
+// workers in the process stay under the account's limits together. It is
+// safe for concurrent use.
+type Limiter struct {
+	mu      sync.Mutex
+	buckets map[Category]*bucket
+	now     func() time.Time
+	sleep   func(time.Duration)
+}
+
+// bucket is a token bucket holding up to a second's worth of requests.
+type bucket struct {
+	rate   float64
+	tokens float64
+	last   time.Time
+	// until is when Zoom accepts requests again after a 429
+	until time.Time
+}
+
+// NewLimiter creates a limiter allowing limits requests per second per
+// category. Categories without a limit are not paced.
+func NewLimiter(limits map[Category]float64) *Limiter {
+	l := &Limiter{buckets: make(map[Category]*bucket), now: time.Now, sleep: time.Sleep}
+	for cat, rps := range limits {
+		l.buckets[cat] = &bucket{rate: rps, tokens: burst(rps)}
+	}
+	return l
+}
+
+func burst(rps float64) float64 {
+	if rps < 1 {
+		return 1
+	}
+	return rps
+}
+
+var sharedLimiters sync.Map
+
+// sharedLimiter returns the process-wide limiter for a Zoom account, creating
+// it from ZOOM_RATE_LIMITS the first time. Zoom counts requests per account,
+// so apps and rotated secrets of one account share it.
+func sharedLimiter(accountID string) (*Limiter, error) {
+	key := "zoom:" + accountID
+	if l, ok := sharedLimiters.Load(key); ok {
+		return l.(*Limiter), nil
+	}
+	limits, err := ParseLimits(os.Getenv("ZOOM_RATE_LIMITS"))
+	if err != nil {
+		return nil, fmt.Errorf("ZOOM_RATE_LIMITS: %w", err)
+	}
+	l, _ := sharedLimiters.LoadOrStore(key, NewLimiter(limits))
+	return l.(*Limiter), nil
+}
+
+// Wait blocks until a request of cat may be sent. It fails without waiting
+// if Zoom asked to hold cat back for longer than maxRetryWait.
+func (l *Limiter) Wait(cat Category) error {
+	l.mu.Lock()
+	b, ok := l.buckets[cat]
+	if !ok {
+		l.mu.Unlock()
+		return nil
+	}
+	now := l.now()
+	if b.until.Sub(now) > maxRetryWait {
+		l.mu.Unlock()
+		return &RateLimitError{Category: cat, RetryAt: b.until}
+	}
+	if !b.last.IsZero() {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if max := burst(b.rate); b.tokens > max {
+			b.tokens = max
+		}
+	}
+	b.last = now
+	b.tokens--
+	var wait time.Duration
+	if b.tokens < 0 {
+		wait = time.Duration(-b.tokens / b.rate * float64(time.Second))
+	}
+	if blocked := b.until.Sub(now); blocked > wait {
+		wait = blocked
+	}
+	l.mu.Unlock()
+	if wait > 0 {
+		l.sleep(wait)
+	}
+	return nil
+}
+
+// Block holds back requests of cat until t.
+func (l *Limiter) Block(cat Category, t time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b, ok := l.buckets[cat]
+	if !ok {
+		b = &bucket{}
+		l.buckets[cat] = b
+	}
+	if t.After(b.until) {
+		b.until = t
+	}
+}
+
+// limitCategory returns the category a 429 names in X-RateLimit-Category, or
+// fallback if it names none or an unknown one. X-RateLimit-Type only says
+// whether the per-second (QPS) or the daily limit was hit.
+func limitCategory(h http.Header, fallback Category) Category {
+	cat := Category(strings.ToLower(strings.TrimSpace(h.Get("X-RateLimit-Category"))))
+	if _, ok := DefaultLimits[cat]; ok {
+		return cat
+	}
+	return fallback
+}
+
+// retryAfter reads Retry-After, which Zoom sends as seconds, an HTTP date or,
+// for daily limits, an RFC3339 timestamp. It returns 0 if there is none.
+func retryAfter(h http.Header, now time.Time) time.Duration {
+	v := strings.TrimSpace(h.Get("Retry-After"))
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		return time.Duration(secs) * time.Second
+	}
+	t, err := http.ParseTime(v)
+	if err != nil {
+		if t, err = time.Parse(time.RFC3339, v); err != nil {
+			return 0
+		}
+	}
+	if d := t.Sub(now); d > 0 {
+		return d
+	}
+	return 0
+}
+
+// backoff is the wait before retry n (from 1) when Zoom did not say how long
+// to wait: 1s doubling up to 30s, with jitter so workers do not retry in step.
+func backoff(n int) time.Duration {
+	d := time.Second << (n - 1)
+	if d > 30*time.Second {
+		d = 30 * time.Second
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
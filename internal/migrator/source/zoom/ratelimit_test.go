@@ -0,0 +1,259 @@
+package zoom
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// fakeClock stands in for time.Now and time.Sleep; sleeping advances it.
+type fakeClock struct {
+	now   time.Time
+	slept []time.Duration
+}
+
+func (f *fakeClock) Now() time.Time { return f.now }
+
+func (f *fakeClock) Sleep(d time.Duration) {
+	f.slept = append(f.slept, d)
+	f.now = f.now.Add(d)
+}
+
+func limitedClient(baseURL string, limits map[Category]float64) (*Client, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)}
+	c := testClient(baseURL)
+	c.limits = NewLimiter(limits)
+	c.limits.now, c.limits.sleep = clock.Now, clock.Sleep
+	return c, clock
+}
+
+func TestLimiter_PacesPerCategory(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)}
+	l := NewLimiter(map[Category]float64{Medium: 2, Heavy: 1})
+	l.now, l.sleep = clock.Now, clock.Sleep
+
+	for i := 0; i < 3; i++ {
+		if err := l.Wait(Medium); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if fmt.Sprint(clock.slept) != "[500ms]" {
+		t.Fatalf("third medium request should wait for the bucket to refill, slept %v", clock.slept)
+	}
+	if err := l.Wait(Heavy); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Wait(Light); err != nil {
+		t.Fatal(err)
+	}
+	if len(clock.slept) != 1 {
+		t.Fatalf("other categories have their own buckets, slept %v", clock.slept)
+	}
+}
+
+func TestGet_RetriesAfter429(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.Header().Set("Retry-After", "3")
+			w.Header().Set("X-RateLimit-Type", "QPS")
+			w.Header().Set("X-RateLimit-Category", "Medium")
+			http.Error(w, "slow down", http.StatusTooManyRequests)
+			return
+		}
+		fmt.Fprint(w, `{"users":[{"id":"a"}]}`)
+	}))
+	defer srv.Close()
+
+	c, clock := limitedClient(srv.URL, DefaultLimits)
+	users, err := c.GetUsers()
+	if err != nil || len(users) != 1 {
+		t.Fatalf("expected the retry to succeed, got %v, %v", users, err)
+	}
+	if calls != 2 || fmt.Sprint(clock.slept) != "[3s]" {
+		t.Fatalf("expected one retry after 3s, got %d calls, slept %v", calls, clock.slept)
+	}
+}
+
+func TestGet_429ForAnotherCategoryStillWaits(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.Header().Set("Retry-After", "2")
+			w.Header().Set("X-RateLimit-Type", "QPS")
+			w.Header().Set("X-RateLimit-Category", "Heavy")
+			http.Error(w, "slow down", http.StatusTooManyRequests)
+			return
+		}
+		fmt.Fprint(w, `{"users":[{"id":"a"}]}`)
+	}))
+	defer srv.Close()
+
+	c, clock := limitedClient(srv.URL, DefaultLimits)
+	if _, err := c.GetUsers(); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 || fmt.Sprint(clock.slept) != "[2s]" {
+		t.Fatalf("expected the medium request retried after 2s, got %d calls, slept %v", calls, clock.slept)
+	}
+	// the heavy category named by Zoom was paused too
+	if until := c.limits.buckets[Heavy].until; !until.Equal(clock.now) {
+		t.Fatalf("expected heavy requests held back until %s, got %s", clock.now, until)
+	}
+}
+
+func TestLimitCategory(t *testing.T) {
+	cases := []struct {
+		typ, category string
+		want          Category
+	}{
+		{"QPS", "Heavy", Heavy},
+		{"QPS", "Resource-intensive", ResourceIntensive},
+		{"Daily-limit", "Light", Light},
+		// the type names no category
+		{"Medium", "", Medium},
+		{"QPS", "bulk", Medium},
+	}
+	for _, tc := range cases {
+		h := http.Header{}
+		h.Set("X-RateLimit-Type", tc.typ)
+		h.Set("X-RateLimit-Category", tc.category)
+		if got := limitCategory(h, Medium); got != tc.want {
+			t.Errorf("type %q, category %q: got %s, want %s", tc.typ, tc.category, got, tc.want)
+		}
+	}
+}
+
+func TestLimiter_BlockHoldsBackRequests(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)}
+	l := NewLimiter(DefaultLimits)
+	l.now, l.sleep = clock.Now, clock.Sleep
+
+	// another worker sharing the limiter was told to wait 10s
+	l.Block(Medium, clock.now.Add(10*time.Second))
+	if err := l.Wait(Medium); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(clock.slept) != "[10s]" {
+		t.Fatalf("expected to wait out the block, slept %v", clock.slept)
+	}
+}
+
+func TestGet_RetriesServerErrors(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	c, clock := limitedClient(srv.URL, DefaultLimits)
+	if _, err := c.GetUsers(); err == nil {
+		t.Fatal("expected an error")
+	}
+	if calls != maxRetries+1 || len(clock.slept) != maxRetries {
+		t.Fatalf("expected %d attempts, got %d calls, slept %v", maxRetries+1, calls, clock.slept)
+	}
+	for i := 1; i < len(clock.slept); i++ {
+		if clock.slept[i] <= clock.slept[i-1]/2 {
+			t.Fatalf("expected backoff to grow, slept %v", clock.slept)
+		}
+	}
+}
+
+func TestGet_DoesNotRetryClientErrors(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		http.Error(w, "not found", http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	c, _ := limitedClient(srv.URL, DefaultLimits)
+	if _, err := c.GetUsers(); err == nil || calls != 1 {
+		t.Fatalf("expected one call and an error, got %d calls, %v", calls, err)
+	}
+}
+
+func TestGet_DailyLimitFailsFast(t *testing.T) {
+	calls := 0
+	var retryAt time.Time
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Retry-After", retryAt.Format(time.RFC3339))
+		w.Header().Set("X-RateLimit-Type", "Daily-limit")
+		w.Header().Set("X-RateLimit-Category", "Medium")
+		http.Error(w, "daily limit", http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	c, clock := limitedClient(srv.URL, DefaultLimits)
+	retryAt = clock.now.Add(6 * time.Hour)
+	_, err := c.GetUsers()
+	var rle *RateLimitError
+	if !errors.As(err, &rle) || !rle.RetryAt.Equal(retryAt) || rle.Category != Medium {
+		t.Fatalf("expected a rate limit error until %s, got %v", retryAt, err)
+	}
+	// the category stays blocked without asking Zoom again
+	if _, err := c.GetUserChannels("u1"); !errors.As(err, &rle) || calls != 1 {
+		t.Fatalf("expected a blocked request, got %d calls, %v", calls, err)
+	}
+	if len(clock.slept) != 0 {
+		t.Fatalf("expected no waiting, slept %v", clock.slept)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	cases := map[string]time.Duration{
+		"":                              0,
+		"5":                             5 * time.Second,
+		"Fri, 01 Mar 2024 12:00:30 GMT": 30 * time.Second,
+		"2024-03-02T00:00:00Z":          12 * time.Hour,
+		"2024-03-01T11:00:00Z":          0,
+		"soon":                          0,
+	}
+	for v, want := range cases {
+		h := http.Header{}
+		h.Set("Retry-After", v)
+		if got := retryAfter(h, now); got != want {
+			t.Errorf("Retry-After %q: got %s, want %s", v, got, want)
+		}
+	}
+}
+
+func TestParseLimits(t *testing.T) {
+	limits, err := ParseLimits("medium=60, Heavy=40, resource-intensive=30")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if limits[Medium] != 60 || limits[Heavy] != 40 || limits[Light] != DefaultLimits[Light] {
+		t.Fatalf("unexpected limits %v", limits)
+	}
+	// Zoom counts resource-intensive requests per minute
+	if limits[ResourceIntensive] != 0.5 || DefaultLimits[ResourceIntensive]*60 != 10 {
+		t.Fatalf("expected resource-intensive limits per minute, got %v and default %v", limits[ResourceIntensive], DefaultLimits[ResourceIntensive])
+	}
+	for _, bad := range []string{"medium", "medium=0", "medium=x", "bulk=5"} {
+		if _, err := ParseLimits(bad); err == nil {
+			t.Errorf("expected %q to be rejected", bad)
+		}
+	}
+}
+
+func TestSharedLimiter_OnePerAccount(t *testing.T) {
+	a, err := sharedLimiter("acct-shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := sharedLimiter("acct-shared")
+	other, _ := sharedLimiter("acct-other")
+	if a != b || a == other {
+		t.Fatal("expected one limiter per account")
+	}
+}
@@ -1,6 +1,7 @@
 package translator
 
 import (
+	"html"
 	"time"
 
 	migmodel "example.com/go-migrator/internal/migrator/model"
@@ -10,12 +11,7 @@ import (
 // for the Graph import API. It preserves ID, timestamps, sender display name,
 // message content, and maps files to attachments when download URLs are present.
 func TranslateZoomToTeams(zm migmodel.ZoomMessage, teamsUserID, teamsUserDisplayName string) migmodel.TeamsMessageRequest {
-	// determine createdDateTime
-	created := zm.DateTime
-	if created == "" && zm.Timestamp > 0 {
-		// Zoom timestamp is milliseconds since epoch in these messages
-		created = time.Unix(0, zm.Timestamp*int64(time.Millisecond)).UTC().Format(time.RFC3339)
-	}
+	created := CreatedDateTime(zm)
 
 	// build body content
 	content := zm.Message
@@ -36,3 +32,32 @@ func TranslateZoomToTeams(zm migmodel.ZoomMessage, teamsUserID, teamsUserDisplay
 	}
 	return tm
 }
+
+// CreatedDateTime returns the RFC3339 send time of a Zoom message.
+func CreatedDateTime(zm migmodel.ZoomMessage) string {
+	created := zm.DateTime
+	if created == "" && zm.Timestamp > 0 {
+		// Zoom timestamp is milliseconds since epoch in these messages
+		created = time.Unix(0, zm.Timestamp*int64(time.Millisecond)).UTC().Format(time.RFC3339)
+	}
+	return created
+}
+
+// AttributeSender prefixes the message body with the original Zoom sender, for
+// messages posted on behalf of someone else.
+func AttributeSender(tm *migmodel.TeamsMessageRequest, name, email string) {
+	if tm.Body == nil {
+		tm.Body = &migmodel.TeamsBody{ContentType: "html"}
+	}
+	who := html.EscapeString(name)
+	if email != "" {
+		if who != "" {
+			who += " "
+		}
+		who += "&lt;" + html.EscapeString(email) + "&gt;"
+	}
+	if who == "" {
+		who = "an unknown Zoom user"
+	}
+	tm.Body.Content = "<p><em>Originally sent by " + who + "</em></p>" + tm.Body.Content
+}
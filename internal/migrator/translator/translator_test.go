@@ -50,3 +50,13 @@ func TestTranslateZoomToTeams_WithFiles(t *testing.T) {
 		t.Fatalf("expected From.User.ID to equal teams-user-2 got %v", tm.From)
 	}
 }
+
+func TestAttributeSender(t *testing.T) {
+	zm := migmodel.ZoomMessage{ID: "msg-3", Message: "hi"}
+	tm := TranslateZoomToTeams(zm, "fallback", "Migration Bot")
+	AttributeSender(&tm, "Jane <Doe>", "jane@example.com")
+	want := "<p><em>Originally sent by Jane &lt;Doe&gt; &lt;jane@example.com&gt;</em></p>hi"
+	if tm.Body.Content != want {
+		t.Fatalf("unexpected body content. want=%q got=%q", want, tm.Body.Content)
+	}
+}
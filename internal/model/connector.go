@@ -1,6 +1,11 @@
 package model
 
-import "time"
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
 
 type ConnectorType string
 
@@ -10,10 +15,26 @@ const (
 )
 
 type Connector struct {
-	ID        string        `gorm:"primaryKey;size:36" json:"id"`
-	UserID    string        `gorm:"size:64;index:idx_connector_user" json:"user_id"`
-	Type      ConnectorType `gorm:"size:20;index:idx_connector_type" json:"type"`
-	Data      string        `gorm:"type:text" json:"data"`
-	CreatedAt time.Time     `gorm:"autoCreateTime" json:"created_at"`
-	UpdatedAt time.Time     `gorm:"autoUpdateTime" json:"updated_at"`
+	ID       string        `gorm:"primaryKey;size:36" json:"id"`
+	TenantID string        `gorm:"size:64;index:idx_connector_tenant" json:"tenant_id"`
+	UserID   string        `gorm:"size:64;index:idx_connector_user" json:"user_id"`
+	Type     ConnectorType `gorm:"size:20;index:idx_connector_type" json:"type"`
+	// Data holds the decrypted credentials. It is never persisted or serialized;
+	// ConnectorStore seals it into EncryptedData/DataKey under KeyID.
+	Data string `gorm:"-" json:"-"`
+	// EncryptedData keeps the legacy "data" column. Rows with an empty KeyID
+	// predate encryption and hold plaintext until the keys are rotated.
+	EncryptedData string    `gorm:"column:data;type:text" json:"-"`
+	DataKey       string    `gorm:"type:text" json:"-"`
+	KeyID         string    `gorm:"size:64;index:idx_connector_key" json:"key_id"`
+	CreatedAt     time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt     time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// BeforeCreate is a GORM hook that ensures a UUID is assigned to Connector.ID
+func (c *Connector) BeforeCreate(tx *gorm.DB) (err error) {
+	if c.ID == "" {
+		c.ID = uuid.New().String()
+	}
+	return nil
 }
@@ -0,0 +1,32 @@
+package model
+
+import "time"
+
+type FinalizationStatus string
+
+const (
+	FinalizationCompleted FinalizationStatus = "completed"
+	FinalizationFailed    FinalizationStatus = "failed"
+)
+
+// TeamFinalization records the outcome of ending migration mode for one team
+// a project created. CompletedChannels lists the channels already completed,
+// so a rerun only retries what failed. Chats are finalized the same way: for
+// them Chat is set, TeamsTeamID holds the chat ID and TeamName its topic, or
+// the task's source path for 1:1 chats.
+type TeamFinalization struct {
+	ID        uint   `gorm:"primaryKey;autoIncrement" json:"id"`
+	TenantID  string `gorm:"size:64;uniqueIndex:uq_team_finalization,priority:1" json:"tenant_id"`
+	ProjectID string `gorm:"size:64;uniqueIndex:uq_team_finalization,priority:2" json:"project_id"`
+	// TeamsTeamID is sized for chat IDs, which are longer than team IDs.
+	TeamsTeamID       string             `gorm:"size:128;uniqueIndex:uq_team_finalization,priority:3" json:"teams_team_id"`
+	TeamName          string             `gorm:"size:255" json:"team_name"`
+	Chat              bool               `gorm:"not null;default:false" json:"chat,omitempty"`
+	Status            FinalizationStatus `gorm:"size:20" json:"status"`
+	CompletedChannels []string           `gorm:"type:text;serializer:json" json:"completed_channels"`
+	Error             string             `gorm:"type:text" json:"error,omitempty"`
+	Attempts          int                `json:"attempts"`
+	FinalizedAt       *time.Time         `json:"finalized_at,omitempty"`
+	CreatedAt         time.Time          `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt         time.Time          `gorm:"autoUpdateTime" json:"updated_at"`
+}
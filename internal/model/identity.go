@@ -2,15 +2,59 @@ package model
 
 import "time"
 
-// Identity maps a Zoom user to a Teams user.
+// Identity validation results.
+const (
+	IdentityValid       = "valid"
+	IdentityNotFound    = "not_found"
+	IdentityDisabled    = "disabled"
+	IdentityUPNMismatch = "upn_mismatch"
+	IdentityCheckFailed = "error"
+)
+
+// Identity maps a Zoom user to a Teams user. A mapping with a ProjectID
+// overrides the tenant-wide mapping (empty ProjectID) for that project.
 type Identity struct {
-	ID                     uint      `gorm:"primaryKey;autoIncrement" json:"id"`
-	ZoomUserID             string    `gorm:"size:64;index:idx_zoom_user_id" json:"zoom_user_id"`
-	ZoomUserEmail          string    `gorm:"size:128;index:idx_zoom_user_email" json:"zoom_user_email"`
-	ZoomUserDisplayName    string    `gorm:"size:128" json:"zoom_user_display_name"`
-	TeamsUserID            string    `gorm:"size:64;index:idx_teams_user_id" json:"teams_user_id"`
-	TeamsUserPrincipalName string    `gorm:"size:128;index:idx_teams_user_principal" json:"teams_user_principal_name"`
-	TeamsUserDisplayName   string    `gorm:"size:128" json:"teams_user_display_name"`
-	CreatedAt              time.Time `gorm:"autoCreateTime" json:"created_at"`
-	UpdatedAt              time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+	ID                     uint   `gorm:"primaryKey;autoIncrement" json:"id"`
+	TenantID               string `gorm:"size:64;index:idx_identity_tenant_zoom,priority:1;uniqueIndex:uq_identity_scope,priority:1" json:"tenant_id"`
+	ProjectID              string `gorm:"size:64;not null;default:'';uniqueIndex:uq_identity_scope,priority:2" json:"project_id,omitempty"`
+	ZoomUserID             string `gorm:"size:64;index:idx_zoom_user_id;index:idx_identity_tenant_zoom,priority:2;uniqueIndex:uq_identity_scope,priority:3" json:"zoom_user_id"`
+	ZoomUserEmail          string `gorm:"size:128;index:idx_zoom_user_email" json:"zoom_user_email"`
+	ZoomUserDisplayName    string `gorm:"size:128" json:"zoom_user_display_name"`
+	TeamsUserID            string `gorm:"size:64;index:idx_teams_user_id" json:"teams_user_id"`
+	TeamsUserPrincipalName string `gorm:"size:128;index:idx_teams_user_principal" json:"teams_user_principal_name"`
+	TeamsUserDisplayName   string `gorm:"size:128" json:"teams_user_display_name"`
+	// ValidationStatus is the result of the last check against the
+	// destination tenant of the project the identity was loaded for; empty
+	// means never checked since the last change. Results are stored per
+	// project in IdentityValidation, since projects may migrate into
+	// different tenants.
+	ValidationStatus string     `gorm:"-" json:"validation_status,omitempty"`
+	ValidationError  string     `gorm:"-" json:"validation_error,omitempty"`
+	ValidatedAt      *time.Time `gorm:"-" json:"validated_at,omitempty"`
+	CreatedAt        time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt        time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// IdentityAlias makes another Zoom user ID resolve to the mappings of
+// ZoomUserID, for people with several Zoom accounts.
+type IdentityAlias struct {
+	ID              uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	TenantID        string    `gorm:"size:64;uniqueIndex:uq_identity_alias,priority:1" json:"tenant_id"`
+	AliasZoomUserID string    `gorm:"size:64;uniqueIndex:uq_identity_alias,priority:2" json:"alias_zoom_user_id"`
+	ZoomUserID      string    `gorm:"size:64;index:idx_identity_alias_target" json:"zoom_user_id"`
+	CreatedAt       time.Time `gorm:"autoCreateTime" json:"created_at"`
+}
+
+// IdentityValidation is the result of checking an identity against the
+// destination tenant of one project. TeamsUserID is the Teams user a mapping
+// that only names a UPN resolved to in that tenant.
+type IdentityValidation struct {
+	ID          uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	TenantID    string    `gorm:"size:64" json:"tenant_id"`
+	IdentityID  uint      `gorm:"uniqueIndex:uq_identity_validation,priority:1" json:"identity_id"`
+	ProjectID   string    `gorm:"size:64;uniqueIndex:uq_identity_validation,priority:2" json:"project_id"`
+	TeamsUserID string    `gorm:"size:64" json:"teams_user_id,omitempty"`
+	Status      string    `gorm:"size:20" json:"status"`
+	Error       string    `gorm:"size:255" json:"error,omitempty"`
+	ValidatedAt time.Time `json:"validated_at"`
 }
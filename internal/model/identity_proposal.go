@@ -0,0 +1,43 @@
+package model
+
+import "time"
+
+type ProposalStatus string
+
+const (
+	ProposalPending  ProposalStatus = "pending"
+	ProposalAccepted ProposalStatus = "accepted"
+	ProposalRejected ProposalStatus = "rejected"
+)
+
+// IdentityProposal is a suggested Zoom to Teams mapping produced by the
+// matching job. It becomes an Identity only once it is accepted.
+type IdentityProposal struct {
+	ID                     uint   `gorm:"primaryKey;autoIncrement" json:"id"`
+	TenantID               string `gorm:"size:64;index:idx_proposal_tenant_status,priority:1" json:"tenant_id"`
+	ZoomUserID             string `gorm:"size:64;index:idx_proposal_zoom_user" json:"zoom_user_id"`
+	ZoomUserEmail          string `gorm:"size:128" json:"zoom_user_email"`
+	ZoomUserDisplayName    string `gorm:"size:128" json:"zoom_user_display_name"`
+	TeamsUserID            string `gorm:"size:64" json:"teams_user_id"`
+	TeamsUserPrincipalName string `gorm:"size:128" json:"teams_user_principal_name"`
+	TeamsUserDisplayName   string `gorm:"size:128" json:"teams_user_display_name"`
+	// Score is the match confidence between 0 and 1; Reason names the rule
+	// that produced it (email, alias, display_name).
+	Score     float64        `json:"score"`
+	Reason    string         `gorm:"size:64" json:"reason"`
+	Status    ProposalStatus `gorm:"size:20;index:idx_proposal_tenant_status,priority:2" json:"status"`
+	CreatedAt time.Time      `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time      `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// Identity returns the mapping the proposal suggests.
+func (p *IdentityProposal) Identity() Identity {
+	return Identity{
+		ZoomUserID:             p.ZoomUserID,
+		ZoomUserEmail:          p.ZoomUserEmail,
+		ZoomUserDisplayName:    p.ZoomUserDisplayName,
+		TeamsUserID:            p.TeamsUserID,
+		TeamsUserPrincipalName: p.TeamsUserPrincipalName,
+		TeamsUserDisplayName:   p.TeamsUserDisplayName,
+	}
+}
@@ -0,0 +1,26 @@
+package model
+
+import "time"
+
+// DiscoveredChannel is a Zoom channel found by a project's discovery run.
+// Channels reachable through several members are stored once, under the
+// first member they were seen through.
+type DiscoveredChannel struct {
+	ID            uint   `gorm:"primaryKey;autoIncrement" json:"id"`
+	TenantID      string `gorm:"size:64;uniqueIndex:uq_discovered_channel,priority:1" json:"tenant_id"`
+	ProjectID     string `gorm:"size:64;uniqueIndex:uq_discovered_channel,priority:2" json:"project_id"`
+	ZoomChannelID string `gorm:"size:64;uniqueIndex:uq_discovered_channel,priority:3" json:"zoom_channel_id"`
+	Name          string `gorm:"size:255" json:"name"`
+	// Type is the Zoom channel type, see migmodel.ZoomChannelPrivate and friends.
+	Type int `json:"type"`
+	// OwnerZoomUserID is the member whose API path is used to read the channel.
+	OwnerZoomUserID string    `gorm:"size:64" json:"owner_zoom_user_id"`
+	MemberCount     int       `json:"member_count"`
+	SeenVia         int       `json:"seen_via"`
+	DiscoveredAt    time.Time `json:"discovered_at"`
+}
+
+// SourcePath returns the task source path of the channel.
+func (c *DiscoveredChannel) SourcePath() string {
+	return ChannelSourcePath(c.OwnerZoomUserID, c.ZoomChannelID)
+}
@@ -0,0 +1,30 @@
+package model
+
+import "time"
+
+type MessageStatus string
+
+const (
+	MessageImported MessageStatus = "imported"
+	MessageFailed   MessageStatus = "failed"
+)
+
+// MessageRecord is the ledger entry for a single source message. There is at
+// most one record per Zoom message and Teams channel, so a rerun into the same
+// channel can skip everything already imported.
+type MessageRecord struct {
+	ID             uint          `gorm:"primaryKey;autoIncrement" json:"id"`
+	TenantID       string        `gorm:"size:64;uniqueIndex:uq_message_channel_source,priority:1" json:"tenant_id"`
+	ProjectID      string        `gorm:"size:64;index:idx_message_project;index:idx_message_project_updated,priority:1" json:"project_id"`
+	TaskID         string        `gorm:"size:36;index:idx_message_task" json:"task_id"`
+	ZoomMessageID  string        `gorm:"size:64;uniqueIndex:uq_message_channel_source,priority:3" json:"zoom_message_id"`
+	TeamsTeamID    string        `gorm:"size:64" json:"teams_team_id"`
+	TeamsChannelID string        `gorm:"size:128;uniqueIndex:uq_message_channel_source,priority:2" json:"teams_channel_id"`
+	TeamsMessageID string        `gorm:"size:64" json:"teams_message_id"`
+	Status         MessageStatus `gorm:"size:20;index:idx_message_status" json:"status"`
+	Error          string        `gorm:"type:text" json:"error,omitempty"`
+	// Files is the number of files attached to the Zoom message.
+	Files     int       `gorm:"not null;default:0" json:"files"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime;index:idx_message_project_updated,priority:2" json:"updated_at"`
+}
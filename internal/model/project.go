@@ -1,12 +1,162 @@
 package model
 
-import "time"
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// UnmappedSenderPolicy decides what happens to messages whose Zoom sender has
+// no identity mapping.
+type UnmappedSenderPolicy string
+
+const (
+	// UnmappedFail fails the task before anything is posted.
+	UnmappedFail UnmappedSenderPolicy = "fail"
+	// UnmappedFallback posts the message as the project's fallback account.
+	UnmappedFallback UnmappedSenderPolicy = "fallback"
+	// UnmappedFallbackAttributed posts as the fallback account and keeps the
+	// original Zoom sender name and email in the message body.
+	UnmappedFallbackAttributed UnmappedSenderPolicy = "fallback_attributed"
+)
+
+// Valid reports whether p is a known policy.
+func (p UnmappedSenderPolicy) Valid() bool {
+	switch p {
+	case UnmappedFail, UnmappedFallback, UnmappedFallbackAttributed:
+		return true
+	}
+	return false
+}
+
+// ProjectState is where a project is in its lifecycle:
+// draft → discovered → planned → approved → migrating → finalizing →
+// completed, with failed reachable from migrating and finalizing.
+type ProjectState string
+
+const (
+	ProjectDraft      ProjectState = "draft"
+	ProjectDiscovered ProjectState = "discovered"
+	ProjectPlanned    ProjectState = "planned"
+	ProjectApproved   ProjectState = "approved"
+	ProjectMigrating  ProjectState = "migrating"
+	ProjectFinalizing ProjectState = "finalizing"
+	ProjectCompleted  ProjectState = "completed"
+	ProjectFailed     ProjectState = "failed"
+)
+
+// projectTransitions lists the states each state may move to. Discovery may
+// run again until migration starts; a new plan withdraws the approval.
+var projectTransitions = map[ProjectState][]ProjectState{
+	ProjectDraft:      {ProjectDiscovered},
+	ProjectDiscovered: {ProjectDiscovered, ProjectPlanned},
+	ProjectPlanned:    {ProjectDiscovered, ProjectPlanned, ProjectApproved},
+	ProjectApproved:   {ProjectDiscovered, ProjectPlanned, ProjectMigrating},
+	ProjectMigrating:  {ProjectFinalizing, ProjectFailed},
+	ProjectFinalizing: {ProjectCompleted, ProjectFailed},
+	ProjectFailed:     {ProjectMigrating, ProjectFinalizing},
+}
+
+// CanTransition reports whether a project may move from s to to.
+func (s ProjectState) CanTransition(to ProjectState) bool {
+	for _, next := range projectTransitions[s] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// RunsTasks reports whether tasks of a project in this state may run.
+func (s ProjectState) RunsTasks() bool {
+	return s == ProjectApproved || s == ProjectMigrating
+}
+
+// PlanEditable reports whether the plan of a project in this state may still
+// change. Once approved, the plan is fixed until it is withdrawn.
+func (s ProjectState) PlanEditable() bool {
+	return s == ProjectDraft || s == ProjectDiscovered || s == ProjectPlanned
+}
+
+// MappingRule maps the Zoom channels whose name matches Match to a Teams team
+// and channel. Team and Channel are templates, see package mapping. The
+// first matching rule of a project wins.
+type MappingRule struct {
+	// Match is a regular expression on the Zoom channel name; empty matches
+	// every channel.
+	Match   string `json:"match,omitempty"`
+	Team    string `json:"team,omitempty"`
+	Channel string `json:"channel,omitempty"`
+	// TeamType and ChannelType override the defaults: public teams, and
+	// private channels for private Zoom channels.
+	TeamType    string `json:"team_type,omitempty"`
+	ChannelType string `json:"channel_type,omitempty"`
+}
 
 type Project struct {
-	ID                string    `gorm:"primaryKey;size:36" json:"project_id"`
-	Name              string    `gorm:"size:128;not null" json:"name"`
-	SourceConnectorID string    `gorm:"size:64;index:idx_project_source_connector" json:"source_connector_id"`
-	TargetConnectorID string    `gorm:"size:64;index:idx_project_target_connector" json:"target_connector_id"`
-	CreatedAt         time.Time `gorm:"autoCreateTime" json:"created_at"`
-	UpdatedAt         time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+	ID                string `gorm:"primaryKey;size:36" json:"project_id"`
+	TenantID          string `gorm:"size:64;index:idx_project_tenant" json:"tenant_id"`
+	Name              string `gorm:"size:128;not null" json:"name"`
+	SourceConnectorID string `gorm:"size:64;index:idx_project_source_connector" json:"source_connector_id"`
+	TargetConnectorID string `gorm:"size:64;index:idx_project_target_connector" json:"target_connector_id"`
+	// RetentionDays is how long finished tasks are kept before they are purged.
+	// Zero keeps them forever. LegalHold exempts the project from purging.
+	RetentionDays int  `gorm:"not null;default:0" json:"retention_days"`
+	LegalHold     bool `gorm:"not null;default:false" json:"legal_hold"`
+	// UnmappedSenderPolicy and the fallback account apply to senders without
+	// an identity mapping.
+	UnmappedSenderPolicy         UnmappedSenderPolicy `gorm:"size:32;not null;default:fail" json:"unmapped_sender_policy"`
+	FallbackTeamsUserID          string               `gorm:"size:64" json:"fallback_teams_user_id,omitempty"`
+	FallbackTeamsUserDisplayName string               `gorm:"size:128" json:"fallback_teams_user_display_name,omitempty"`
+	// MappingRules decide the Teams target of each discovered channel.
+	MappingRules []MappingRule `gorm:"type:text;serializer:json" json:"mapping_rules,omitempty"`
+	// ScheduleStart and ScheduleEnd bound the migration window: tasks of the
+	// project only run between them. Either may be nil for an open end.
+	ScheduleStart *time.Time `json:"schedule_start,omitempty"`
+	ScheduleEnd   *time.Time `json:"schedule_end,omitempty"`
+	// State is the lifecycle state. ApprovedBy and ApprovedAt record who
+	// approved the current plan; they are cleared when the plan changes.
+	State      ProjectState `gorm:"size:20;not null;default:'';index:idx_project_state" json:"state"`
+	ApprovedBy string       `gorm:"size:128" json:"approved_by,omitempty"`
+	ApprovedAt *time.Time   `json:"approved_at,omitempty"`
+	// DiscoveredAt and DiscoveryError describe the last discovery run.
+	DiscoveredAt   *time.Time `json:"discovered_at,omitempty"`
+	DiscoveryError string     `gorm:"type:text" json:"discovery_error,omitempty"`
+	// FinalizeLockedBy is the finalize run holding the project, from the API
+	// or the CLI, and FinalizeLockedUntil when its lease runs out unless the
+	// run renews it.
+	FinalizeLockedBy    string     `gorm:"size:64" json:"-"`
+	FinalizeLockedUntil *time.Time `json:"-"`
+	CreatedAt           time.Time  `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt           time.Time  `gorm:"autoUpdateTime" json:"updated_at"`
+}
+
+// Finalizing reports whether a finalize run holds the project at now.
+func (p *Project) Finalizing(now time.Time) bool {
+	return p.FinalizeLockedBy != "" && p.FinalizeLockedUntil != nil && now.Before(*p.FinalizeLockedUntil)
+}
+
+// CheckSchedule returns an error if now is outside the project's migration
+// window.
+func (p *Project) CheckSchedule(now time.Time) error {
+	if p.ScheduleStart != nil && now.Before(*p.ScheduleStart) {
+		return fmt.Errorf("project's migration window opens at %s", p.ScheduleStart.UTC().Format(time.RFC3339))
+	}
+	if p.ScheduleEnd != nil && !now.Before(*p.ScheduleEnd) {
+		return fmt.Errorf("project's migration window closed at %s", p.ScheduleEnd.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
+
+// BeforeCreate is a GORM hook that ensures a UUID is assigned to Project.ID
+func (p *Project) BeforeCreate(tx *gorm.DB) (err error) {
+	if p.ID == "" {
+		p.ID = uuid.New().String()
+	}
+	if p.State == "" {
+		p.State = ProjectDraft
+	}
+	return nil
 }
@@ -0,0 +1,73 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestProjectState_CanTransition(t *testing.T) {
+	tests := []struct {
+		from, to ProjectState
+		want     bool
+	}{
+		{ProjectDraft, ProjectDiscovered, true},
+		{ProjectDraft, ProjectApproved, false},
+		{ProjectDiscovered, ProjectDiscovered, true},
+		{ProjectPlanned, ProjectApproved, true},
+		{ProjectPlanned, ProjectMigrating, false},
+		{ProjectApproved, ProjectPlanned, true},
+		{ProjectApproved, ProjectMigrating, true},
+		{ProjectMigrating, ProjectDiscovered, false},
+		{ProjectMigrating, ProjectFinalizing, true},
+		{ProjectFinalizing, ProjectCompleted, true},
+		{ProjectFailed, ProjectMigrating, true},
+		{ProjectCompleted, ProjectMigrating, false},
+	}
+	for _, tt := range tests {
+		if got := tt.from.CanTransition(tt.to); got != tt.want {
+			t.Errorf("%s -> %s: got %v, want %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+func TestProjectState_RunsTasksAndPlanEditable(t *testing.T) {
+	tests := []struct {
+		state           ProjectState
+		runs, plannable bool
+	}{
+		{ProjectDraft, false, true},
+		{ProjectDiscovered, false, true},
+		{ProjectPlanned, false, true},
+		{ProjectApproved, true, false},
+		{ProjectMigrating, true, false},
+		{ProjectFinalizing, false, false},
+		{ProjectCompleted, false, false},
+		{ProjectFailed, false, false},
+	}
+	for _, tt := range tests {
+		if got := tt.state.RunsTasks(); got != tt.runs {
+			t.Errorf("%s runs tasks: got %v, want %v", tt.state, got, tt.runs)
+		}
+		if got := tt.state.PlanEditable(); got != tt.plannable {
+			t.Errorf("%s plan editable: got %v, want %v", tt.state, got, tt.plannable)
+		}
+	}
+}
+
+func TestProject_CheckSchedule(t *testing.T) {
+	start := time.Date(2024, 6, 1, 20, 0, 0, 0, time.UTC)
+	end := start.Add(48 * time.Hour)
+	p := &Project{ScheduleStart: &start, ScheduleEnd: &end}
+	if err := p.CheckSchedule(start.Add(-time.Minute)); err == nil {
+		t.Fatal("expected tasks refused before the window opens")
+	}
+	if err := p.CheckSchedule(start); err != nil {
+		t.Fatalf("expected tasks allowed once the window opens, got %v", err)
+	}
+	if err := p.CheckSchedule(end); err == nil {
+		t.Fatal("expected tasks refused once the window closed")
+	}
+	if err := (&Project{}).CheckSchedule(end); err != nil {
+		t.Fatalf("expected no window to allow tasks, got %v", err)
+	}
+}
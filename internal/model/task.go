@@ -1,6 +1,8 @@
 package model
 
 import (
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -10,20 +12,100 @@ import (
 type TaskStatus string
 
 const (
+	// StatusPlanned tasks were proposed by discovery and are not queued yet.
+	StatusPlanned TaskStatus = "planned"
 	StatusPending TaskStatus = "pending"
 	StatusRunning TaskStatus = "running"
 	StatusSuccess TaskStatus = "success"
 	StatusFailed  TaskStatus = "failed"
 )
 
+// Active reports whether a task in this status blocks a new generation of
+// the same source path.
+func (s TaskStatus) Active() bool {
+	return s == StatusPending || s == StatusRunning
+}
+
+// TaskMode selects how a generation relates to the previous one.
+type TaskMode string
+
+const (
+	// ModeFull migrates the whole source history into the target.
+	ModeFull TaskMode = "full"
+	// ModeDelta continues the previous generation: it reuses its Teams
+	// channel and only fetches messages newer than its cursor.
+	ModeDelta TaskMode = "delta"
+)
+
+// Task migrates one Zoom channel into one Teams channel, or one Zoom chat
+// into one Teams chat.
+//
+// A source path can be migrated several times; each run is a generation that
+// links back to the previous one. At most one generation per source path is
+// active (pending or running) at any time, which the database enforces through
+// the unique index on ActiveSourcePath.
+//
+// SourcePath mirrors the Zoom API path used to read the channel:
+// "users/<zoom user id>/channels/<channel id>". TargetPath is
+// "<team name>/<channel name>"; Teams channel names cannot contain '/'.
+//
+// Chat tasks read "users/<zoom user id>/contacts/<contact user id>", the 1:1
+// messages with a contact, or "users/<zoom user id>/groupchats/<channel id>".
+// Their TargetPath is the topic of the Teams chat, empty for 1:1 chats, and
+// TeamsChannelID holds the chat's ID.
 type Task struct {
-	ID         string     `gorm:"primaryKey;size:36" json:"id"`
-	ProjectID  string     `gorm:"size:64;index:idx_task_project_status,priority:1" json:"project_id"`
-	SourcePath string     `gorm:"size:255;uniqueIndex:uq_task_source_path" json:"source_path"`
-	TargetPath string     `gorm:"size:255" json:"target_path"`
-	Status     TaskStatus `gorm:"size:20;index:idx_task_status;index:idx_task_project_status,priority:2" json:"status"`
-	CreatedAt  time.Time  `gorm:"index:idx_task_created_at" json:"created_at"`
-	UpdatedAt  time.Time  `json:"updated_at"`
+	ID         string `gorm:"primaryKey;size:36" json:"id"`
+	TenantID   string `gorm:"size:64;index:idx_task_tenant_source_path,priority:1;uniqueIndex:uq_task_active_source,priority:1;index:idx_task_tenant_project_status,priority:1" json:"tenant_id"`
+	ProjectID  string `gorm:"size:64;index:idx_task_project_status,priority:1;index:idx_task_tenant_project_status,priority:2" json:"project_id"`
+	SourcePath string `gorm:"size:255;index:idx_task_tenant_source_path,priority:2" json:"source_path"`
+	TargetPath string `gorm:"size:255" json:"target_path"`
+	// TeamType and ChannelType of the target; empty means a public team and
+	// a standard channel.
+	TeamType    string     `gorm:"size:20" json:"team_type,omitempty"`
+	ChannelType string     `gorm:"size:20" json:"channel_type,omitempty"`
+	Status      TaskStatus `gorm:"size:20;index:idx_task_status;index:idx_task_project_status,priority:2;index:idx_task_tenant_project_status,priority:3" json:"status"`
+	Error       string     `gorm:"type:text" json:"error,omitempty"`
+	Mode        TaskMode   `gorm:"size:20;not null;default:full" json:"mode"`
+	Generation  int        `gorm:"not null;default:1" json:"generation"`
+	// PreviousTaskID links to the previous generation of the same source path.
+	PreviousTaskID string `gorm:"size:36" json:"previous_task_id,omitempty"`
+	// ActiveSourcePath equals SourcePath while the task is active and is NULL
+	// otherwise. MySQL allows many NULLs in a unique index, so only active
+	// generations collide.
+	ActiveSourcePath *string `gorm:"size:255;uniqueIndex:uq_task_active_source,priority:2" json:"-"`
+	// Cursor is the timestamp of the newest source message migrated; a delta
+	// generation starts from it.
+	Cursor string `gorm:"size:64" json:"cursor,omitempty"`
+	// TeamsTeamID and TeamsChannelID are recorded once the destination exists,
+	// so retries post into the same channel instead of creating a new one.
+	TeamsTeamID    string `gorm:"size:64;index:idx_task_teams_team" json:"teams_team_id,omitempty"`
+	TeamsChannelID string `gorm:"size:128" json:"teams_channel_id,omitempty"`
+	// Report summarises the last run.
+	Report    *TaskReport `gorm:"type:text;serializer:json" json:"report,omitempty"`
+	CreatedAt time.Time   `gorm:"index:idx_task_created_at" json:"created_at"`
+	UpdatedAt time.Time   `json:"updated_at"`
+	// DeletedAt marks tasks soft-deleted by the retention purge.
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+// TaskReport summarises a task run.
+type TaskReport struct {
+	// MessagesFound and FilesFound count what the run fetched from Zoom.
+	MessagesFound    int `json:"messages_found"`
+	FilesFound       int `json:"files_found"`
+	MessagesImported int `json:"messages_imported"`
+	MessagesSkipped  int `json:"messages_skipped"`
+	// UnmappedSenders lists every sender without an identity mapping and how
+	// the project's UnmappedSenderPolicy handled them.
+	UnmappedSenders []UnmappedSender `json:"unmapped_senders,omitempty"`
+}
+
+// UnmappedSender is a Zoom sender that had no identity mapping.
+type UnmappedSender struct {
+	ZoomUserID  string `json:"zoom_user_id,omitempty"`
+	Email       string `json:"email,omitempty"`
+	DisplayName string `json:"display_name,omitempty"`
+	Messages    int    `json:"messages"`
 }
 
 // BeforeCreate is a GORM hook that ensures a UUID is assigned to Task.ID
@@ -34,5 +116,88 @@ func (t *Task) BeforeCreate(tx *gorm.DB) (err error) {
 	if t.Status == "" {
 		t.Status = StatusPending
 	}
+	if t.Mode == "" {
+		t.Mode = ModeFull
+	}
+	if t.Generation == 0 {
+		t.Generation = 1
+	}
+	if t.Status.Active() {
+		sp := t.SourcePath
+		t.ActiveSourcePath = &sp
+	} else {
+		t.ActiveSourcePath = nil
+	}
 	return nil
 }
+
+// ChannelSourcePath builds the SourcePath of a Zoom channel.
+func ChannelSourcePath(zoomUserID, channelID string) string {
+	return "users/" + zoomUserID + "/channels/" + channelID
+}
+
+// ChannelTargetPath builds the TargetPath of a Teams channel.
+func ChannelTargetPath(teamName, channelName string) string {
+	return teamName + "/" + channelName
+}
+
+// ContactSourcePath builds the SourcePath of the 1:1 messages between a Zoom
+// user and a contact.
+func ContactSourcePath(zoomUserID, contactID string) string {
+	return "users/" + zoomUserID + "/contacts/" + contactID
+}
+
+// GroupChatSourcePath builds the SourcePath of a Zoom group chat.
+func GroupChatSourcePath(zoomUserID, channelID string) string {
+	return "users/" + zoomUserID + "/groupchats/" + channelID
+}
+
+// SourceKind is the kind of Zoom conversation a task reads.
+type SourceKind string
+
+const (
+	SourceChannel   SourceKind = "channels"
+	SourceContact   SourceKind = "contacts"
+	SourceGroupChat SourceKind = "groupchats"
+)
+
+// Chat reports whether the conversation is migrated into a Teams chat.
+func (k SourceKind) Chat() bool {
+	return k == SourceContact || k == SourceGroupChat
+}
+
+// ParseSource returns the kind, Zoom user and conversation encoded in
+// SourcePath. The conversation is a channel ID, or a contact's user ID.
+func (t *Task) ParseSource() (kind SourceKind, zoomUserID, id string, err error) {
+	parts := strings.Split(t.SourcePath, "/")
+	if len(parts) != 4 || parts[0] != "users" || parts[1] == "" || parts[3] == "" {
+		return "", "", "", fmt.Errorf("invalid source path %q", t.SourcePath)
+	}
+	switch kind = SourceKind(parts[2]); kind {
+	case SourceChannel, SourceContact, SourceGroupChat:
+		return kind, parts[1], parts[3], nil
+	}
+	return "", "", "", fmt.Errorf("invalid source path %q", t.SourcePath)
+}
+
+// Source returns the Zoom user and channel encoded in SourcePath. It fails
+// for chat tasks.
+func (t *Task) Source() (zoomUserID, channelID string, err error) {
+	kind, zoomUserID, channelID, err := t.ParseSource()
+	if err == nil && kind != SourceChannel {
+		err = fmt.Errorf("source path %q is not a channel", t.SourcePath)
+	}
+	if err != nil {
+		return "", "", err
+	}
+	return zoomUserID, channelID, nil
+}
+
+// Target returns the Teams team and channel names encoded in TargetPath.
+func (t *Task) Target() (teamName, channelName string, err error) {
+	i := strings.LastIndex(t.TargetPath, "/")
+	if i <= 0 || i == len(t.TargetPath)-1 {
+		return "", "", fmt.Errorf("invalid target path %q", t.TargetPath)
+	}
+	return t.TargetPath[:i], t.TargetPath[i+1:], nil
+}
@@ -0,0 +1,19 @@
+package model
+
+import "time"
+
+// TeamClaim records which task creates the Teams team a project's tasks are
+// consolidated into. The first task to claim a team name creates the team and
+// records its ID; the others wait for it and reuse the team. ClaimedBy and
+// ClaimedAt let a claim whose holder died be taken over.
+type TeamClaim struct {
+	ID          uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	TenantID    string    `gorm:"size:64;uniqueIndex:uq_team_claim,priority:1" json:"tenant_id"`
+	ProjectID   string    `gorm:"size:64;uniqueIndex:uq_team_claim,priority:2" json:"project_id"`
+	TeamName    string    `gorm:"size:255;uniqueIndex:uq_team_claim,priority:3" json:"team_name"`
+	TeamsTeamID string    `gorm:"size:64" json:"teams_team_id"`
+	ClaimedBy   string    `gorm:"size:64" json:"claimed_by"`
+	ClaimedAt   time.Time `json:"claimed_at"`
+	CreatedAt   time.Time `gorm:"autoCreateTime" json:"created_at"`
+	UpdatedAt   time.Time `gorm:"autoUpdateTime" json:"updated_at"`
+}
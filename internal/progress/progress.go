@@ -0,0 +1,114 @@
+// Package progress summarises how far a project's migration has come.
+package progress
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"example.com/go-migrator/internal/model"
+)
+
+// Counts compares what was migrated with what was found in Zoom.
+type Counts struct {
+	Migrated   int64 `json:"migrated"`
+	Discovered int64 `json:"discovered"`
+}
+
+// Report is the progress of one project.
+type Report struct {
+	ProjectID string             `json:"project_id"`
+	State     model.ProjectState `json:"state"`
+	// Tasks counts the project's tasks by status.
+	Tasks      map[model.TaskStatus]int `json:"tasks"`
+	TasksTotal int                      `json:"tasks_total"`
+	Messages   Counts                   `json:"messages"`
+	Files      Counts                   `json:"files"`
+	// MessagesPerMinute is the import rate over the last Window.
+	Window            string  `json:"window"`
+	MessagesPerMinute float64 `json:"messages_per_minute"`
+	// RemainingMessages is estimated for tasks that have not run yet from
+	// the average size of those that have.
+	RemainingMessages int64      `json:"remaining_messages"`
+	ETA               *time.Time `json:"eta,omitempty"`
+	GeneratedAt       time.Time  `json:"generated_at"`
+}
+
+// Ledger holds the message ledger totals of a project.
+type Ledger struct {
+	Messages, Files int64
+	// Recent counts the messages imported during the window.
+	Recent int64
+}
+
+// Compute builds the project's progress report from its tasks and ledger
+// totals. Discovered counts are what the tasks fetched from Zoom, per source
+// path: the latest full run of the channel plus the delta runs after it, so
+// reruns are not counted twice. The ETA is left empty while nothing was
+// imported during the window or nothing remains.
+func Compute(project *model.Project, tasks []model.Task, ledger Ledger, window time.Duration, now time.Time) *Report {
+	r := &Report{
+		ProjectID:   project.ID,
+		State:       project.State,
+		Tasks:       map[model.TaskStatus]int{},
+		TasksTotal:  len(tasks),
+		Window:      window.String(),
+		GeneratedAt: now,
+	}
+	r.Messages.Migrated = ledger.Messages
+	r.Files.Migrated = ledger.Files
+
+	generations := map[string][]*model.Task{}
+	for i := range tasks {
+		t := &tasks[i]
+		r.Tasks[t.Status]++
+		generations[t.SourcePath] = append(generations[t.SourcePath], t)
+	}
+
+	var found, ran int64
+	unrun := 0
+	for _, gens := range generations {
+		sort.Slice(gens, func(i, j int) bool { return gens[i].Generation > gens[j].Generation })
+		var last *model.Task
+		for _, t := range gens {
+			if t.Report == nil {
+				continue
+			}
+			if last == nil {
+				last = t
+			}
+			found += int64(t.Report.MessagesFound)
+			r.Files.Discovered += int64(t.Report.FilesFound)
+			if t.Mode != model.ModeDelta {
+				// a full run lists the channel's whole history
+				break
+			}
+		}
+		if last == nil {
+			if gens[0].Status != model.StatusSuccess {
+				unrun++
+			}
+			continue
+		}
+		ran++
+		if gens[0].Status != model.StatusSuccess {
+			if left := last.Report.MessagesFound - last.Report.MessagesImported - last.Report.MessagesSkipped; left > 0 {
+				r.RemainingMessages += int64(left)
+			}
+		}
+	}
+	r.Messages.Discovered = found
+	if ran > 0 {
+		r.RemainingMessages += int64(unrun) * found / ran
+	}
+
+	if window > 0 {
+		r.MessagesPerMinute = float64(ledger.Recent) / window.Minutes()
+	}
+	if r.MessagesPerMinute > 0 && r.RemainingMessages > 0 {
+		minutes := float64(r.RemainingMessages) / r.MessagesPerMinute
+		eta := now.Add(time.Duration(math.Ceil(minutes * float64(time.Minute))))
+		r.ETA = &eta
+	}
+	return r
+}
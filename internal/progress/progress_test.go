@@ -0,0 +1,67 @@
+package progress
+
+import (
+	"testing"
+	"time"
+
+	"example.com/go-migrator/internal/model"
+)
+
+func TestCompute(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	p := &model.Project{ID: "p1", State: model.ProjectMigrating}
+	tasks := []model.Task{
+		{SourcePath: "c1", Status: model.StatusSuccess, Report: &model.TaskReport{MessagesFound: 100, FilesFound: 4, MessagesImported: 100}},
+		{SourcePath: "c2", Status: model.StatusFailed, Report: &model.TaskReport{MessagesFound: 300, FilesFound: 6, MessagesImported: 200}},
+		{SourcePath: "c3", Status: model.StatusPending},
+		{SourcePath: "c4", Status: model.StatusPlanned},
+	}
+	r := Compute(p, tasks, Ledger{Messages: 300, Files: 7, Recent: 150}, 15*time.Minute, now)
+
+	if r.TasksTotal != 4 || r.Tasks[model.StatusSuccess] != 1 || r.Tasks[model.StatusPlanned] != 1 {
+		t.Fatalf("unexpected task counts: %+v", r.Tasks)
+	}
+	if r.Messages != (Counts{Migrated: 300, Discovered: 400}) || r.Files != (Counts{Migrated: 7, Discovered: 10}) {
+		t.Fatalf("unexpected counts: messages %+v files %+v", r.Messages, r.Files)
+	}
+	// 100 left in the failed task plus two unrun tasks at 200 on average
+	if r.RemainingMessages != 500 {
+		t.Fatalf("expected 500 remaining, got %d", r.RemainingMessages)
+	}
+	if r.MessagesPerMinute != 10 {
+		t.Fatalf("expected 10 messages per minute, got %v", r.MessagesPerMinute)
+	}
+	if r.ETA == nil || !r.ETA.Equal(now.Add(50*time.Minute)) {
+		t.Fatalf("expected ETA in 50 minutes, got %v", r.ETA)
+	}
+}
+
+func TestCompute_NoThroughput(t *testing.T) {
+	p := &model.Project{ID: "p1"}
+	tasks := []model.Task{{Status: model.StatusPending}}
+	r := Compute(p, tasks, Ledger{}, 15*time.Minute, time.Now())
+	if r.ETA != nil || r.RemainingMessages != 0 || r.MessagesPerMinute != 0 {
+		t.Fatalf("expected no estimate, got %+v", r)
+	}
+}
+
+func TestCompute_CountsGenerationsOnce(t *testing.T) {
+	p := &model.Project{ID: "p1"}
+	tasks := []model.Task{
+		// c1 was migrated, rerun in full, then continued by a delta
+		{SourcePath: "c1", Generation: 1, Mode: model.ModeFull, Status: model.StatusSuccess, Report: &model.TaskReport{MessagesFound: 100, FilesFound: 2, MessagesImported: 100}},
+		{SourcePath: "c1", Generation: 2, Mode: model.ModeFull, Status: model.StatusSuccess, Report: &model.TaskReport{MessagesFound: 120, FilesFound: 3, MessagesImported: 20, MessagesSkipped: 100}},
+		{SourcePath: "c1", Generation: 3, Mode: model.ModeDelta, Status: model.StatusFailed, Report: &model.TaskReport{MessagesFound: 10, FilesFound: 1, MessagesImported: 4}},
+		// c2's rerun has not run yet
+		{SourcePath: "c2", Generation: 1, Mode: model.ModeFull, Status: model.StatusSuccess, Report: &model.TaskReport{MessagesFound: 50, MessagesImported: 50}},
+		{SourcePath: "c2", Generation: 2, Mode: model.ModeFull, Status: model.StatusPending},
+	}
+	r := Compute(p, tasks, Ledger{Messages: 174}, 15*time.Minute, time.Now())
+	if r.Messages.Discovered != 180 || r.Files.Discovered != 4 {
+		t.Fatalf("expected 180 messages and 4 files discovered, got %+v %+v", r.Messages, r.Files)
+	}
+	// 6 left in c1's delta; c2's pending rerun is not estimated again
+	if r.RemainingMessages != 6 || r.TasksTotal != 5 {
+		t.Fatalf("expected 6 remaining of 5 tasks, got %d of %d", r.RemainingMessages, r.TasksTotal)
+	}
+}
@@ -0,0 +1,351 @@
+// Package projectconfig exports a project's configuration as a YAML document
+// and applies such documents back, so migration definitions can live in git.
+package projectconfig
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"example.com/go-migrator/internal/identity"
+	"example.com/go-migrator/internal/mapping"
+	"example.com/go-migrator/internal/model"
+	"example.com/go-migrator/internal/store"
+)
+
+// Version is the document format written by Export.
+const Version = 1
+
+// Document is the declarative configuration of one project. Connectors are
+// referenced by ID; their credentials are never part of a document.
+type Document struct {
+	Version           int                `json:"version" yaml:"version"`
+	Name              string             `json:"name" yaml:"name"`
+	Connectors        Connectors         `json:"connectors" yaml:"connectors"`
+	Retention         Retention          `json:"retention" yaml:"retention"`
+	UnmappedSenders   UnmappedSenders    `json:"unmapped_senders" yaml:"unmapped_senders"`
+	Schedule          Schedule           `json:"schedule" yaml:"schedule"`
+	MappingRules      []MappingRule      `json:"mapping_rules" yaml:"mapping_rules"`
+	IdentityOverrides []IdentityOverride `json:"identity_overrides" yaml:"identity_overrides"`
+}
+
+type Connectors struct {
+	Source string `json:"source" yaml:"source"`
+	Target string `json:"target" yaml:"target"`
+}
+
+type Retention struct {
+	Days      int  `json:"days" yaml:"days"`
+	LegalHold bool `json:"legal_hold" yaml:"legal_hold"`
+}
+
+type UnmappedSenders struct {
+	Policy              model.UnmappedSenderPolicy `json:"policy" yaml:"policy"`
+	FallbackTeamsUserID string                     `json:"fallback_teams_user_id,omitempty" yaml:"fallback_teams_user_id,omitempty"`
+	FallbackDisplayName string                     `json:"fallback_display_name,omitempty" yaml:"fallback_display_name,omitempty"`
+}
+
+// Schedule is the project's migration window, in UTC; a missing end is open.
+type Schedule struct {
+	Start *time.Time `json:"start,omitempty" yaml:"start,omitempty"`
+	End   *time.Time `json:"end,omitempty" yaml:"end,omitempty"`
+}
+
+func utc(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	u := t.UTC()
+	return &u
+}
+
+// MappingRule mirrors model.MappingRule.
+type MappingRule struct {
+	Match       string `json:"match,omitempty" yaml:"match,omitempty"`
+	Team        string `json:"team,omitempty" yaml:"team,omitempty"`
+	Channel     string `json:"channel,omitempty" yaml:"channel,omitempty"`
+	TeamType    string `json:"team_type,omitempty" yaml:"team_type,omitempty"`
+	ChannelType string `json:"channel_type,omitempty" yaml:"channel_type,omitempty"`
+}
+
+// IdentityOverride is an identity mapping that only applies to the project.
+type IdentityOverride struct {
+	ZoomUserID             string `json:"zoom_user_id" yaml:"zoom_user_id"`
+	ZoomUserEmail          string `json:"zoom_user_email,omitempty" yaml:"zoom_user_email,omitempty"`
+	ZoomUserDisplayName    string `json:"zoom_user_display_name,omitempty" yaml:"zoom_user_display_name,omitempty"`
+	TeamsUserID            string `json:"teams_user_id,omitempty" yaml:"teams_user_id,omitempty"`
+	TeamsUserPrincipalName string `json:"teams_user_principal_name,omitempty" yaml:"teams_user_principal_name,omitempty"`
+	TeamsUserDisplayName   string `json:"teams_user_display_name,omitempty" yaml:"teams_user_display_name,omitempty"`
+}
+
+// Export builds the document describing the project.
+func Export(stm *store.StoreManager, project *model.Project) (*Document, error) {
+	overrides, err := stm.Identity.ListOverrides(project.ID)
+	if err != nil {
+		return nil, fmt.Errorf("list identity overrides: %w", err)
+	}
+	doc := &Document{
+		Version:    Version,
+		Name:       project.Name,
+		Connectors: Connectors{Source: project.SourceConnectorID, Target: project.TargetConnectorID},
+		Retention:  Retention{Days: project.RetentionDays, LegalHold: project.LegalHold},
+		UnmappedSenders: UnmappedSenders{
+			Policy:              project.UnmappedSenderPolicy,
+			FallbackTeamsUserID: project.FallbackTeamsUserID,
+			FallbackDisplayName: project.FallbackTeamsUserDisplayName,
+		},
+		Schedule: Schedule{Start: utc(project.ScheduleStart), End: utc(project.ScheduleEnd)},
+	}
+	for _, r := range project.MappingRules {
+		doc.MappingRules = append(doc.MappingRules, MappingRule(r))
+	}
+	for _, id := range overrides {
+		doc.IdentityOverrides = append(doc.IdentityOverrides, IdentityOverride{
+			ZoomUserID:             id.ZoomUserID,
+			ZoomUserEmail:          id.ZoomUserEmail,
+			ZoomUserDisplayName:    id.ZoomUserDisplayName,
+			TeamsUserID:            id.TeamsUserID,
+			TeamsUserPrincipalName: id.TeamsUserPrincipalName,
+			TeamsUserDisplayName:   id.TeamsUserDisplayName,
+		})
+	}
+	sort.Slice(doc.IdentityOverrides, func(i, j int) bool {
+		return doc.IdentityOverrides[i].ZoomUserID < doc.IdentityOverrides[j].ZoomUserID
+	})
+	return doc, nil
+}
+
+// Marshal encodes the document as YAML.
+func Marshal(doc *Document) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), enc.Close()
+}
+
+// Parse decodes and validates a YAML document. Unknown keys are rejected so
+// typos do not silently drop settings.
+func Parse(r io.Reader) (*Document, error) {
+	dec := yaml.NewDecoder(r)
+	dec.KnownFields(true)
+	var doc Document
+	if err := dec.Decode(&doc); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("empty document")
+		}
+		return nil, fmt.Errorf("invalid yaml: %w", err)
+	}
+	if err := doc.Validate(); err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// Validate checks the settings that do not need the store. Connector
+// references are checked by the caller.
+func (d *Document) Validate() error {
+	if d.Version != Version {
+		return fmt.Errorf("unsupported version %d, expected %d", d.Version, Version)
+	}
+	if d.Name == "" {
+		return errors.New("name required")
+	}
+	if d.Retention.Days < 0 {
+		return errors.New("retention.days must not be negative")
+	}
+	if d.UnmappedSenders.Policy == "" {
+		d.UnmappedSenders.Policy = model.UnmappedFail
+	}
+	if !d.UnmappedSenders.Policy.Valid() {
+		return errors.New("unmapped_senders.policy must be fail, fallback or fallback_attributed")
+	}
+	if d.UnmappedSenders.Policy != model.UnmappedFail && d.UnmappedSenders.FallbackTeamsUserID == "" {
+		return errors.New("unmapped_senders.fallback_teams_user_id required for fallback policies")
+	}
+	d.Schedule = Schedule{Start: utc(d.Schedule.Start), End: utc(d.Schedule.End)}
+	if s := d.Schedule; s.Start != nil && s.End != nil && !s.End.After(*s.Start) {
+		return errors.New("schedule.end must be after schedule.start")
+	}
+	if _, err := mapping.Compile(d.rules()); err != nil {
+		return fmt.Errorf("mapping_rules: %w", err)
+	}
+	seen := map[string]bool{}
+	for i := range d.IdentityOverrides {
+		o := &d.IdentityOverrides[i]
+		if err := identity.Validate(o.identity("")); err != nil {
+			return fmt.Errorf("identity_overrides[%d]: %w", i, err)
+		}
+		if seen[o.ZoomUserID] {
+			return fmt.Errorf("identity_overrides[%d]: duplicate zoom_user_id %s", i, o.ZoomUserID)
+		}
+		seen[o.ZoomUserID] = true
+	}
+	return nil
+}
+
+func (d *Document) rules() []model.MappingRule {
+	var rules []model.MappingRule
+	for _, r := range d.MappingRules {
+		rules = append(rules, model.MappingRule(r))
+	}
+	return rules
+}
+
+func (o *IdentityOverride) identity(projectID string) *model.Identity {
+	return &model.Identity{
+		ProjectID:              projectID,
+		ZoomUserID:             o.ZoomUserID,
+		ZoomUserEmail:          o.ZoomUserEmail,
+		ZoomUserDisplayName:    o.ZoomUserDisplayName,
+		TeamsUserID:            o.TeamsUserID,
+		TeamsUserPrincipalName: o.TeamsUserPrincipalName,
+		TeamsUserDisplayName:   o.TeamsUserDisplayName,
+	}
+}
+
+// Change is one difference between the current and the desired document.
+type Change struct {
+	// Path names the setting, e.g. "retention.days" or
+	// "identity_overrides[<zoom user id>]".
+	Path   string `json:"path"`
+	Action string `json:"action"`
+	Old    any    `json:"old"`
+	New    any    `json:"new"`
+}
+
+// Change actions.
+const (
+	ActionAdd    = "add"
+	ActionUpdate = "update"
+	ActionRemove = "remove"
+)
+
+// Diff lists what applying desired would change, in document order.
+func Diff(current, desired *Document) []Change {
+	var changes []Change
+	field := func(path string, old, new any) {
+		if !reflect.DeepEqual(old, new) {
+			changes = append(changes, Change{Path: path, Action: ActionUpdate, Old: old, New: new})
+		}
+	}
+	field("name", current.Name, desired.Name)
+	field("connectors.source", current.Connectors.Source, desired.Connectors.Source)
+	field("connectors.target", current.Connectors.Target, desired.Connectors.Target)
+	field("retention.days", current.Retention.Days, desired.Retention.Days)
+	field("retention.legal_hold", current.Retention.LegalHold, desired.Retention.LegalHold)
+	field("unmapped_senders", current.UnmappedSenders, desired.UnmappedSenders)
+	field("schedule", current.Schedule, desired.Schedule)
+	if len(current.MappingRules) != 0 || len(desired.MappingRules) != 0 {
+		field("mapping_rules", current.MappingRules, desired.MappingRules)
+	}
+
+	have := make(map[string]IdentityOverride, len(current.IdentityOverrides))
+	for _, o := range current.IdentityOverrides {
+		have[o.ZoomUserID] = o
+	}
+	want := make(map[string]bool, len(desired.IdentityOverrides))
+	for _, o := range desired.IdentityOverrides {
+		want[o.ZoomUserID] = true
+		path := "identity_overrides[" + o.ZoomUserID + "]"
+		old, ok := have[o.ZoomUserID]
+		switch {
+		case !ok:
+			changes = append(changes, Change{Path: path, Action: ActionAdd, New: o})
+		case old != o:
+			changes = append(changes, Change{Path: path, Action: ActionUpdate, Old: old, New: o})
+		}
+	}
+	for _, o := range current.IdentityOverrides {
+		if !want[o.ZoomUserID] {
+			changes = append(changes, Change{Path: "identity_overrides[" + o.ZoomUserID + "]", Action: ActionRemove, Old: o})
+		}
+	}
+	return changes
+}
+
+// ErrPlanLocked is returned by Apply when the project's plan has been
+// approved, so its configuration can no longer change.
+var ErrPlanLocked = errors.New("project plan is approved")
+
+// Apply brings the project in line with desired and returns what changed.
+// Changes are applied one at a time; if one fails, those before it stay
+// applied, and applying the same document again finishes the job.
+// Connector references must have been checked by the caller. Once the
+// project is approved, Apply fails with ErrPlanLocked unless nothing changes.
+func Apply(stm *store.StoreManager, project *model.Project, desired *Document) ([]Change, error) {
+	current, err := Export(stm, project)
+	if err != nil {
+		return nil, err
+	}
+	changes := Diff(current, desired)
+	if len(changes) > 0 && !project.State.PlanEditable() {
+		return nil, fmt.Errorf("%w: project is %s; withdraw the approval before changing its configuration", ErrPlanLocked, project.State)
+	}
+	changed := map[string]bool{}
+	for _, ch := range changes {
+		changed[ch.Path] = true
+	}
+
+	if changed["name"] || changed["connectors.source"] || changed["connectors.target"] {
+		project.Name = desired.Name
+		project.SourceConnectorID = desired.Connectors.Source
+		project.TargetConnectorID = desired.Connectors.Target
+		if err := stm.Project.Update(project); err != nil {
+			return nil, fmt.Errorf("update project: %w", err)
+		}
+	}
+	if changed["retention.days"] || changed["retention.legal_hold"] {
+		if err := stm.Project.UpdateRetention(project.ID, desired.Retention.Days, desired.Retention.LegalHold); err != nil {
+			return nil, fmt.Errorf("update retention: %w", err)
+		}
+	}
+	if changed["unmapped_senders"] {
+		u := desired.UnmappedSenders
+		if err := stm.Project.UpdateUnmappedSenderPolicy(project.ID, u.Policy, u.FallbackTeamsUserID, u.FallbackDisplayName); err != nil {
+			return nil, fmt.Errorf("update unmapped sender policy: %w", err)
+		}
+	}
+	if changed["schedule"] {
+		if err := stm.Project.UpdateSchedule(project.ID, desired.Schedule.Start, desired.Schedule.End); err != nil {
+			return nil, fmt.Errorf("update schedule: %w", err)
+		}
+	}
+	if changed["mapping_rules"] {
+		if err := stm.Project.UpdateMappingRules(project.ID, desired.rules()); err != nil {
+			return nil, fmt.Errorf("update mapping rules: %w", err)
+		}
+	}
+
+	overrides, err := stm.Identity.ListOverrides(project.ID)
+	if err != nil {
+		return nil, fmt.Errorf("list identity overrides: %w", err)
+	}
+	ids := make(map[string]uint, len(overrides))
+	for _, o := range overrides {
+		ids[o.ZoomUserID] = o.ID
+	}
+	for _, ch := range changes {
+		if ch.Action == ActionRemove {
+			if o, ok := ch.Old.(IdentityOverride); ok {
+				if err := stm.Identity.Delete(ids[o.ZoomUserID]); err != nil && err != store.ErrNotFound {
+					return nil, fmt.Errorf("delete identity override %s: %w", o.ZoomUserID, err)
+				}
+			}
+		} else if o, ok := ch.New.(IdentityOverride); ok {
+			// an upsert resets the validation of a changed mapping
+			if _, err := stm.Identity.Upsert(o.identity(project.ID)); err != nil {
+				return nil, fmt.Errorf("save identity override %s: %w", o.ZoomUserID, err)
+			}
+		}
+	}
+	return changes, nil
+}
@@ -0,0 +1,172 @@
+package projectconfig
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"example.com/go-migrator/internal/model"
+	"example.com/go-migrator/internal/store"
+)
+
+const sample = `
+version: 1
+name: Sales
+connectors:
+  source: zc1
+  target: tc1
+retention:
+  days: 90
+unmapped_senders:
+  policy: fallback
+  fallback_teams_user_id: bot
+schedule:
+  start: 2024-06-01T22:00:00+02:00
+mapping_rules:
+  - match: ^sales-(?P<region>\w+)$
+    team: Sales
+    channel: "{region}"
+identity_overrides:
+  - zoom_user_id: z1
+    teams_user_id: t1
+`
+
+func TestParse(t *testing.T) {
+	doc, err := Parse(strings.NewReader(sample))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if doc.Connectors.Target != "tc1" || doc.Retention.Days != 90 || doc.UnmappedSenders.Policy != model.UnmappedFallback {
+		t.Fatalf("unexpected document: %+v", doc)
+	}
+	if doc.Schedule.Start == nil || doc.Schedule.Start.Format(time.RFC3339) != "2024-06-01T20:00:00Z" || doc.Schedule.End != nil {
+		t.Fatalf("expected an open-ended schedule in UTC, got %+v", doc.Schedule)
+	}
+	if len(doc.MappingRules) != 1 || doc.MappingRules[0].Channel != "{region}" {
+		t.Fatalf("unexpected rules: %+v", doc.MappingRules)
+	}
+
+	// the document survives a round trip
+	out, err := Marshal(doc)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	again, err := Parse(strings.NewReader(string(out)))
+	if err != nil {
+		t.Fatalf("parse exported: %v", err)
+	}
+	if !reflect.DeepEqual(doc, again) {
+		t.Fatalf("round trip changed the document:\n%+v\n%+v", doc, again)
+	}
+}
+
+func TestParse_Rejects(t *testing.T) {
+	cases := map[string]string{
+		"unknown key":  "version: 1\nname: x\nretention:\n  dayz: 3\n",
+		"version":      "version: 2\nname: x\n",
+		"bad rule":     "version: 1\nname: x\nmapping_rules:\n  - match: \"(\"\n",
+		"no fallback":  "version: 1\nname: x\nunmapped_senders:\n  policy: fallback\n",
+		"schedule":     "version: 1\nname: x\nschedule:\n  start: 2024-06-02T00:00:00Z\n  end: 2024-06-01T00:00:00Z\n",
+		"duplicate id": "version: 1\nname: x\nidentity_overrides:\n  - {zoom_user_id: z1, teams_user_id: t1}\n  - {zoom_user_id: z1, teams_user_id: t2}\n",
+	}
+	for name, in := range cases {
+		if _, err := Parse(strings.NewReader(in)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	current := &Document{
+		Name:       "Sales",
+		Connectors: Connectors{Source: "zc1", Target: "tc1"},
+		IdentityOverrides: []IdentityOverride{
+			{ZoomUserID: "z1", TeamsUserID: "t1"},
+			{ZoomUserID: "z2", TeamsUserID: "t2"},
+		},
+	}
+	desired := &Document{
+		Name:       "Sales",
+		Connectors: Connectors{Source: "zc1", Target: "tc2"},
+		Retention:  Retention{Days: 30},
+		IdentityOverrides: []IdentityOverride{
+			{ZoomUserID: "z1", TeamsUserID: "t9"},
+			{ZoomUserID: "z3", TeamsUserID: "t3"},
+		},
+	}
+	var got []string
+	for _, ch := range Diff(current, desired) {
+		got = append(got, ch.Action+" "+ch.Path)
+	}
+	want := []string{
+		"update connectors.target",
+		"update retention.days",
+		"update identity_overrides[z1]",
+		"add identity_overrides[z3]",
+		"remove identity_overrides[z2]",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("want %v got %v", want, got)
+	}
+	if len(Diff(desired, desired)) != 0 {
+		t.Fatal("expected no changes between identical documents")
+	}
+}
+
+func TestApply_RespectsLifecycle(t *testing.T) {
+	stm := store.NewStoreManager(newTestDB(t), nil).ForTenant("a")
+	p := &model.Project{Name: "Sales", State: model.ProjectPlanned, UnmappedSenderPolicy: model.UnmappedFail}
+	if err := stm.Project.Create(p); err != nil {
+		t.Fatal(err)
+	}
+	doc, err := Export(stm, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2024, 6, 1, 20, 0, 0, 0, time.UTC)
+	doc.Schedule.Start = &start
+
+	p.State = model.ProjectApproved
+	if _, err := Apply(stm, p, doc); !errors.Is(err, ErrPlanLocked) {
+		t.Fatalf("expected ErrPlanLocked for an approved project, got %v", err)
+	}
+
+	p.State = model.ProjectPlanned
+	changes, err := Apply(stm, p, doc)
+	if err != nil || len(changes) != 1 || changes[0].Path != "schedule" {
+		t.Fatalf("expected the schedule applied, got %v, %v", changes, err)
+	}
+	got, _ := stm.Project.GetByID(p.ID)
+	if got.ScheduleStart == nil || !got.ScheduleStart.Equal(start) {
+		t.Fatalf("expected the schedule stored, got %v", got.ScheduleStart)
+	}
+
+	// an unchanged document applies at any state
+	got.State = model.ProjectMigrating
+	if changes, err := Apply(stm, got, doc); err != nil || len(changes) != 0 {
+		t.Fatalf("expected no changes, got %v, %v", changes, err)
+	}
+}
+
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{TranslateError: true, Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	if err := store.AutoMigrate(db, "default"); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
@@ -0,0 +1,70 @@
+package retention
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"example.com/go-migrator/internal/store"
+)
+
+// Purger periodically removes finished tasks that are past their project's
+// retention period. Purging happens in two phases: tasks are first
+// soft-deleted, then permanently removed once they have stayed soft-deleted
+// for the grace period. Projects under legal hold are skipped entirely, so a
+// hold placed during the grace period still protects soft-deleted tasks.
+type Purger struct {
+	stm      *store.StoreManager
+	interval time.Duration
+	grace    time.Duration
+}
+
+// NewPurger creates a purger. stm must be the system-scoped store manager so
+// every tenant's projects are covered.
+func NewPurger(stm *store.StoreManager, interval, grace time.Duration) *Purger {
+	return &Purger{stm: stm, interval: interval, grace: grace}
+}
+
+// Start runs the purge loop in the background until ctx is cancelled.
+func (p *Purger) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+		for {
+			if err := p.RunOnce(time.Now()); err != nil {
+				log.Printf("retention: purge failed: %v", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// RunOnce performs a single purge pass as of now.
+func (p *Purger) RunOnce(now time.Time) error {
+	projects, err := p.stm.Project.ListPurgeable()
+	if err != nil {
+		return err
+	}
+	for _, project := range projects {
+		stm := p.stm.ForTenant(project.TenantID)
+		cutoff := now.AddDate(0, 0, -project.RetentionDays)
+		marked, err := stm.Task.SoftDeleteFinished(project.ID, cutoff)
+		if err != nil {
+			log.Printf("retention: project %s soft delete failed: %v", project.ID, err)
+			continue
+		}
+		purged, err := stm.Task.PurgeDeleted(project.ID, now.Add(-p.grace))
+		if err != nil {
+			log.Printf("retention: project %s purge failed: %v", project.ID, err)
+			continue
+		}
+		if marked > 0 || purged > 0 {
+			log.Printf("retention: project %s soft-deleted %d tasks, purged %d tasks", project.ID, marked, purged)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package retention
+
+import (
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"example.com/go-migrator/internal/model"
+	"example.com/go-migrator/internal/store"
+)
+
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{TranslateError: true, Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	if err := store.AutoMigrate(db, "default"); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestPurger_TwoPhasesAndLegalHold(t *testing.T) {
+	db := newTestDB(t)
+	stm := store.NewStoreManager(db, nil).ForTenant("a")
+
+	project := &model.Project{Name: "p", RetentionDays: 30}
+	held := &model.Project{Name: "held", RetentionDays: 30, LegalHold: true}
+	forever := &model.Project{Name: "forever"}
+	for _, p := range []*model.Project{project, held, forever} {
+		if err := stm.Project.Create(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	task := func(p *model.Project, path string, status model.TaskStatus) *model.Task {
+		tk := &model.Task{ProjectID: p.ID, SourcePath: path, TargetPath: "T/c", Status: status}
+		if err := stm.Task.Create(tk); err != nil {
+			t.Fatal(err)
+		}
+		return tk
+	}
+	done := task(project, "users/u/channels/1", model.StatusSuccess)
+	task(project, "users/u/channels/2", model.StatusFailed)
+	task(project, "users/u/channels/3", model.StatusRunning)
+	task(held, "users/u/channels/4", model.StatusSuccess)
+	task(forever, "users/u/channels/5", model.StatusSuccess)
+	if err := stm.Message.Record(&model.MessageRecord{ProjectID: project.ID, TaskID: done.ID, ZoomMessageID: "m1", TeamsChannelID: "ch", Status: model.MessageImported}); err != nil {
+		t.Fatal(err)
+	}
+
+	count := func(unscoped bool) int64 {
+		var n int64
+		q := db.Model(&model.Task{})
+		if unscoped {
+			q = q.Unscoped()
+		}
+		if err := q.Count(&n).Error; err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	p := NewPurger(store.NewStoreManager(db, nil), time.Hour, 60*24*time.Hour)
+	now := time.Now()
+
+	// past retention: finished tasks are soft-deleted, the running one stays
+	if err := p.RunOnce(now.AddDate(0, 0, 40)); err != nil {
+		t.Fatal(err)
+	}
+	if visible, all := count(false), count(true); visible != 3 || all != 5 {
+		t.Fatalf("expected 2 tasks soft-deleted, got %d visible of %d", visible, all)
+	}
+
+	// a hold placed during the grace period protects soft-deleted tasks
+	if err := stm.Project.UpdateRetention(project.ID, 30, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.RunOnce(now.AddDate(0, 0, 100)); err != nil {
+		t.Fatal(err)
+	}
+	if all := count(true); all != 5 {
+		t.Fatalf("expected nothing purged under legal hold, %d tasks left", all)
+	}
+
+	// once released, tasks past the grace period are removed with their ledger
+	if err := stm.Project.UpdateRetention(project.ID, 30, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.RunOnce(now.AddDate(0, 0, 100)); err != nil {
+		t.Fatal(err)
+	}
+	if visible, all := count(false), count(true); visible != 3 || all != 3 {
+		t.Fatalf("expected 2 tasks purged, got %d visible of %d", visible, all)
+	}
+	if recs, err := stm.Message.ListByTask(done.ID); err != nil || len(recs) != 0 {
+		t.Fatalf("expected the purged task's ledger removed, got %d, %v", len(recs), err)
+	}
+}
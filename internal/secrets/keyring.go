@@ -0,0 +1,167 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// ErrNoKeys is returned by NewKeyringFromEnv when no master keys are configured.
+var ErrNoKeys = errors.New("no master keys configured")
+
+// Keyring holds the master keys used for envelope encryption. Every record is
+// encrypted with its own random data key; the data key is then wrapped with the
+// active master key. Older master keys stay in the keyring so records sealed
+// under them can still be opened until they are rotated.
+type Keyring struct {
+	activeID string
+	keys     map[string][]byte
+}
+
+// Envelope is the persisted form of a sealed value. All fields are safe to
+// store in plain columns; none of them reveal the plaintext or the master key.
+type Envelope struct {
+	KeyID      string
+	WrappedKey string // base64(nonce || AES-GCM(master, data key))
+	Ciphertext string // base64(nonce || AES-GCM(data key, plaintext))
+}
+
+// NewKeyring creates a keyring from a set of 32-byte master keys. activeID
+// selects the key used for new encryptions and must be present in keys.
+func NewKeyring(activeID string, keys map[string][]byte) (*Keyring, error) {
+	if len(keys) == 0 {
+		return nil, ErrNoKeys
+	}
+	for id, k := range keys {
+		if len(k) != 32 {
+			return nil, fmt.Errorf("master key %q must be 32 bytes, got %d", id, len(k))
+		}
+	}
+	if _, ok := keys[activeID]; !ok {
+		return nil, fmt.Errorf("active master key %q not found", activeID)
+	}
+	return &Keyring{activeID: activeID, keys: keys}, nil
+}
+
+// NewKeyringFromEnv builds a keyring from CONNECTOR_MASTER_KEYS, a comma
+// separated list of id:base64key pairs, and CONNECTOR_ACTIVE_KEY_ID. The active
+// key ID may be omitted when only one key is configured.
+func NewKeyringFromEnv() (*Keyring, error) {
+	raw := strings.TrimSpace(os.Getenv("CONNECTOR_MASTER_KEYS"))
+	if raw == "" {
+		return nil, ErrNoKeys
+	}
+	keys := make(map[string][]byte)
+	var lastID string
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		id, enc, ok := strings.Cut(entry, ":")
+		if !ok || id == "" {
+			return nil, fmt.Errorf("invalid CONNECTOR_MASTER_KEYS entry %q, want id:base64key", entry)
+		}
+		key, err := base64.StdEncoding.DecodeString(enc)
+		if err != nil {
+			return nil, fmt.Errorf("decode master key %q: %w", id, err)
+		}
+		keys[id] = key
+		lastID = id
+	}
+	activeID := os.Getenv("CONNECTOR_ACTIVE_KEY_ID")
+	if activeID == "" {
+		if len(keys) > 1 {
+			return nil, fmt.Errorf("CONNECTOR_ACTIVE_KEY_ID required when more than one master key is configured")
+		}
+		activeID = lastID
+	}
+	return NewKeyring(activeID, keys)
+}
+
+// ActiveKeyID returns the ID of the master key used for new encryptions.
+func (k *Keyring) ActiveKeyID() string { return k.activeID }
+
+// Seal encrypts plaintext under a fresh data key wrapped by the active master key.
+func (k *Keyring) Seal(plaintext []byte) (*Envelope, error) {
+	dataKey := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return nil, fmt.Errorf("generate data key: %w", err)
+	}
+	wrapped, err := seal(k.keys[k.activeID], dataKey, []byte(k.activeID))
+	if err != nil {
+		return nil, fmt.Errorf("wrap data key: %w", err)
+	}
+	ct, err := seal(dataKey, plaintext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("encrypt data: %w", err)
+	}
+	return &Envelope{
+		KeyID:      k.activeID,
+		WrappedKey: base64.StdEncoding.EncodeToString(wrapped),
+		Ciphertext: base64.StdEncoding.EncodeToString(ct),
+	}, nil
+}
+
+// Open decrypts an envelope produced by Seal with any key in the keyring.
+func (k *Keyring) Open(e *Envelope) ([]byte, error) {
+	master, ok := k.keys[e.KeyID]
+	if !ok {
+		return nil, fmt.Errorf("master key %q not in keyring", e.KeyID)
+	}
+	wrapped, err := base64.StdEncoding.DecodeString(e.WrappedKey)
+	if err != nil {
+		return nil, fmt.Errorf("decode wrapped key: %w", err)
+	}
+	ct, err := base64.StdEncoding.DecodeString(e.Ciphertext)
+	if err != nil {
+		return nil, fmt.Errorf("decode ciphertext: %w", err)
+	}
+	dataKey, err := open(master, wrapped, []byte(e.KeyID))
+	if err != nil {
+		return nil, fmt.Errorf("unwrap data key: %w", err)
+	}
+	plaintext, err := open(dataKey, ct, nil)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt data: %w", err)
+	}
+	return plaintext, nil
+}
+
+func seal(key, plaintext, aad []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+func open(key, data, aad []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, ct := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ct, aad)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
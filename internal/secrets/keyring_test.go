@@ -0,0 +1,66 @@
+package secrets
+
+import (
+	"bytes"
+	"testing"
+)
+
+func testKey(b byte) []byte { return bytes.Repeat([]byte{b}, 32) }
+
+func TestKeyring_SealOpen(t *testing.T) {
+	kr, err := NewKeyring("k1", map[string][]byte{"k1": testKey(1)})
+	if err != nil {
+		t.Fatalf("new keyring: %v", err)
+	}
+	env, err := kr.Seal([]byte(`{"client_secret":"s3cret"}`))
+	if err != nil {
+		t.Fatalf("seal: %v", err)
+	}
+	if env.KeyID != "k1" {
+		t.Fatalf("unexpected key id: %s", env.KeyID)
+	}
+	if bytes.Contains([]byte(env.Ciphertext), []byte("s3cret")) {
+		t.Fatalf("ciphertext leaks plaintext")
+	}
+	got, err := kr.Open(env)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if string(got) != `{"client_secret":"s3cret"}` {
+		t.Fatalf("unexpected plaintext: %s", got)
+	}
+}
+
+func TestKeyring_Rotation(t *testing.T) {
+	old, _ := NewKeyring("k1", map[string][]byte{"k1": testKey(1)})
+	env, err := old.Seal([]byte("payload"))
+	if err != nil {
+		t.Fatalf("seal: %v", err)
+	}
+	rotated, err := NewKeyring("k2", map[string][]byte{"k1": testKey(1), "k2": testKey(2)})
+	if err != nil {
+		t.Fatalf("new keyring: %v", err)
+	}
+	// records sealed under the old key must still open
+	if _, err := rotated.Open(env); err != nil {
+		t.Fatalf("open with rotated keyring: %v", err)
+	}
+	env2, _ := rotated.Seal([]byte("payload"))
+	if env2.KeyID != "k2" {
+		t.Fatalf("expected new records under k2, got %s", env2.KeyID)
+	}
+	// a keyring without k2 must refuse
+	if _, err := old.Open(env2); err == nil {
+		t.Fatalf("expected error opening with missing key")
+	}
+}
+
+func TestKeyring_TamperedKeyID(t *testing.T) {
+	kr, _ := NewKeyring("k1", map[string][]byte{"k1": testKey(1), "k2": testKey(1)})
+	env, _ := kr.Seal([]byte("payload"))
+	// the key ID is authenticated, so swapping it must fail even with the same key bytes
+	env.KeyID = "k2"
+	if _, err := kr.Open(env); err == nil {
+		t.Fatalf("expected error for tampered key id")
+	}
+}
@@ -1,30 +1,157 @@
 package store
 
 import (
+	"errors"
+	"fmt"
+
 	"example.com/go-migrator/internal/model"
+	"example.com/go-migrator/internal/secrets"
 	"gorm.io/gorm"
 )
 
+// ErrNoKeyring is returned when connector secrets must be sealed but no master
+// keys were configured.
+var ErrNoKeyring = errors.New("connector encryption keys not configured")
+
 type ConnectorStore struct {
-	db *gorm.DB
+	db       *gorm.DB
+	tenantID string
+	keys     *secrets.Keyring
 }
 
-func NewConnectorStore(db *gorm.DB) *ConnectorStore {
-	return &ConnectorStore{db: db}
+func NewConnectorStore(db *gorm.DB, tenantID string, keys *secrets.Keyring) *ConnectorStore {
+	return &ConnectorStore{db: db, tenantID: tenantID, keys: keys}
 }
 
+func (s *ConnectorStore) scoped() *gorm.DB { return tenantScope(s.db, s.tenantID) }
+
 func (s *ConnectorStore) Create(connector *model.Connector) error {
+	if s.tenantID != "" {
+		connector.TenantID = s.tenantID
+	}
+	if err := s.seal(connector); err != nil {
+		return err
+	}
 	return s.db.Create(connector).Error
 }
 
 func (s *ConnectorStore) GetByID(id string) (*model.Connector, error) {
 	var connector model.Connector
-	err := s.db.First(&connector, "id = ?", id).Error
-	return &connector, err
+	if err := notFound(s.scoped().First(&connector, "id = ?", id).Error); err != nil {
+		return &connector, err
+	}
+	return &connector, s.open(&connector)
+}
+
+// List returns every connector without decrypting its credentials.
+func (s *ConnectorStore) List() ([]model.Connector, error) {
+	var connectors []model.Connector
+	err := s.scoped().Order("created_at, id").Find(&connectors).Error
+	return connectors, err
+}
+
+// Update overwrites the connector's user. Its credentials are re-sealed from
+// connector.Data when that is set and kept otherwise.
+func (s *ConnectorStore) Update(connector *model.Connector) error {
+	columns := []string{"user_id", "updated_at"}
+	if connector.Data != "" {
+		if err := s.seal(connector); err != nil {
+			return err
+		}
+		columns = append(columns, "data", "data_key", "key_id")
+	}
+	return s.scoped().Model(&model.Connector{}).Where("id = ?", connector.ID).
+		Select(columns).Updates(connector).Error
+}
+
+func (s *ConnectorStore) Delete(id string) error {
+	res := s.scoped().Where("id = ?", id).Delete(&model.Connector{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
 }
 
 func (s *ConnectorStore) GetByUserAndType(userID string, ctype model.ConnectorType) (*model.Connector, error) {
 	var connector model.Connector
-	err := s.db.First(&connector, "user_id = ? AND type = ?", userID, ctype).Error
-	return &connector, err
+	if err := notFound(s.scoped().First(&connector, "user_id = ? AND type = ?", userID, ctype).Error); err != nil {
+		return &connector, err
+	}
+	return &connector, s.open(&connector)
+}
+
+// RotateKeys re-encrypts every connector that is not sealed under the active
+// master key, including legacy plaintext rows. It returns the number of rows
+// rewritten.
+func (s *ConnectorStore) RotateKeys() (int, error) {
+	if s.keys == nil {
+		return 0, ErrNoKeyring
+	}
+	var (
+		batch   []model.Connector
+		rotated int
+	)
+	res := s.scoped().Where("key_id <> ? OR key_id IS NULL", s.keys.ActiveKeyID()).
+		FindInBatches(&batch, 100, func(tx *gorm.DB, _ int) error {
+			for i := range batch {
+				c := &batch[i]
+				if err := s.open(c); err != nil {
+					return fmt.Errorf("open connector %s: %w", c.ID, err)
+				}
+				if err := s.seal(c); err != nil {
+					return fmt.Errorf("seal connector %s: %w", c.ID, err)
+				}
+				err := s.scoped().Model(&model.Connector{}).Where("id = ?", c.ID).Updates(map[string]any{
+					"data":     c.EncryptedData,
+					"data_key": c.DataKey,
+					"key_id":   c.KeyID,
+				}).Error
+				if err != nil {
+					return fmt.Errorf("update connector %s: %w", c.ID, err)
+				}
+				rotated++
+			}
+			return nil
+		})
+	return rotated, res.Error
+}
+
+// seal encrypts connector.Data into the persisted columns.
+func (s *ConnectorStore) seal(connector *model.Connector) error {
+	if s.keys == nil {
+		return ErrNoKeyring
+	}
+	env, err := s.keys.Seal([]byte(connector.Data))
+	if err != nil {
+		return err
+	}
+	connector.EncryptedData = env.Ciphertext
+	connector.DataKey = env.WrappedKey
+	connector.KeyID = env.KeyID
+	return nil
+}
+
+// open decrypts the persisted columns into connector.Data.
+func (s *ConnectorStore) open(connector *model.Connector) error {
+	if connector.KeyID == "" {
+		// legacy row written before encryption was introduced
+		connector.Data = connector.EncryptedData
+		return nil
+	}
+	if s.keys == nil {
+		return ErrNoKeyring
+	}
+	plaintext, err := s.keys.Open(&secrets.Envelope{
+		KeyID:      connector.KeyID,
+		WrappedKey: connector.DataKey,
+		Ciphertext: connector.EncryptedData,
+	})
+	if err != nil {
+		return err
+	}
+	connector.Data = string(plaintext)
+	return nil
 }
@@ -0,0 +1,36 @@
+package store
+
+import (
+	"example.com/go-migrator/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type FinalizationStore struct {
+	db       *gorm.DB
+	tenantID string
+}
+
+func NewFinalizationStore(db *gorm.DB, tenantID string) *FinalizationStore {
+	return &FinalizationStore{db: db, tenantID: tenantID}
+}
+
+func (s *FinalizationStore) scoped() *gorm.DB { return tenantScope(s.db, s.tenantID) }
+
+// Save inserts or updates the record of rec's project and team.
+func (s *FinalizationStore) Save(rec *model.TeamFinalization) error {
+	if s.tenantID != "" {
+		rec.TenantID = s.tenantID
+	}
+	return s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "tenant_id"}, {Name: "project_id"}, {Name: "teams_team_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"team_name", "status", "completed_channels", "error", "attempts", "finalized_at", "updated_at"}),
+	}).Create(rec).Error
+}
+
+// List returns a project's team records ordered by team name.
+func (s *FinalizationStore) List(projectID string) ([]model.TeamFinalization, error) {
+	var recs []model.TeamFinalization
+	err := s.scoped().Where("project_id = ?", projectID).Order("team_name, teams_team_id").Find(&recs).Error
+	return recs, err
+}
@@ -1,30 +1,421 @@
 package store
 
 import (
+	"errors"
+	"strings"
+	"time"
+
 	"example.com/go-migrator/internal/model"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type IdentityStore struct {
-	db *gorm.DB
+	db       *gorm.DB
+	tenantID string
 }
 
-func NewIdentityStore(db *gorm.DB) *IdentityStore {
-	return &IdentityStore{db: db}
+func NewIdentityStore(db *gorm.DB, tenantID string) *IdentityStore {
+	return &IdentityStore{db: db, tenantID: tenantID}
 }
 
+func (s *IdentityStore) scoped() *gorm.DB { return tenantScope(s.db, s.tenantID) }
+
+// Create inserts a new identity. It returns ErrIdentityExists if the Zoom
+// user is already mapped in the identity's project scope.
 func (s *IdentityStore) Create(identity *model.Identity) error {
-	return s.db.Create(identity).Error
+	if s.tenantID != "" {
+		identity.TenantID = s.tenantID
+	}
+	return identityExists(s.db.Create(identity).Error)
+}
+
+// identityExists translates a violation of uq_identity_scope.
+func identityExists(err error) error {
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return ErrIdentityExists
+	}
+	return err
 }
 
+// GetByZoomID returns the tenant-wide mapping of a Zoom user.
 func (s *IdentityStore) GetByZoomID(zoomID string) (*model.Identity, error) {
+	return s.GetForProject("", zoomID)
+}
+
+// GetForProject returns the mapping of a Zoom user in exactly the given
+// project scope; an empty projectID means the tenant-wide mapping.
+func (s *IdentityStore) GetForProject(projectID, zoomID string) (*model.Identity, error) {
 	var identity model.Identity
-	err := s.db.First(&identity, "zoom_user_id = ?", zoomID).Error
+	err := notFound(s.scoped().First(&identity, "zoom_user_id = ? AND project_id = ?", zoomID, projectID).Error)
 	return &identity, err
 }
 
+// Resolve returns the mapping a migration of projectID uses for a Zoom user,
+// with its validation result for that project. An alias is first replaced by
+// the Zoom user it points to; then the project's own mapping wins over the
+// tenant-wide one.
+func (s *IdentityStore) Resolve(projectID, zoomID string) (*model.Identity, error) {
+	var alias model.IdentityAlias
+	err := s.scoped().First(&alias, "alias_zoom_user_id = ?", zoomID).Error
+	if err == nil {
+		zoomID = alias.ZoomUserID
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	var identities []model.Identity
+	err = s.scoped().Where("zoom_user_id = ? AND project_id IN ?", zoomID, projectScope(projectID)).
+		Find(&identities).Error
+	if err == nil {
+		err = s.withValidation(projectID, identities)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var resolved *model.Identity
+	for i := range identities {
+		if identities[i].ProjectID != "" {
+			resolved = &identities[i]
+			break
+		}
+		resolved = &identities[i]
+	}
+	if resolved == nil {
+		return nil, ErrNotFound
+	}
+	return resolved, nil
+}
+
+// withValidation fills in the identities' validation results for a project.
+// A mapping that only names a UPN takes the Teams user ID the UPN resolved to
+// in the project's destination tenant.
+func (s *IdentityStore) withValidation(projectID string, identities []model.Identity) error {
+	if len(identities) == 0 {
+		return nil
+	}
+	ids := make([]uint, len(identities))
+	for i := range identities {
+		ids[i] = identities[i].ID
+	}
+	var results []model.IdentityValidation
+	if err := s.db.Where("project_id = ? AND identity_id IN ?", projectID, ids).Find(&results).Error; err != nil {
+		return err
+	}
+	byID := make(map[uint]*model.IdentityValidation, len(results))
+	for i := range results {
+		byID[results[i].IdentityID] = &results[i]
+	}
+	for i := range identities {
+		v, ok := byID[identities[i].ID]
+		if !ok {
+			continue
+		}
+		identities[i].ValidationStatus = v.Status
+		identities[i].ValidationError = v.Error
+		identities[i].ValidatedAt = &v.ValidatedAt
+		if identities[i].TeamsUserID == "" {
+			identities[i].TeamsUserID = v.TeamsUserID
+		}
+	}
+	return nil
+}
+
+// forgetValidation drops an identity's validation results, which no longer
+// hold once its mapping points at another Teams user.
+func forgetValidation(tx *gorm.DB, identityID uint) error {
+	return tx.Where("identity_id = ?", identityID).Delete(&model.IdentityValidation{}).Error
+}
+
+// projectScope lists the project_id values visible to a project: its own
+// overrides and the tenant-wide mappings.
+func projectScope(projectID string) []string {
+	if projectID == "" {
+		return []string{""}
+	}
+	return []string{"", projectID}
+}
+
+// ZoomIDByEmail returns the Zoom user ID of the user with the given email,
+// as known from the tenant's identities or, failing that, from the proposals
+// of the matching job. Emails are compared without regard to case.
+func (s *IdentityStore) ZoomIDByEmail(email string) (string, error) {
+	email = strings.ToLower(email)
+	var identity model.Identity
+	err := s.scoped().Where("LOWER(zoom_user_email) = ? AND zoom_user_id <> ''", email).Order("id").First(&identity).Error
+	if err == nil {
+		return identity.ZoomUserID, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", err
+	}
+	var proposal model.IdentityProposal
+	err = notFound(s.scoped().Where("LOWER(zoom_user_email) = ? AND zoom_user_id <> ''", email).Order("id").First(&proposal).Error)
+	return proposal.ZoomUserID, err
+}
+
 func (s *IdentityStore) GetByTeamsID(teamsID string) (*model.Identity, error) {
 	var identity model.Identity
-	err := s.db.First(&identity, "teams_user_id = ?", teamsID).Error
+	err := notFound(s.scoped().First(&identity, "teams_user_id = ?", teamsID).Error)
+	return &identity, err
+}
+
+// Upsert creates the identity for identity.ZoomUserID in identity.ProjectID's
+// scope or updates the existing one in place. Fields identity leaves empty
+// keep their stored value, so a partial re-import does not erase them, and
+// identity is filled in with them. It reports whether a new identity was
+// created.
+func (s *IdentityStore) Upsert(identity *model.Identity) (bool, error) {
+	if s.tenantID != "" {
+		identity.TenantID = s.tenantID
+	}
+	created := false
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		// uq_identity_scope decides between concurrent upserts of one user
+		res := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "tenant_id"}, {Name: "project_id"}, {Name: "zoom_user_id"}},
+			DoNothing: true,
+		}).Create(identity)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 1 {
+			created = true
+			return nil
+		}
+		var existing model.Identity
+		err := tenantScope(tx, s.tenantID).First(&existing, "zoom_user_id = ? AND project_id = ?", identity.ZoomUserID, identity.ProjectID).Error
+		if err != nil {
+			return err
+		}
+		changed := mergeIdentity(identity, &existing)
+		if err := tx.Model(&existing).Select(identityMappingColumns).Updates(identity).Error; err != nil {
+			return err
+		}
+		if changed {
+			return forgetValidation(tx, existing.ID)
+		}
+		return nil
+	})
+	return created, err
+}
+
+// mergeIdentity fills the fields in left empty from the stored identity. The
+// Teams user ID and UPN name one user, so one of them is only kept while the
+// other is empty or still names the stored user. It reports whether in maps
+// to another Teams user than stored, which must be validated again.
+func mergeIdentity(in, stored *model.Identity) bool {
+	in.ID = stored.ID
+	in.CreatedAt = stored.CreatedAt
+	if in.ZoomUserEmail == "" {
+		in.ZoomUserEmail = stored.ZoomUserEmail
+	}
+	if in.ZoomUserDisplayName == "" {
+		in.ZoomUserDisplayName = stored.ZoomUserDisplayName
+	}
+	sameID := in.TeamsUserID == "" || in.TeamsUserID == stored.TeamsUserID
+	sameUPN := in.TeamsUserPrincipalName == "" || strings.EqualFold(in.TeamsUserPrincipalName, stored.TeamsUserPrincipalName)
+	if in.TeamsUserID == "" && sameUPN {
+		in.TeamsUserID = stored.TeamsUserID
+	}
+	if in.TeamsUserPrincipalName == "" && sameID {
+		in.TeamsUserPrincipalName = stored.TeamsUserPrincipalName
+	}
+	if sameID && sameUPN && in.TeamsUserDisplayName == "" {
+		in.TeamsUserDisplayName = stored.TeamsUserDisplayName
+	}
+	return !sameTeamsUser(in, stored)
+}
+
+// sameTeamsUser reports whether two mappings name the same Teams user.
+func sameTeamsUser(a, b *model.Identity) bool {
+	return a.TeamsUserID == b.TeamsUserID && strings.EqualFold(a.TeamsUserPrincipalName, b.TeamsUserPrincipalName)
+}
+
+// identityMappingColumns are the columns an upsert or an update writes.
+var identityMappingColumns = []string{
+	"zoom_user_email", "zoom_user_display_name",
+	"teams_user_id", "teams_user_principal_name", "teams_user_display_name",
+	"updated_at",
+}
+
+func (s *IdentityStore) GetByID(id uint) (*model.Identity, error) {
+	var identity model.Identity
+	err := notFound(s.scoped().First(&identity, "id = ?", id).Error)
 	return &identity, err
 }
+
+// List returns a page of identities ordered by ID and the total number of
+// matches. A non-empty search matches Zoom and Teams emails, UPNs, IDs and
+// display names.
+func (s *IdentityStore) List(search string, offset, limit int) ([]model.Identity, int64, error) {
+	query := s.scoped().Model(&model.Identity{})
+	if search != "" {
+		like := "%" + escapeLike(search) + "%"
+		query = query.Where(
+			"zoom_user_id = ? OR teams_user_id = ? OR zoom_user_email LIKE ? OR zoom_user_display_name LIKE ? OR teams_user_principal_name LIKE ? OR teams_user_display_name LIKE ?",
+			search, search, like, like, like, like,
+		)
+	}
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var identities []model.Identity
+	err := query.Order("id").Offset(offset).Limit(limit).Find(&identities).Error
+	return identities, total, err
+}
+
+// Update overwrites the mapping columns of the identity with identity.ID. A
+// mapping moved to another Teams user loses its validation results. It
+// returns ErrIdentityExists if the identity would map a Zoom user that is
+// already mapped in its project scope.
+func (s *IdentityStore) Update(identity *model.Identity) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var stored model.Identity
+		if err := notFound(tenantScope(tx, s.tenantID).First(&stored, "id = ?", identity.ID).Error); err != nil {
+			return err
+		}
+		err := tx.Model(&stored).Select(append([]string{"zoom_user_id", "project_id"}, identityMappingColumns...)).Updates(identity).Error
+		if err != nil {
+			return identityExists(err)
+		}
+		if !sameTeamsUser(identity, &stored) {
+			return forgetValidation(tx, stored.ID)
+		}
+		return nil
+	})
+}
+
+func (s *IdentityStore) Delete(id uint) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		res := tenantScope(tx, s.tenantID).Where("id = ?", id).Delete(&model.Identity{})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrNotFound
+		}
+		return forgetValidation(tx, id)
+	})
+}
+
+// ListAfter returns up to limit identities visible to a project with an ID
+// greater than afterID, ordered by ID, for walking them in batches.
+func (s *IdentityStore) ListAfter(projectID string, afterID uint, limit int) ([]model.Identity, error) {
+	var identities []model.Identity
+	err := s.scoped().Where("project_id IN ? AND id > ?", projectScope(projectID), afterID).Order("id").Limit(limit).Find(&identities).Error
+	return identities, err
+}
+
+// ListOverrides returns the mappings that only apply to the project, ordered
+// by Zoom user ID.
+func (s *IdentityStore) ListOverrides(projectID string) ([]model.Identity, error) {
+	var identities []model.Identity
+	err := s.scoped().Where("project_id = ?", projectID).Order("zoom_user_id").Find(&identities).Error
+	return identities, err
+}
+
+// SetValidation records the result of checking an identity against the
+// destination tenant of a project, replacing the previous one. A non-empty
+// teamsUserID is the user a mapping that only named a UPN resolved to in that
+// tenant; the mapping itself is not changed.
+func (s *IdentityStore) SetValidation(projectID string, id uint, status, errMsg, teamsUserID string, at time.Time) error {
+	result := &model.IdentityValidation{
+		TenantID:    s.tenantID,
+		ProjectID:   projectID,
+		IdentityID:  id,
+		TeamsUserID: teamsUserID,
+		Status:      status,
+		Error:       errMsg,
+		ValidatedAt: at,
+	}
+	return s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "identity_id"}, {Name: "project_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"teams_user_id", "status", "error", "validated_at"}),
+	}).Create(result).Error
+}
+
+// withResults queries the identities visible to a project joined with their
+// validation result for it, v, if they have one.
+func (s *IdentityStore) withResults(projectID string) *gorm.DB {
+	q := s.db.Model(&model.Identity{}).
+		Joins("LEFT JOIN identity_validations v ON v.identity_id = identities.id AND v.project_id = ?", projectID).
+		Where("identities.project_id IN ?", projectScope(projectID))
+	if s.tenantID != "" {
+		q = q.Where("identities.tenant_id = ?", s.tenantID)
+	}
+	return q
+}
+
+// CountByValidationStatus counts the identities visible to a project per
+// validation status for that project; never validated identities are counted
+// under "".
+func (s *IdentityStore) CountByValidationStatus(projectID string) (map[string]int64, error) {
+	var rows []struct {
+		Status string
+		Count  int64
+	}
+	err := s.withResults(projectID).
+		Select("COALESCE(v.status, '') AS status, COUNT(*) AS count").
+		Group("COALESCE(v.status, '')").Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int64, len(rows))
+	for _, r := range rows {
+		counts[r.Status] = r.Count
+	}
+	return counts, nil
+}
+
+// ListInvalid returns up to limit identities visible to a project that are
+// broken or not validated for it, with their validation results.
+func (s *IdentityStore) ListInvalid(projectID string, limit int) ([]model.Identity, error) {
+	var identities []model.Identity
+	err := s.withResults(projectID).Select("identities.*").
+		Where("v.status IS NULL OR v.status <> ?", model.IdentityValid).
+		Order("identities.id").Limit(limit).Find(&identities).Error
+	if err == nil {
+		err = s.withValidation(projectID, identities)
+	}
+	return identities, err
+}
+
+// AddAlias makes alias.AliasZoomUserID resolve to alias.ZoomUserID. It returns
+// ErrAliasExists if the alias is already taken.
+func (s *IdentityStore) AddAlias(alias *model.IdentityAlias) error {
+	if s.tenantID != "" {
+		alias.TenantID = s.tenantID
+	}
+	err := s.db.Create(alias).Error
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return ErrAliasExists
+	}
+	return err
+}
+
+// ListAliases returns the aliases pointing at a Zoom user.
+func (s *IdentityStore) ListAliases(zoomID string) ([]model.IdentityAlias, error) {
+	var aliases []model.IdentityAlias
+	err := s.scoped().Where("zoom_user_id = ?", zoomID).Order("id").Find(&aliases).Error
+	return aliases, err
+}
+
+// GetAlias returns the alias record of a Zoom user ID.
+func (s *IdentityStore) GetAlias(aliasZoomID string) (*model.IdentityAlias, error) {
+	var alias model.IdentityAlias
+	err := notFound(s.scoped().First(&alias, "alias_zoom_user_id = ?", aliasZoomID).Error)
+	return &alias, err
+}
+
+func (s *IdentityStore) DeleteAlias(aliasZoomID string) error {
+	res := s.scoped().Where("alias_zoom_user_id = ?", aliasZoomID).Delete(&model.IdentityAlias{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,210 @@
+package store
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"example.com/go-migrator/internal/model"
+)
+
+func TestIdentityStore_UpsertKeepsFieldsItLeavesEmpty(t *testing.T) {
+	stm := NewStoreManager(newTestDB(t), nil).ForTenant("a")
+	full := &model.Identity{ZoomUserID: "z1", ZoomUserEmail: "a@zoom.example", TeamsUserID: "t1", TeamsUserPrincipalName: "a@contoso.example", TeamsUserDisplayName: "A"}
+	if created, err := stm.Identity.Upsert(full); err != nil || !created {
+		t.Fatalf("expected z1 created, got %v, %v", created, err)
+	}
+	if err := stm.Identity.SetValidation("p1", full.ID, model.IdentityValid, "", "", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	// a re-import naming the same user by UPN only keeps the rest
+	partial := &model.Identity{ZoomUserID: "z1", TeamsUserPrincipalName: "A@contoso.example", ZoomUserDisplayName: "Ann"}
+	if created, err := stm.Identity.Upsert(partial); err != nil || created {
+		t.Fatalf("expected z1 updated, got %v, %v", created, err)
+	}
+	got, err := stm.Identity.GetByZoomID("z1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ZoomUserEmail != "a@zoom.example" || got.TeamsUserID != "t1" || got.TeamsUserDisplayName != "A" || got.ZoomUserDisplayName != "Ann" {
+		t.Fatalf("expected the stored fields kept, got %+v", got)
+	}
+	if got, _ = stm.Identity.Resolve("p1", "z1"); got.ValidationStatus != model.IdentityValid || partial.TeamsUserID != "t1" {
+		t.Fatalf("expected the unchanged mapping to stay validated, got %+v", got)
+	}
+
+	// another UPN is another user: the old Teams ID must not stay with it
+	if _, err := stm.Identity.Upsert(&model.Identity{ZoomUserID: "z1", TeamsUserPrincipalName: "b@contoso.example"}); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ = stm.Identity.Resolve("p1", "z1"); got.TeamsUserID != "" || got.TeamsUserDisplayName != "" || got.ValidationStatus != "" {
+		t.Fatalf("expected the Teams user replaced and validation reset, got %+v", got)
+	}
+	if got.ZoomUserEmail != "a@zoom.example" {
+		t.Fatalf("expected the Zoom email kept, got %+v", got)
+	}
+}
+
+func TestIdentityStore_ZoomIDByEmail(t *testing.T) {
+	db := newTestDB(t)
+	stm := NewStoreManager(db, nil).ForTenant("a")
+	if err := stm.Identity.Create(&model.Identity{ZoomUserID: "z1", ZoomUserEmail: "Ann@zoom.example", TeamsUserID: "t1"}); err != nil {
+		t.Fatal(err)
+	}
+	proposal := &model.IdentityProposal{TenantID: "a", ZoomUserID: "z2", ZoomUserEmail: "bob@zoom.example", Status: model.ProposalPending}
+	if err := db.Create(proposal).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if id, err := stm.Identity.ZoomIDByEmail("ann@ZOOM.example"); err != nil || id != "z1" {
+		t.Fatalf("expected z1 from the identities, got %q, %v", id, err)
+	}
+	if id, err := stm.Identity.ZoomIDByEmail("bob@zoom.example"); err != nil || id != "z2" {
+		t.Fatalf("expected z2 from the proposals, got %q, %v", id, err)
+	}
+	if _, err := stm.Identity.ZoomIDByEmail("nobody@zoom.example"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	if _, err := NewStoreManager(db, nil).ForTenant("b").Identity.ZoomIDByEmail("bob@zoom.example"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("tenant b resolved tenant a's user: %v", err)
+	}
+}
+
+func TestIdentityStore_OneMappingPerScope(t *testing.T) {
+	stm := NewStoreManager(newTestDB(t), nil).ForTenant("a")
+	for i := 0; i < 2; i++ {
+		if _, err := stm.Identity.Upsert(&model.Identity{ZoomUserID: "z1", TeamsUserID: "t1"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := stm.Identity.Upsert(&model.Identity{ProjectID: "p1", ZoomUserID: "z1", TeamsUserID: "t1-p1"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, total, err := stm.Identity.List("", 0, 10); err != nil || total != 2 {
+		t.Fatalf("expected one tenant-wide and one project mapping, got %d, %v", total, err)
+	}
+	if err := stm.Identity.Create(&model.Identity{ZoomUserID: "z1", TeamsUserID: "t2"}); !errors.Is(err, ErrIdentityExists) {
+		t.Fatalf("expected ErrIdentityExists, got %v", err)
+	}
+	override, _ := stm.Identity.GetForProject("p1", "z1")
+	override.ProjectID = ""
+	if err := stm.Identity.Update(override); !errors.Is(err, ErrIdentityExists) {
+		t.Fatalf("expected moving the override onto the tenant-wide mapping to fail, got %v", err)
+	}
+}
+
+func TestAutoMigrate_DedupesIdentities(t *testing.T) {
+	db := newTestDB(t)
+	if err := db.Migrator().DropIndex(&model.Identity{}, "uq_identity_scope"); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []model.Identity{
+		{TenantID: "a", ZoomUserID: "z1", TeamsUserID: "first"},
+		{TenantID: "a", ZoomUserID: "z1", TeamsUserID: "second"},
+		{TenantID: "a", ProjectID: "p1", ZoomUserID: "z1", TeamsUserID: "override"},
+		{TenantID: "b", ZoomUserID: "z1", TeamsUserID: "other tenant"},
+	} {
+		if err := db.Create(&id).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := AutoMigrate(db, "default"); err != nil {
+		t.Fatal(err)
+	}
+	var kept []model.Identity
+	if err := db.Order("id").Find(&kept).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(kept) != 3 || kept[0].TeamsUserID != "first" {
+		t.Fatalf("expected the oldest duplicate kept and the rest untouched, got %+v", kept)
+	}
+	if !db.Migrator().HasIndex(&model.Identity{}, "uq_identity_scope") {
+		t.Fatal("expected uq_identity_scope created")
+	}
+}
+
+func TestIdentityStore_ValidationIsPerProject(t *testing.T) {
+	stm := NewStoreManager(newTestDB(t), nil).ForTenant("a")
+	upnOnly := &model.Identity{ZoomUserID: "z1", TeamsUserPrincipalName: "ann@contoso.example"}
+	if err := stm.Identity.Create(upnOnly); err != nil {
+		t.Fatal(err)
+	}
+	// the two projects migrate into different tenants
+	now := time.Now()
+	if err := stm.Identity.SetValidation("p1", upnOnly.ID, model.IdentityValid, "", "t-tenant1", now); err != nil {
+		t.Fatal(err)
+	}
+	if err := stm.Identity.SetValidation("p2", upnOnly.ID, model.IdentityNotFound, "user does not exist", "", now); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, err := stm.Identity.Resolve("p1", "z1"); err != nil || got.ValidationStatus != model.IdentityValid || got.TeamsUserID != "t-tenant1" {
+		t.Fatalf("expected z1 valid as t-tenant1 in p1, got %+v, %v", got, err)
+	}
+	if got, err := stm.Identity.Resolve("p2", "z1"); err != nil || got.ValidationStatus != model.IdentityNotFound || got.TeamsUserID != "" {
+		t.Fatalf("expected z1 not found in p2, got %+v, %v", got, err)
+	}
+	if got, _ := stm.Identity.GetByZoomID("z1"); got.TeamsUserID != "" {
+		t.Fatalf("expected the mapping itself unchanged, got %+v", got)
+	}
+	if counts, err := stm.Identity.CountByValidationStatus("p1"); err != nil || counts[model.IdentityValid] != 1 || len(counts) != 1 {
+		t.Fatalf("unexpected p1 counts %v, %v", counts, err)
+	}
+	if invalid, err := stm.Identity.ListInvalid("p2", 10); err != nil || len(invalid) != 1 || invalid[0].ValidationError != "user does not exist" {
+		t.Fatalf("expected z1 listed as invalid in p2, got %+v, %v", invalid, err)
+	}
+	if counts, _ := stm.Identity.CountByValidationStatus("p3"); counts[""] != 1 {
+		t.Fatalf("expected z1 not validated in p3, got %v", counts)
+	}
+
+	// pointing the mapping at another user drops every project's result
+	if _, err := stm.Identity.Upsert(&model.Identity{ZoomUserID: "z1", TeamsUserPrincipalName: "bob@contoso.example"}); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := stm.Identity.Resolve("p1", "z1"); got.ValidationStatus != "" || got.TeamsUserID != "" {
+		t.Fatalf("expected the changed mapping to need validation, got %+v", got)
+	}
+}
+
+func TestAutoMigrate_MovesValidationResults(t *testing.T) {
+	db := newTestDB(t)
+	// the schema before results were stored per project
+	for _, stmt := range []string{
+		"DROP TABLE identity_validations",
+		"ALTER TABLE `identities` ADD COLUMN `validation_status` varchar(20)",
+		"ALTER TABLE `identities` ADD COLUMN `validation_error` varchar(255)",
+		"ALTER TABLE `identities` ADD COLUMN `validated_at` datetime",
+		"CREATE INDEX `idx_identity_validation` ON `identities`(`validation_status`)",
+	} {
+		if err := db.Exec(stmt).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, id := range []model.Identity{
+		{TenantID: "a", ZoomUserID: "z1", TeamsUserID: "t1"},
+		{TenantID: "a", ProjectID: "p1", ZoomUserID: "z1", TeamsUserID: "t1-p1"},
+	} {
+		if err := db.Create(&id).Error; err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Exec("UPDATE identities SET validation_status = ?, validated_at = ? WHERE id = ?", model.IdentityValid, time.Now(), id.ID).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := AutoMigrate(db, "default"); err != nil {
+		t.Fatal(err)
+	}
+	stm := NewStoreManager(db, nil).ForTenant("a")
+	if got, err := stm.Identity.Resolve("p1", "z1"); err != nil || got.ValidationStatus != model.IdentityValid {
+		t.Fatalf("expected the override's result kept for p1, got %+v, %v", got, err)
+	}
+	if got, err := stm.Identity.Resolve("p2", "z1"); err != nil || got.ValidationStatus != "" {
+		t.Fatalf("expected the tenant-wide mapping to need validation in p2, got %+v, %v", got, err)
+	}
+	if db.Migrator().HasColumn(&model.Identity{}, "validation_status") {
+		t.Fatal("expected the old validation columns dropped")
+	}
+}
@@ -0,0 +1,46 @@
+package store
+
+import (
+	"example.com/go-migrator/internal/model"
+	"gorm.io/gorm"
+)
+
+type InventoryStore struct {
+	db       *gorm.DB
+	tenantID string
+}
+
+func NewInventoryStore(db *gorm.DB, tenantID string) *InventoryStore {
+	return &InventoryStore{db: db, tenantID: tenantID}
+}
+
+func (s *InventoryStore) scoped() *gorm.DB { return tenantScope(s.db, s.tenantID) }
+
+// ReplaceChannels swaps a project's inventory for the result of a new
+// discovery run.
+func (s *InventoryStore) ReplaceChannels(projectID string, channels []model.DiscoveredChannel) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		err := tenantScope(tx, s.tenantID).Where("project_id = ?", projectID).Delete(&model.DiscoveredChannel{}).Error
+		if err != nil {
+			return err
+		}
+		if len(channels) == 0 {
+			return nil
+		}
+		for i := range channels {
+			channels[i].ID = 0
+			channels[i].ProjectID = projectID
+			if s.tenantID != "" {
+				channels[i].TenantID = s.tenantID
+			}
+		}
+		return tx.CreateInBatches(channels, 200).Error
+	})
+}
+
+// ListChannels returns a project's inventory ordered by channel name.
+func (s *InventoryStore) ListChannels(projectID string) ([]model.DiscoveredChannel, error) {
+	var channels []model.DiscoveredChannel
+	err := s.scoped().Where("project_id = ?", projectID).Order("name, zoom_channel_id").Find(&channels).Error
+	return channels, err
+}
@@ -0,0 +1,81 @@
+package store
+
+import (
+	"time"
+
+	"example.com/go-migrator/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type MessageStore struct {
+	db       *gorm.DB
+	tenantID string
+}
+
+func NewMessageStore(db *gorm.DB, tenantID string) *MessageStore {
+	return &MessageStore{db: db, tenantID: tenantID}
+}
+
+func (s *MessageStore) scoped() *gorm.DB { return tenantScope(s.db, s.tenantID) }
+
+// Record inserts or updates the ledger entry for rec's Zoom message in rec's
+// Teams channel.
+func (s *MessageStore) Record(rec *model.MessageRecord) error {
+	if s.tenantID != "" {
+		rec.TenantID = s.tenantID
+	}
+	return s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "tenant_id"}, {Name: "teams_channel_id"}, {Name: "zoom_message_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"project_id", "task_id", "teams_team_id", "teams_message_id", "status", "error", "files", "updated_at"}),
+	}).Create(rec).Error
+}
+
+// importedBatch caps the Zoom message IDs looked up in one query.
+const importedBatch = 500
+
+// ImportedIn returns which of the given Zoom messages were already imported
+// into a Teams channel, mapped to the Teams message IDs they were imported as.
+// Only the listed messages are looked up, so callers can check a page or a
+// thread at a time instead of loading the channel's whole ledger.
+func (s *MessageStore) ImportedIn(teamsChannelID string, zoomIDs []string) (map[string]string, error) {
+	ids := make(map[string]string, len(zoomIDs))
+	for start := 0; start < len(zoomIDs); start += importedBatch {
+		end := min(start+importedBatch, len(zoomIDs))
+		var recs []model.MessageRecord
+		err := s.scoped().Select("zoom_message_id", "teams_message_id").
+			Where("teams_channel_id = ? AND status = ? AND zoom_message_id IN ?", teamsChannelID, model.MessageImported, zoomIDs[start:end]).
+			Find(&recs).Error
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range recs {
+			ids[r.ZoomMessageID] = r.TeamsMessageID
+		}
+	}
+	return ids, nil
+}
+
+func (s *MessageStore) ListByTask(taskID string) ([]model.MessageRecord, error) {
+	var recs []model.MessageRecord
+	err := s.scoped().Where("task_id = ?", taskID).Order("id").Find(&recs).Error
+	return recs, err
+}
+
+// CountImported returns how many of the project's messages were imported, and
+// how many files they carried, since the given time; a zero time counts them
+// all.
+func (s *MessageStore) CountImported(projectID string, since time.Time) (messages, files int64, err error) {
+	var row struct {
+		Messages int64
+		Files    int64
+	}
+	q := s.scoped().Model(&model.MessageRecord{}).
+		Select("COUNT(*) AS messages, COALESCE(SUM(files), 0) AS files").
+		Where("project_id = ? AND status = ?", projectID, model.MessageImported)
+	if !since.IsZero() {
+		q = q.Where("updated_at >= ?", since)
+	}
+	err = q.Scan(&row).Error
+	return row.Messages, row.Files, err
+}
@@ -0,0 +1,65 @@
+package store
+
+import (
+	"fmt"
+	"testing"
+
+	"example.com/go-migrator/internal/model"
+)
+
+func TestMessageStore_ImportedIn(t *testing.T) {
+	stm := NewStoreManager(newTestDB(t), nil).ForTenant("a")
+	record := func(zoomID, channelID, teamsID string, status model.MessageStatus) {
+		t.Helper()
+		rec := &model.MessageRecord{ZoomMessageID: zoomID, TeamsChannelID: channelID, TeamsMessageID: teamsID, Status: status}
+		if err := stm.Message.Record(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	record("m1", "ch1", "t1", model.MessageImported)
+	record("m2", "ch1", "", model.MessageFailed)
+	record("m1", "ch2", "t9", model.MessageImported)
+
+	ids, err := stm.Message.ImportedIn("ch1", []string{"m1", "m2", "m3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 1 || ids["m1"] != "t1" {
+		t.Fatalf("expected only m1 imported into ch1, got %v", ids)
+	}
+
+	// a retry that succeeds replaces the failed entry instead of adding one
+	record("m2", "ch1", "t2", model.MessageImported)
+	if ids, _ = stm.Message.ImportedIn("ch1", []string{"m1", "m2"}); len(ids) != 2 || ids["m2"] != "t2" {
+		t.Fatalf("expected m2 imported after the retry, got %v", ids)
+	}
+	var n int64
+	if err := stm.db.Model(&model.MessageRecord{}).Where("teams_channel_id = ?", "ch1").Count(&n).Error; err != nil || n != 2 {
+		t.Fatalf("expected one ledger entry per message and channel, got %d, %v", n, err)
+	}
+}
+
+func TestMessageStore_ImportedInLooksUpOnlyTheListedMessages(t *testing.T) {
+	stm := NewStoreManager(newTestDB(t), nil).ForTenant("a")
+	var zoomIDs []string
+	for n := 0; n < importedBatch+10; n++ {
+		id := fmt.Sprintf("m%d", n)
+		rec := &model.MessageRecord{ZoomMessageID: id, TeamsChannelID: "ch", TeamsMessageID: "t-" + id, Status: model.MessageImported}
+		if err := stm.Message.Record(rec); err != nil {
+			t.Fatal(err)
+		}
+		zoomIDs = append(zoomIDs, id)
+	}
+
+	ids, err := stm.Message.ImportedIn("ch", []string{"m1", "m7", "missing"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 2 || ids["m7"] != "t-m7" {
+		t.Fatalf("expected only m1 and m7, got %v", ids)
+	}
+	// more IDs than fit in one query are looked up in batches
+	if ids, err = stm.Message.ImportedIn("ch", zoomIDs); err != nil || len(ids) != len(zoomIDs) {
+		t.Fatalf("expected all %d messages, got %d, %v", len(zoomIDs), len(ids), err)
+	}
+}
@@ -0,0 +1,143 @@
+package store
+
+import (
+	"fmt"
+	"os"
+
+	"example.com/go-migrator/internal/model"
+	"gorm.io/gorm"
+)
+
+// DefaultTenantID returns the tenant that owns rows written before
+// multi-tenancy was introduced (DEFAULT_TENANT_ID, "default" if unset).
+func DefaultTenantID() string {
+	if t := os.Getenv("DEFAULT_TENANT_ID"); t != "" {
+		return t
+	}
+	return "default"
+}
+
+// AutoMigrate creates or updates the schema for all models and applies the
+// changes gorm's AutoMigrate cannot express on its own, such as dropping
+// replaced indexes and backfilling new columns.
+func AutoMigrate(db *gorm.DB, defaultTenantID string) error {
+	models := []any{&model.Task{}, &model.Identity{}, &model.Project{}, &model.Connector{}, &model.MessageRecord{}, &model.IdentityProposal{}, &model.IdentityAlias{}, &model.DiscoveredChannel{}, &model.TeamFinalization{}, &model.TeamClaim{}, &model.IdentityValidation{}}
+	if err := dedupeIdentities(db); err != nil {
+		return err
+	}
+	legacyValidation := db.Migrator().HasTable(&model.Identity{}) && db.Migrator().HasColumn(&model.Identity{}, "validation_status")
+	if err := db.AutoMigrate(models...); err != nil {
+		return fmt.Errorf("auto migrate: %w", err)
+	}
+	if legacyValidation {
+		if err := moveValidationResults(db); err != nil {
+			return err
+		}
+	}
+
+	// source paths used to be unique; several generations may now share one,
+	// and only active generations are unique (uq_task_active_source)
+	for _, idx := range []string{"uq_task_source_path", "uq_task_tenant_source_path"} {
+		if db.Migrator().HasIndex(&model.Task{}, idx) {
+			if err := db.Migrator().DropIndex(&model.Task{}, idx); err != nil {
+				return fmt.Errorf("drop %s: %w", idx, err)
+			}
+		}
+	}
+	err := db.Model(&model.Task{}).
+		Where("status IN ? AND active_source_path IS NULL", []model.TaskStatus{model.StatusPending, model.StatusRunning}).
+		Update("active_source_path", gorm.Expr("source_path")).Error
+	if err != nil {
+		return fmt.Errorf("backfill active_source_path: %w", err)
+	}
+
+	// team_finalizations.teams_team_id also holds chat IDs since chats are
+	// finalized; make sure existing tables were widened for them
+	if err := widenColumn(db, &model.TeamFinalization{}, "teams_team_id", 128); err != nil {
+		return err
+	}
+
+	// projects created before lifecycle states are migrating if they already
+	// have tasks and drafts otherwise
+	tasks := db.Model(&model.Task{}).Select("1").Where("tasks.project_id = projects.id")
+	err = db.Model(&model.Project{}).Where("state = '' AND EXISTS (?)", tasks).Update("state", model.ProjectMigrating).Error
+	if err == nil {
+		err = db.Model(&model.Project{}).Where("state = ''").Update("state", model.ProjectDraft).Error
+	}
+	if err != nil {
+		return fmt.Errorf("backfill project state: %w", err)
+	}
+
+	// rows created before multi-tenancy belong to the default tenant
+	for _, m := range models {
+		err := db.Model(m).Where("tenant_id = '' OR tenant_id IS NULL").Update("tenant_id", defaultTenantID).Error
+		if err != nil {
+			return fmt.Errorf("backfill tenant_id: %w", err)
+		}
+	}
+	return nil
+}
+
+// dedupeIdentities prepares tables created before uq_identity_scope: a Zoom
+// user may have been mapped twice in one scope by concurrent upserts. The
+// oldest mapping, the one lookups and upserts used, is kept.
+func dedupeIdentities(db *gorm.DB) error {
+	m := db.Migrator()
+	if !m.HasTable(&model.Identity{}) || m.HasIndex(&model.Identity{}, "uq_identity_scope") ||
+		!m.HasColumn(&model.Identity{}, "tenant_id") || !m.HasColumn(&model.Identity{}, "project_id") {
+		return nil
+	}
+	// MySQL cannot delete from a table it reads in a subquery unless the
+	// subquery is materialized in a derived table
+	err := db.Exec("DELETE FROM identities WHERE id NOT IN (SELECT id FROM (" +
+		"SELECT MIN(id) AS id FROM identities GROUP BY tenant_id, project_id, zoom_user_id) AS oldest)").Error
+	if err != nil {
+		return fmt.Errorf("dedupe identities: %w", err)
+	}
+	return nil
+}
+
+// moveValidationResults moves validation results off the identities table,
+// where one result was shared by every project, into identity_validations.
+// The results of project overrides are kept for their project. Tenant-wide
+// mappings may have been checked against any project's tenant, so they must
+// be validated again per project.
+func moveValidationResults(db *gorm.DB) error {
+	err := db.Exec("INSERT INTO identity_validations (tenant_id, project_id, identity_id, teams_user_id, status, error, validated_at) " +
+		"SELECT tenant_id, project_id, id, '', validation_status, COALESCE(validation_error, ''), validated_at FROM identities " +
+		"WHERE project_id <> '' AND validation_status <> '' AND validated_at IS NOT NULL").Error
+	if err != nil {
+		return fmt.Errorf("move validation results: %w", err)
+	}
+	if db.Migrator().HasIndex(&model.Identity{}, "idx_identity_validation") {
+		if err := db.Migrator().DropIndex(&model.Identity{}, "idx_identity_validation"); err != nil {
+			return fmt.Errorf("drop idx_identity_validation: %w", err)
+		}
+	}
+	for _, column := range []string{"validation_status", "validation_error", "validated_at"} {
+		if err := db.Migrator().DropColumn(&model.Identity{}, column); err != nil {
+			return fmt.Errorf("drop identities.%s: %w", column, err)
+		}
+	}
+	return nil
+}
+
+// widenColumn alters a string column of m to the size its field declares if
+// the database reports it shorter than size.
+func widenColumn(db *gorm.DB, m any, column string, size int64) error {
+	types, err := db.Migrator().ColumnTypes(m)
+	if err != nil {
+		return fmt.Errorf("inspect %s: %w", column, err)
+	}
+	for _, ct := range types {
+		if ct.Name() != column {
+			continue
+		}
+		if length, ok := ct.Length(); ok && length < size {
+			if err := db.Migrator().AlterColumn(m, column); err != nil {
+				return fmt.Errorf("widen %s: %w", column, err)
+			}
+		}
+	}
+	return nil
+}
@@ -1,30 +1,174 @@
 package store
 
 import (
+	"time"
+
 	"example.com/go-migrator/internal/model"
 	"gorm.io/gorm"
 )
 
 type ProjectStore struct {
-	db *gorm.DB
+	db       *gorm.DB
+	tenantID string
 }
 
-func NewProjectStore(db *gorm.DB) *ProjectStore {
-	return &ProjectStore{db: db}
+func NewProjectStore(db *gorm.DB, tenantID string) *ProjectStore {
+	return &ProjectStore{db: db, tenantID: tenantID}
 }
 
+func (s *ProjectStore) scoped() *gorm.DB { return tenantScope(s.db, s.tenantID) }
+
 func (s *ProjectStore) Create(project *model.Project) error {
+	if s.tenantID != "" {
+		project.TenantID = s.tenantID
+	}
 	return s.db.Create(project).Error
 }
 
 func (s *ProjectStore) GetByID(id string) (*model.Project, error) {
 	var project model.Project
-	err := s.db.First(&project, "id = ?", id).Error
+	err := notFound(s.scoped().First(&project, "id = ?", id).Error)
 	return &project, err
 }
 
+// List returns every project ordered by name.
+func (s *ProjectStore) List() ([]model.Project, error) {
+	var projects []model.Project
+	err := s.scoped().Order("name, id").Find(&projects).Error
+	return projects, err
+}
+
+// Update overwrites the project's name and connectors. Retention and sender
+// policy have their own setters.
+func (s *ProjectStore) Update(project *model.Project) error {
+	return s.scoped().Model(&model.Project{}).Where("id = ?", project.ID).
+		Select("name", "source_connector_id", "target_connector_id", "updated_at").Updates(project).Error
+}
+
+func (s *ProjectStore) Delete(id string) error {
+	res := s.scoped().Where("id = ?", id).Delete(&model.Project{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
 func (s *ProjectStore) ListByConnector(connectorID string) ([]model.Project, error) {
 	var projects []model.Project
-	err := s.db.Where("source_connector_id = ? OR target_connector_id = ?", connectorID, connectorID).Find(&projects).Error
+	err := s.scoped().Where("source_connector_id = ? OR target_connector_id = ?", connectorID, connectorID).Find(&projects).Error
 	return projects, err
 }
+
+// ListPurgeable returns the projects with a retention period that are not
+// under legal hold.
+func (s *ProjectStore) ListPurgeable() ([]model.Project, error) {
+	var projects []model.Project
+	err := s.scoped().Where("retention_days > 0 AND legal_hold = ?", false).Find(&projects).Error
+	return projects, err
+}
+
+// UpdateRetention sets the project's retention period and legal hold.
+func (s *ProjectStore) UpdateRetention(id string, retentionDays int, legalHold bool) error {
+	return s.scoped().Model(&model.Project{}).Where("id = ?", id).Updates(map[string]any{
+		"retention_days": retentionDays,
+		"legal_hold":     legalHold,
+	}).Error
+}
+
+// UpdateUnmappedSenderPolicy sets how the project handles senders without an
+// identity mapping.
+func (s *ProjectStore) UpdateUnmappedSenderPolicy(id string, policy model.UnmappedSenderPolicy, fallbackUserID, fallbackDisplayName string) error {
+	return s.scoped().Model(&model.Project{}).Where("id = ?", id).Updates(map[string]any{
+		"unmapped_sender_policy":           policy,
+		"fallback_teams_user_id":           fallbackUserID,
+		"fallback_teams_user_display_name": fallbackDisplayName,
+	}).Error
+}
+
+// UpdateSchedule sets the project's migration window; nil leaves that end open.
+func (s *ProjectStore) UpdateSchedule(id string, start, end *time.Time) error {
+	return s.scoped().Model(&model.Project{}).Where("id = ?", id).Updates(map[string]any{
+		"schedule_start": start,
+		"schedule_end":   end,
+	}).Error
+}
+
+// SetDiscovery records when the project's last discovery run finished and
+// why it failed, if it did.
+func (s *ProjectStore) SetDiscovery(id string, at time.Time, errMsg string) error {
+	return s.scoped().Model(&model.Project{}).Where("id = ?", id).Updates(map[string]any{
+		"discovered_at":   at,
+		"discovery_error": errMsg,
+	}).Error
+}
+
+// UpdateMappingRules replaces the project's mapping rules.
+func (s *ProjectStore) UpdateMappingRules(id string, rules []model.MappingRule) error {
+	return s.scoped().Model(&model.Project{}).Where("id = ?", id).
+		Select("mapping_rules").Updates(&model.Project{MappingRules: rules}).Error
+}
+
+// SetState moves the project from one lifecycle state to another. The update
+// only applies while the project is still in from, so concurrent transitions
+// cannot both succeed; the loser gets ErrStateChanged. Moving to approved
+// records approvedBy and at, and moving back before approval clears them.
+func (s *ProjectStore) SetState(id string, from, to model.ProjectState, approvedBy string, at time.Time) error {
+	if from == to && to != model.ProjectApproved {
+		// nothing changes, and MySQL would report no affected rows
+		var n int64
+		if err := s.scoped().Model(&model.Project{}).Where("id = ? AND state = ?", id, from).Count(&n).Error; err != nil {
+			return err
+		}
+		if n == 0 {
+			return ErrStateChanged
+		}
+		return nil
+	}
+	fields := map[string]any{"state": to}
+	switch to {
+	case model.ProjectApproved:
+		fields["approved_by"] = approvedBy
+		fields["approved_at"] = at
+	case model.ProjectDraft, model.ProjectDiscovered, model.ProjectPlanned:
+		fields["approved_by"] = ""
+		fields["approved_at"] = nil
+	}
+	res := s.scoped().Model(&model.Project{}).Where("id = ? AND state = ?", id, from).Updates(fields)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrStateChanged
+	}
+	return nil
+}
+
+// LockFinalize takes the project's finalize lock for holder until until, or
+// extends it if holder has it already. A lease that ran out before now may be
+// taken over, so a crashed run does not block finalizing for good. It returns
+// ErrFinalizeLocked while another holder's lease runs.
+func (s *ProjectStore) LockFinalize(id, holder string, now, until time.Time) error {
+	res := s.scoped().Model(&model.Project{}).
+		Where("id = ? AND (finalize_locked_by = ? OR finalize_locked_by = '' OR finalize_locked_by IS NULL OR finalize_locked_until IS NULL OR finalize_locked_until <= ?)", id, holder, now).
+		Updates(map[string]any{"finalize_locked_by": holder, "finalize_locked_until": until})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		if _, err := s.GetByID(id); err != nil {
+			return err
+		}
+		return ErrFinalizeLocked
+	}
+	return nil
+}
+
+// UnlockFinalize releases holder's finalize lock. It does nothing if the lock
+// was taken over in the meantime.
+func (s *ProjectStore) UnlockFinalize(id, holder string) error {
+	return s.scoped().Model(&model.Project{}).Where("id = ? AND finalize_locked_by = ?", id, holder).
+		Updates(map[string]any{"finalize_locked_by": "", "finalize_locked_until": nil}).Error
+}
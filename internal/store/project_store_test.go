@@ -0,0 +1,90 @@
+package store
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"example.com/go-migrator/internal/model"
+)
+
+func TestProjectStore_SetState(t *testing.T) {
+	projects := NewStoreManager(newTestDB(t), nil).ForTenant("a").Project
+	p := &model.Project{Name: "p", State: model.ProjectPlanned}
+	if err := projects.Create(p); err != nil {
+		t.Fatal(err)
+	}
+	at := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	if err := projects.SetState(p.ID, model.ProjectPlanned, model.ProjectApproved, "alice", at); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := projects.GetByID(p.ID)
+	if got.State != model.ProjectApproved || got.ApprovedBy != "alice" || got.ApprovedAt == nil {
+		t.Fatalf("expected the approval recorded, got %+v", got)
+	}
+
+	// a second caller that read the project as planned loses
+	if err := projects.SetState(p.ID, model.ProjectPlanned, model.ProjectDiscovered, "", at); !errors.Is(err, ErrStateChanged) {
+		t.Fatalf("expected ErrStateChanged, got %v", err)
+	}
+	if err := projects.SetState(p.ID, model.ProjectPlanned, model.ProjectPlanned, "", at); !errors.Is(err, ErrStateChanged) {
+		t.Fatalf("expected ErrStateChanged for a no-op from a stale state, got %v", err)
+	}
+
+	if err := projects.SetState(p.ID, model.ProjectApproved, model.ProjectPlanned, "", at); err != nil {
+		t.Fatal(err)
+	}
+	got, _ = projects.GetByID(p.ID)
+	if got.State != model.ProjectPlanned || got.ApprovedBy != "" || got.ApprovedAt != nil {
+		t.Fatalf("expected withdrawing the plan to clear the approval, got %+v", got)
+	}
+	if err := projects.SetState(p.ID, model.ProjectPlanned, model.ProjectPlanned, "", at); err != nil {
+		t.Fatalf("expected a no-op transition from the current state to succeed, got %v", err)
+	}
+}
+
+func TestProjectStore_LockFinalize(t *testing.T) {
+	projects := NewStoreManager(newTestDB(t), nil).ForTenant("a").Project
+	p := &model.Project{Name: "p", State: model.ProjectMigrating}
+	if err := projects.Create(p); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	if err := projects.LockFinalize(p.ID, "api", now, now.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if err := projects.LockFinalize(p.ID, "cli", now, now.Add(time.Minute)); !errors.Is(err, ErrFinalizeLocked) {
+		t.Fatalf("expected ErrFinalizeLocked while the lease runs, got %v", err)
+	}
+	if err := projects.LockFinalize(p.ID, "api", now.Add(30*time.Second), now.Add(2*time.Minute)); err != nil {
+		t.Fatalf("expected the holder to renew, got %v", err)
+	}
+	got, _ := projects.GetByID(p.ID)
+	if !got.Finalizing(now.Add(90 * time.Second)) {
+		t.Fatalf("expected the project finalizing under the renewed lease, got %+v", got)
+	}
+
+	// a lease that ran out may be taken over
+	later := now.Add(3 * time.Minute)
+	if err := projects.LockFinalize(p.ID, "cli", later, later.Add(time.Minute)); err != nil {
+		t.Fatalf("expected a stale lock to be taken over, got %v", err)
+	}
+	// the previous holder no longer holds it and cannot release it
+	if err := projects.UnlockFinalize(p.ID, "api"); err != nil {
+		t.Fatal(err)
+	}
+	if err := projects.LockFinalize(p.ID, "api", later, later.Add(time.Minute)); !errors.Is(err, ErrFinalizeLocked) {
+		t.Fatalf("expected ErrFinalizeLocked after a stale unlock, got %v", err)
+	}
+	if err := projects.UnlockFinalize(p.ID, "cli"); err != nil {
+		t.Fatal(err)
+	}
+	if err := projects.LockFinalize(p.ID, "api", later, later.Add(time.Minute)); err != nil {
+		t.Fatalf("expected the lock free after unlock, got %v", err)
+	}
+	if err := projects.LockFinalize("missing", "api", later, later.Add(time.Minute)); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,59 @@
+package store
+
+import (
+	"example.com/go-migrator/internal/model"
+	"gorm.io/gorm"
+)
+
+type ProposalStore struct {
+	db       *gorm.DB
+	tenantID string
+}
+
+func NewProposalStore(db *gorm.DB, tenantID string) *ProposalStore {
+	return &ProposalStore{db: db, tenantID: tenantID}
+}
+
+func (s *ProposalStore) scoped() *gorm.DB { return tenantScope(s.db, s.tenantID) }
+
+// ReplacePending discards all pending proposals and stores new ones. Accepted
+// and rejected proposals are kept as review history.
+func (s *ProposalStore) ReplacePending(proposals []model.IdentityProposal) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tenantScope(tx, s.tenantID).Where("status = ?", model.ProposalPending).Delete(&model.IdentityProposal{}).Error; err != nil {
+			return err
+		}
+		if len(proposals) == 0 {
+			return nil
+		}
+		for i := range proposals {
+			if s.tenantID != "" {
+				proposals[i].TenantID = s.tenantID
+			}
+			proposals[i].Status = model.ProposalPending
+		}
+		return tx.CreateInBatches(proposals, 500).Error
+	})
+}
+
+// List returns proposals with the given status (all if empty) and at least
+// minScore, best matches first.
+func (s *ProposalStore) List(status string, minScore float64) ([]model.IdentityProposal, error) {
+	var proposals []model.IdentityProposal
+	query := s.scoped().Where("score >= ?", minScore)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	err := query.Order("score DESC, id").Find(&proposals).Error
+	return proposals, err
+}
+
+func (s *ProposalStore) GetByID(id uint) (*model.IdentityProposal, error) {
+	var proposal model.IdentityProposal
+	err := notFound(s.scoped().First(&proposal, "id = ?", id).Error)
+	return &proposal, err
+}
+
+func (s *ProposalStore) UpdateStatus(id uint, status model.ProposalStatus) error {
+	return s.scoped().Model(&model.IdentityProposal{}).Where("id = ?", id).Update("status", status).Error
+}
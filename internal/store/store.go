@@ -2,8 +2,11 @@ package store
 
 import (
 	"errors"
+	"strings"
+	"time"
 
 	"example.com/go-migrator/internal/model"
+	"example.com/go-migrator/internal/secrets"
 	"gorm.io/gorm"
 )
 
@@ -11,31 +14,133 @@ import (
 // 接口定义
 // ========================
 
-var ErrNotFound = errors.New("task not found")
+var ErrNotFound = errors.New("not found")
+
+// ErrActiveGeneration is returned when a task would become active while
+// another generation of the same source path is still active.
+var ErrActiveGeneration = errors.New("another generation of this source path is active")
+
+// ErrNoPreviousGeneration is returned when a delta task has nothing to continue.
+var ErrNoPreviousGeneration = errors.New("delta task requires a previous generation")
+
+// ErrIdentityExists is returned when a Zoom user is already mapped in the
+// project scope an identity would move to.
+var ErrIdentityExists = errors.New("zoom user is already mapped in this scope")
+
+// ErrAliasExists is returned when a Zoom user ID is already an alias.
+var ErrAliasExists = errors.New("zoom user ID is already an alias")
+
+// ErrStateChanged is returned when a project is no longer in the state a
+// transition expected.
+var ErrStateChanged = errors.New("project state has changed")
+
+// ErrFinalizeLocked is returned when another finalize run holds the project.
+var ErrFinalizeLocked = errors.New("finalize already running")
+
+// notFound translates gorm's record-not-found error into ErrNotFound so
+// callers do not depend on gorm.
+func notFound(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrNotFound
+	}
+	return err
+}
 
 type TaskStoreInterface interface {
 	Create(task *model.Task) error
 	GetByID(id string) (*model.Task, error)
 	ListByProject(projectID, status string) ([]model.Task, error)
 	UpdateStatus(id, status string) error
+	Finish(id, status, errMsg string) error
+	SetCursor(id, cursor string) error
+	SetReport(id string, report *model.TaskReport) error
+	ListGenerations(sourcePath string) ([]model.Task, error)
+	SetTarget(id, teamID, channelID string) error
+	SoftDeleteFinished(projectID string, cutoff time.Time) (int64, error)
+	PurgeDeleted(projectID string, cutoff time.Time) (int64, error)
+	DeletePlanned(projectID string) (int64, error)
+	FindTeamID(projectID, teamName string) (string, error)
 }
 
 type IdentityStoreInterface interface {
 	Create(identity *model.Identity) error
 	GetByZoomID(zoomID string) (*model.Identity, error)
+	GetForProject(projectID, zoomID string) (*model.Identity, error)
+	Resolve(projectID, zoomID string) (*model.Identity, error)
+	ZoomIDByEmail(email string) (string, error)
 	GetByTeamsID(teamsID string) (*model.Identity, error)
+	Upsert(identity *model.Identity) (created bool, err error)
+	GetByID(id uint) (*model.Identity, error)
+	List(search string, offset, limit int) ([]model.Identity, int64, error)
+	Update(identity *model.Identity) error
+	Delete(id uint) error
+	ListAfter(projectID string, afterID uint, limit int) ([]model.Identity, error)
+	ListOverrides(projectID string) ([]model.Identity, error)
+	SetValidation(projectID string, id uint, status, errMsg, teamsUserID string, at time.Time) error
+	CountByValidationStatus(projectID string) (map[string]int64, error)
+	ListInvalid(projectID string, limit int) ([]model.Identity, error)
+	AddAlias(alias *model.IdentityAlias) error
+	GetAlias(aliasZoomID string) (*model.IdentityAlias, error)
+	ListAliases(zoomID string) ([]model.IdentityAlias, error)
+	DeleteAlias(aliasZoomID string) error
+}
+
+type MessageStoreInterface interface {
+	Record(rec *model.MessageRecord) error
+	ImportedIn(teamsChannelID string, zoomIDs []string) (map[string]string, error)
+	ListByTask(taskID string) ([]model.MessageRecord, error)
+	CountImported(projectID string, since time.Time) (messages, files int64, err error)
+}
+
+type ProposalStoreInterface interface {
+	ReplacePending(proposals []model.IdentityProposal) error
+	List(status string, minScore float64) ([]model.IdentityProposal, error)
+	GetByID(id uint) (*model.IdentityProposal, error)
+	UpdateStatus(id uint, status model.ProposalStatus) error
 }
 
 type ProjectStoreInterface interface {
 	Create(project *model.Project) error
 	GetByID(id string) (*model.Project, error)
+	List() ([]model.Project, error)
+	Update(project *model.Project) error
+	Delete(id string) error
 	ListByConnector(connectorID string) ([]model.Project, error)
+	ListPurgeable() ([]model.Project, error)
+	UpdateRetention(id string, retentionDays int, legalHold bool) error
+	UpdateUnmappedSenderPolicy(id string, policy model.UnmappedSenderPolicy, fallbackUserID, fallbackDisplayName string) error
+	UpdateSchedule(id string, start, end *time.Time) error
+	SetDiscovery(id string, at time.Time, errMsg string) error
+	UpdateMappingRules(id string, rules []model.MappingRule) error
+	SetState(id string, from, to model.ProjectState, approvedBy string, at time.Time) error
+	LockFinalize(id, holder string, now, until time.Time) error
+	UnlockFinalize(id, holder string) error
+}
+
+type InventoryStoreInterface interface {
+	ReplaceChannels(projectID string, channels []model.DiscoveredChannel) error
+	ListChannels(projectID string) ([]model.DiscoveredChannel, error)
+}
+
+type FinalizationStoreInterface interface {
+	Save(rec *model.TeamFinalization) error
+	List(projectID string) ([]model.TeamFinalization, error)
+}
+
+type TeamClaimStoreInterface interface {
+	Claim(projectID, teamName, holder string, now, staleBefore time.Time) (*model.TeamClaim, bool, error)
+	SetTeamID(projectID, teamName, holder, teamID string) (bool, error)
+	Release(projectID, teamName, holder string) error
 }
 
 type ConnectorStoreInterface interface {
 	Create(connector *model.Connector) error
 	GetByID(id string) (*model.Connector, error)
+	List() ([]model.Connector, error)
+	Update(connector *model.Connector) error
+	Delete(id string) error
 	GetByUserAndType(userID string, ctype model.ConnectorType) (*model.Connector, error)
+	RotateKeys() (int, error)
 }
 
 // ========================
@@ -43,18 +148,70 @@ type ConnectorStoreInterface interface {
 // ========================
 
 type StoreManager struct {
-	Task      TaskStoreInterface
-	Identity  IdentityStoreInterface
-	Project   ProjectStoreInterface
-	Connector ConnectorStoreInterface
+	Task         TaskStoreInterface
+	Identity     IdentityStoreInterface
+	Project      ProjectStoreInterface
+	Connector    ConnectorStoreInterface
+	Message      MessageStoreInterface
+	Proposal     ProposalStoreInterface
+	Inventory    InventoryStoreInterface
+	Finalization FinalizationStoreInterface
+	TeamClaim    TeamClaimStoreInterface
+
+	db       *gorm.DB
+	keys     *secrets.Keyring
+	tenantID string
 }
 
-// NewStoreManager 初始化所有 Store
-func NewStoreManager(db *gorm.DB) *StoreManager {
+// NewStoreManager 初始化所有 Store. keys seals connector secrets and may be nil,
+// in which case connectors can be read but not created.
+//
+// The returned manager is system scoped and sees every tenant. It is meant for
+// background jobs only; API handlers must go through ForTenant.
+func NewStoreManager(db *gorm.DB, keys *secrets.Keyring) *StoreManager {
+	return newStoreManager(db, keys, "")
+}
+
+// ForTenant returns a manager whose stores only read and write rows owned by
+// tenantID. Rows created through it are stamped with tenantID regardless of
+// what the caller set.
+func (m *StoreManager) ForTenant(tenantID string) *StoreManager {
+	if tenantID == "" {
+		panic("store: ForTenant called with empty tenant ID")
+	}
+	return newStoreManager(m.db, m.keys, tenantID)
+}
+
+// TenantID returns the tenant the manager is scoped to, or "" for the system scope.
+func (m *StoreManager) TenantID() string { return m.tenantID }
+
+func newStoreManager(db *gorm.DB, keys *secrets.Keyring, tenantID string) *StoreManager {
 	return &StoreManager{
-		Task:      NewTaskStore(db),
-		Identity:  NewIdentityStore(db),
-		Project:   NewProjectStore(db),
-		Connector: NewConnectorStore(db),
+		Task:         NewTaskStore(db, tenantID),
+		Identity:     NewIdentityStore(db, tenantID),
+		Project:      NewProjectStore(db, tenantID),
+		Connector:    NewConnectorStore(db, tenantID, keys),
+		Message:      NewMessageStore(db, tenantID),
+		Proposal:     NewProposalStore(db, tenantID),
+		Inventory:    NewInventoryStore(db, tenantID),
+		Finalization: NewFinalizationStore(db, tenantID),
+		TeamClaim:    NewTeamClaimStore(db, tenantID),
+		db:           db,
+		keys:         keys,
+		tenantID:     tenantID,
+	}
+}
+
+// escapeLike escapes the LIKE wildcards in a user supplied search term.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// tenantScope restricts a query to a tenant. An empty tenant is the system
+// scope used by background jobs and sees every row.
+func tenantScope(db *gorm.DB, tenantID string) *gorm.DB {
+	if tenantID == "" {
+		return db
 	}
+	return db.Where("tenant_id = ?", tenantID)
 }
@@ -0,0 +1,103 @@
+package store
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"example.com/go-migrator/internal/model"
+)
+
+// newTestDB opens an in-memory database with the full schema. Each test gets
+// its own database.
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{TranslateError: true, Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// one connection, so every query sees the same in-memory database
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	if err := AutoMigrate(db, "default"); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestForTenant_IsolatesTenants(t *testing.T) {
+	system := NewStoreManager(newTestDB(t), nil)
+	a, b := system.ForTenant("a"), system.ForTenant("b")
+
+	// the caller's tenant ID is overwritten by the scoped store
+	pa := &model.Project{Name: "alpha", TenantID: "b"}
+	if err := a.Project.Create(pa); err != nil {
+		t.Fatal(err)
+	}
+	if pa.TenantID != "a" {
+		t.Fatalf("expected the project stamped with tenant a, got %q", pa.TenantID)
+	}
+	if err := b.Project.Create(&model.Project{Name: "beta"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := b.Project.GetByID(pa.ID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("tenant b read tenant a's project: %v", err)
+	}
+	if err := b.Project.Delete(pa.ID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("tenant b deleted tenant a's project: %v", err)
+	}
+	list, err := a.Project.List()
+	if err != nil || len(list) != 1 || list[0].Name != "alpha" {
+		t.Fatalf("expected only alpha for tenant a, got %v, %v", list, err)
+	}
+	all, err := system.Project.List()
+	if err != nil || len(all) != 2 {
+		t.Fatalf("expected the system scope to see both projects, got %d, %v", len(all), err)
+	}
+}
+
+func TestForTenant_IsolatesTasksIdentitiesAndLedger(t *testing.T) {
+	system := NewStoreManager(newTestDB(t), nil)
+	a, b := system.ForTenant("a"), system.ForTenant("b")
+
+	// the same source path is independent per tenant
+	ta := &model.Task{SourcePath: "users/u1/channels/c1", TargetPath: "T/c1"}
+	tb := &model.Task{SourcePath: "users/u1/channels/c1", TargetPath: "T/c1"}
+	if err := a.Task.Create(ta); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Task.Create(tb); err != nil {
+		t.Fatalf("an active task of tenant a blocked tenant b: %v", err)
+	}
+	if _, err := a.Task.GetByID(tb.ID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("tenant a read tenant b's task: %v", err)
+	}
+	_ = a.Task.UpdateStatus(tb.ID, string(model.StatusFailed))
+	if got, err := b.Task.GetByID(tb.ID); err != nil || got.Status != model.StatusPending {
+		t.Fatalf("tenant a changed tenant b's task: %v, %v", got.Status, err)
+	}
+
+	if err := a.Identity.Create(&model.Identity{ZoomUserID: "z1", TeamsUserID: "t-a"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Identity.Resolve("", "z1"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("tenant b resolved tenant a's identity: %v", err)
+	}
+	if id, err := a.Identity.Resolve("", "z1"); err != nil || id.TeamsUserID != "t-a" {
+		t.Fatalf("expected tenant a's mapping, got %v, %v", id, err)
+	}
+
+	if err := a.Message.Record(&model.MessageRecord{ZoomMessageID: "m1", TeamsChannelID: "ch", TeamsMessageID: "x", Status: model.MessageImported}); err != nil {
+		t.Fatal(err)
+	}
+	if ids, err := b.Message.ImportedIn("ch", []string{"m1"}); err != nil || len(ids) != 0 {
+		t.Fatalf("tenant b saw tenant a's ledger: %v, %v", ids, err)
+	}
+}
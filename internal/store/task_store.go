@@ -1,31 +1,88 @@
 package store
 
 import (
+	"errors"
+	"time"
+
 	"example.com/go-migrator/internal/model"
 	"gorm.io/gorm"
 )
 
+// finishedStatuses are the task statuses eligible for retention purging.
+var finishedStatuses = []model.TaskStatus{model.StatusSuccess, model.StatusFailed}
+
 type TaskStore struct {
-	db *gorm.DB
+	db       *gorm.DB
+	tenantID string
 }
 
-func NewTaskStore(db *gorm.DB) *TaskStore {
-	return &TaskStore{db: db}
+func NewTaskStore(db *gorm.DB, tenantID string) *TaskStore {
+	return &TaskStore{db: db, tenantID: tenantID}
 }
 
+func (s *TaskStore) scoped() *gorm.DB { return tenantScope(s.db, s.tenantID) }
+
+// Create adds the next generation of task.SourcePath. It links the task to the
+// latest existing generation and fails with ErrActiveGeneration if that one is
+// still active. A delta task continues the previous generation: it inherits
+// its Teams channel, target path and cursor.
 func (s *TaskStore) Create(task *model.Task) error {
-	return s.db.Create(task).Error
+	if s.tenantID != "" {
+		task.TenantID = s.tenantID
+	}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var prev model.Task
+		err := tx.Unscoped().Where("tenant_id = ? AND source_path = ?", task.TenantID, task.SourcePath).
+			Order("generation DESC").First(&prev).Error
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			if task.Mode == model.ModeDelta {
+				return ErrNoPreviousGeneration
+			}
+			task.Generation = 1
+			task.PreviousTaskID = ""
+		case err != nil:
+			return err
+		default:
+			if prev.Status.Active() && !prev.DeletedAt.Valid {
+				return ErrActiveGeneration
+			}
+			task.Generation = prev.Generation + 1
+			task.PreviousTaskID = prev.ID
+			if task.Mode == model.ModeDelta {
+				task.TeamsTeamID = prev.TeamsTeamID
+				task.TeamsChannelID = prev.TeamsChannelID
+				task.Cursor = prev.Cursor
+				if task.TargetPath == "" {
+					task.TargetPath = prev.TargetPath
+				}
+			}
+		}
+		return tx.Create(task).Error
+	})
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		// a concurrent create won the race for the active slot
+		return ErrActiveGeneration
+	}
+	return err
+}
+
+// ListGenerations returns every generation of a source path, newest first.
+func (s *TaskStore) ListGenerations(sourcePath string) ([]model.Task, error) {
+	var tasks []model.Task
+	err := s.scoped().Where("source_path = ?", sourcePath).Order("generation DESC").Find(&tasks).Error
+	return tasks, err
 }
 
 func (s *TaskStore) GetByID(id string) (*model.Task, error) {
 	var task model.Task
-	err := s.db.First(&task, "id = ?", id).Error
+	err := notFound(s.scoped().First(&task, "id = ?", id).Error)
 	return &task, err
 }
 
 func (s *TaskStore) ListByProject(projectID, status string) ([]model.Task, error) {
 	var tasks []model.Task
-	query := s.db.Where("project_id = ?", projectID)
+	query := s.scoped().Where("project_id = ?", projectID)
 	if status != "" {
 		query = query.Where("status = ?", status)
 	}
@@ -33,6 +90,99 @@ func (s *TaskStore) ListByProject(projectID, status string) ([]model.Task, error
 	return tasks, err
 }
 
+// UpdateStatus changes a task's status and keeps its claim on the active slot
+// of its source path in sync. Re-activating a task fails with
+// ErrActiveGeneration if another generation became active in the meantime.
 func (s *TaskStore) UpdateStatus(id, status string) error {
-	return s.db.Model(&model.Task{}).Where("id = ?", id).Update("status", status).Error
+	return s.updateStatus(id, status, map[string]any{})
+}
+
+// Finish records the final status of a run and its error, if any.
+func (s *TaskStore) Finish(id, status, errMsg string) error {
+	return s.updateStatus(id, status, map[string]any{"error": errMsg})
+}
+
+// SetReport stores the summary of a task's last run.
+func (s *TaskStore) SetReport(id string, report *model.TaskReport) error {
+	return s.scoped().Model(&model.Task{}).Where("id = ?", id).Select("report").Updates(&model.Task{Report: report}).Error
+}
+
+// SetCursor records the timestamp of the newest source message migrated.
+func (s *TaskStore) SetCursor(id, cursor string) error {
+	return s.scoped().Model(&model.Task{}).Where("id = ?", id).Update("cursor", cursor).Error
+}
+
+func (s *TaskStore) updateStatus(id, status string, fields map[string]any) error {
+	fields["status"] = status
+	if model.TaskStatus(status).Active() {
+		fields["active_source_path"] = gorm.Expr("source_path")
+	} else {
+		fields["active_source_path"] = nil
+	}
+	err := s.scoped().Model(&model.Task{}).Where("id = ?", id).Updates(fields).Error
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return ErrActiveGeneration
+	}
+	return err
+}
+
+// SetTarget records the Teams team and channel a task migrates into.
+func (s *TaskStore) SetTarget(id, teamID, channelID string) error {
+	return s.scoped().Model(&model.Task{}).Where("id = ?", id).Updates(map[string]any{
+		"teams_team_id":    teamID,
+		"teams_channel_id": channelID,
+	}).Error
+}
+
+// SoftDeleteFinished soft-deletes the project's finished tasks last updated
+// before cutoff. It returns the number of tasks marked.
+func (s *TaskStore) SoftDeleteFinished(projectID string, cutoff time.Time) (int64, error) {
+	res := s.scoped().
+		Where("project_id = ? AND status IN ? AND updated_at < ?", projectID, finishedStatuses, cutoff).
+		Delete(&model.Task{})
+	return res.RowsAffected, res.Error
+}
+
+// PurgeDeleted permanently removes the project's tasks that were soft-deleted
+// before cutoff, together with their message ledger entries. It returns the
+// number of tasks removed.
+func (s *TaskStore) PurgeDeleted(projectID string, cutoff time.Time) (int64, error) {
+	var purged int64
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var ids []string
+		err := tenantScope(tx, s.tenantID).Unscoped().Model(&model.Task{}).
+			Where("project_id = ? AND deleted_at IS NOT NULL AND deleted_at < ?", projectID, cutoff).
+			Pluck("id", &ids).Error
+		if err != nil || len(ids) == 0 {
+			return err
+		}
+		if err := tenantScope(tx, s.tenantID).Where("task_id IN ?", ids).Delete(&model.MessageRecord{}).Error; err != nil {
+			return err
+		}
+		res := tenantScope(tx, s.tenantID).Unscoped().Where("id IN ?", ids).Delete(&model.Task{})
+		purged = res.RowsAffected
+		return res.Error
+	})
+	return purged, err
+}
+
+// DeletePlanned permanently removes a project's planned tasks, so a new plan
+// can replace them.
+func (s *TaskStore) DeletePlanned(projectID string) (int64, error) {
+	res := s.scoped().Unscoped().Where("project_id = ? AND status = ?", projectID, model.StatusPlanned).Delete(&model.Task{})
+	return res.RowsAffected, res.Error
+}
+
+// FindTeamID returns the Teams team already created for teamName by another
+// task of the project, or "" if there is none. Consolidation rules map many
+// Zoom channels into one team, and every task after the first reuses it.
+func (s *TaskStore) FindTeamID(projectID, teamName string) (string, error) {
+	var task model.Task
+	err := s.scoped().Select("teams_team_id").
+		Where("project_id = ? AND teams_team_id <> '' AND target_path LIKE ?", projectID, escapeLike(teamName)+"/%").
+		Order("created_at").First(&task).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", nil
+	}
+	return task.TeamsTeamID, err
 }
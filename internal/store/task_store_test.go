@@ -0,0 +1,62 @@
+package store
+
+import (
+	"errors"
+	"testing"
+
+	"example.com/go-migrator/internal/model"
+)
+
+func TestTaskStore_GenerationsShareOneActiveSlot(t *testing.T) {
+	tasks := NewStoreManager(newTestDB(t), nil).ForTenant("a").Task
+	const src = "users/u1/channels/c1"
+
+	if err := tasks.Create(&model.Task{SourcePath: src, Mode: model.ModeDelta}); !errors.Is(err, ErrNoPreviousGeneration) {
+		t.Fatalf("expected ErrNoPreviousGeneration for a first delta, got %v", err)
+	}
+	first := &model.Task{SourcePath: src, TargetPath: "Team/general"}
+	if err := tasks.Create(first); err != nil {
+		t.Fatal(err)
+	}
+	if err := tasks.Create(&model.Task{SourcePath: src}); !errors.Is(err, ErrActiveGeneration) {
+		t.Fatalf("expected ErrActiveGeneration while generation 1 is pending, got %v", err)
+	}
+
+	if err := tasks.SetTarget(first.ID, "team-1", "channel-1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tasks.SetCursor(first.ID, "2024-05-01T00:00:00Z"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tasks.Finish(first.ID, string(model.StatusSuccess), ""); err != nil {
+		t.Fatal(err)
+	}
+
+	delta := &model.Task{SourcePath: src, Mode: model.ModeDelta}
+	if err := tasks.Create(delta); err != nil {
+		t.Fatalf("expected the slot to be free once generation 1 finished: %v", err)
+	}
+	if delta.Generation != 2 || delta.PreviousTaskID != first.ID {
+		t.Fatalf("expected generation 2 linked to %s, got %d linked to %q", first.ID, delta.Generation, delta.PreviousTaskID)
+	}
+	if delta.TeamsTeamID != "team-1" || delta.TeamsChannelID != "channel-1" ||
+		delta.Cursor != "2024-05-01T00:00:00Z" || delta.TargetPath != "Team/general" {
+		t.Fatalf("expected the delta to continue generation 1, got %+v", delta)
+	}
+
+	// retrying generation 1 would take the slot generation 2 holds
+	if err := tasks.UpdateStatus(first.ID, string(model.StatusPending)); !errors.Is(err, ErrActiveGeneration) {
+		t.Fatalf("expected ErrActiveGeneration re-activating generation 1, got %v", err)
+	}
+	if err := tasks.Finish(delta.ID, string(model.StatusFailed), "boom"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tasks.UpdateStatus(first.ID, string(model.StatusPending)); err != nil {
+		t.Fatalf("expected generation 1 to take the free slot: %v", err)
+	}
+
+	gens, err := tasks.ListGenerations(src)
+	if err != nil || len(gens) != 2 || gens[0].ID != delta.ID {
+		t.Fatalf("expected both generations, newest first, got %v, %v", gens, err)
+	}
+}
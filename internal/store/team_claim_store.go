@@ -0,0 +1,72 @@
+package store
+
+import (
+	"time"
+
+	"example.com/go-migrator/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type TeamClaimStore struct {
+	db       *gorm.DB
+	tenantID string
+}
+
+func NewTeamClaimStore(db *gorm.DB, tenantID string) *TeamClaimStore {
+	return &TeamClaimStore{db: db, tenantID: tenantID}
+}
+
+func (s *TeamClaimStore) scoped() *gorm.DB { return tenantScope(s.db, s.tenantID) }
+
+// Claim claims teamName in the project for holder unless another holder has
+// claimed it since staleBefore. It returns the claim and whether holder now
+// holds it. A claim with TeamsTeamID set is final and never taken over.
+func (s *TeamClaimStore) Claim(projectID, teamName, holder string, now, staleBefore time.Time) (*model.TeamClaim, bool, error) {
+	claim := model.TeamClaim{TenantID: s.tenantID, ProjectID: projectID, TeamName: teamName, ClaimedBy: holder, ClaimedAt: now}
+	res := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&claim)
+	if res.Error != nil {
+		return nil, false, res.Error
+	}
+	if res.RowsAffected == 1 {
+		return &claim, true, nil
+	}
+	var existing model.TeamClaim
+	err := s.scoped().Where("project_id = ? AND team_name = ?", projectID, teamName).First(&existing).Error
+	if err != nil {
+		return nil, false, notFound(err)
+	}
+	if existing.TeamsTeamID != "" || existing.ClaimedBy == holder || !existing.ClaimedAt.Before(staleBefore) {
+		return &existing, existing.TeamsTeamID == "" && existing.ClaimedBy == holder, nil
+	}
+	// the holder died before creating the team; take over unless someone
+	// else got there first
+	res = s.scoped().Model(&model.TeamClaim{}).
+		Where("id = ? AND claimed_by = ? AND teams_team_id = ''", existing.ID, existing.ClaimedBy).
+		Updates(map[string]any{"claimed_by": holder, "claimed_at": now})
+	if res.Error != nil {
+		return nil, false, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return &existing, false, nil
+	}
+	existing.ClaimedBy = holder
+	existing.ClaimedAt = now
+	return &existing, true, nil
+}
+
+// SetTeamID records the team holder created for its claim. It reports false
+// if holder no longer holds the claim because it was taken over.
+func (s *TeamClaimStore) SetTeamID(projectID, teamName, holder, teamID string) (bool, error) {
+	res := s.scoped().Model(&model.TeamClaim{}).
+		Where("project_id = ? AND team_name = ? AND claimed_by = ? AND teams_team_id = ''", projectID, teamName, holder).
+		Update("teams_team_id", teamID)
+	return res.RowsAffected == 1, res.Error
+}
+
+// Release drops holder's claim if no team was recorded for it, so a waiting
+// task may claim the name at once.
+func (s *TeamClaimStore) Release(projectID, teamName, holder string) error {
+	return s.scoped().Where("project_id = ? AND team_name = ? AND claimed_by = ? AND teams_team_id = ''", projectID, teamName, holder).
+		Delete(&model.TeamClaim{}).Error
+}
@@ -0,0 +1,48 @@
+package store
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTeamClaimStore_Claim(t *testing.T) {
+	claims := NewStoreManager(newTestDB(t), nil).ForTenant("a").TeamClaim
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	stale := 10 * time.Minute
+
+	if _, ok, err := claims.Claim("p1", "Sales", "w1", now, now.Add(-stale)); err != nil || !ok {
+		t.Fatalf("expected the first claim to win, got %v, %v", ok, err)
+	}
+	if _, ok, err := claims.Claim("p1", "Sales", "w2", now, now.Add(-stale)); err != nil || ok {
+		t.Fatalf("expected a fresh claim to hold, got %v, %v", ok, err)
+	}
+	if _, ok, err := claims.Claim("p2", "Sales", "w2", now, now.Add(-stale)); err != nil || !ok {
+		t.Fatalf("expected claims per project, got %v, %v", ok, err)
+	}
+
+	// w1 died; w2 takes over once the claim is stale
+	later := now.Add(stale + time.Minute)
+	if _, ok, err := claims.Claim("p1", "Sales", "w2", later, later.Add(-stale)); err != nil || !ok {
+		t.Fatalf("expected a stale claim to be taken over, got %v, %v", ok, err)
+	}
+	// w1's late result is ignored
+	if ok, err := claims.SetTeamID("p1", "Sales", "w1", "team-w1"); err != nil || ok {
+		t.Fatalf("expected the lost claim not to record a team, got %v, %v", ok, err)
+	}
+	if ok, err := claims.SetTeamID("p1", "Sales", "w2", "team-w2"); err != nil || !ok {
+		t.Fatalf("expected the holder to record its team, got %v, %v", ok, err)
+	}
+	much := later.Add(time.Hour)
+	claim, ok, err := claims.Claim("p1", "Sales", "w3", much, much.Add(-stale))
+	if err != nil || ok || claim.TeamsTeamID != "team-w2" {
+		t.Fatalf("expected the recorded team and no claim, got %+v, %v, %v", claim, ok, err)
+	}
+
+	// a released claim is free at once
+	if err := claims.Release("p2", "Sales", "w2"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, err := claims.Claim("p2", "Sales", "w3", now, now.Add(-stale)); err != nil || !ok {
+		t.Fatalf("expected a released claim to be free, got %v, %v", ok, err)
+	}
+}
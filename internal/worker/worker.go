@@ -2,10 +2,13 @@ package worker
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
 	"sync"
 	"time"
 
+	"example.com/go-migrator/internal/migrator"
 	"example.com/go-migrator/internal/model"
 	"example.com/go-migrator/internal/queue"
 	"example.com/go-migrator/internal/store"
@@ -63,22 +66,127 @@ func (w *Worker) process(id string) {
 		log.Printf("task %s not found: %v", id, err)
 		return
 	}
+	if t.Status == model.StatusSuccess || t.Status == model.StatusRunning {
+		log.Printf("task %s is %s, skipping", id, t.Status)
+		return
+	}
+
+	// everything below runs on behalf of the task's tenant
+	stm := w.stm.ForTenant(t.TenantID)
 
 	t.Status = model.StatusRunning
-	_ = w.stm.Task.UpdateStatus(t.ID, (string)(model.StatusRunning))
+	if err := stm.Task.UpdateStatus(t.ID, (string)(model.StatusRunning)); err != nil {
+		// another generation of the same source path may have become active
+		log.Printf("task %s cannot start: %v", id, err)
+		return
+	}
 
-	// // pass the store directly; Store includes identity methods
-	// err = migrator.MigrateTask(zoomUserID, zoomChannelID, teamName, channelName, w.store)
-	// if err != nil {
-	// 	log.Printf("task %s failed: %v", id, err)
-	// 	t.Status = model.StatusFailed
-	// 	t.Error = err.Error()
-	// } else {
-	// 	log.Printf("task %s succeeded", id)
-	// 	t.Status = model.StatusSuccess
-	// 	t.Result = "migrated"
-	// }
-	// _ = w.stm.Task.UpdateStatus(t.ID, t.Status)
+	var report *model.TaskReport
+	var job migrator.Job
+	// the migrator checks that the mappings of the task's senders and chat
+	// participants are valid
+	err = checkProject(stm, t.ProjectID)
+	var early *windowNotOpenError
+	if errors.As(err, &early) {
+		// not a failure: the task runs once the window opens
+		log.Printf("task %s deferred: %v", id, err)
+		if err := stm.Task.Finish(t.ID, string(model.StatusPending), err.Error()); err != nil {
+			log.Printf("task %s: failed to record deferral: %v", id, err)
+			return
+		}
+		w.publishAt(id, early.opens)
+		return
+	}
+	if err == nil {
+		job, err = w.job(stm, t)
+	}
+	// the message ledger makes reruns resume where the last run stopped
+	if err == nil {
+		report, err = migrator.MigrateTask(job, stm)
+	}
+	if report != nil {
+		if err := stm.Task.SetReport(t.ID, report); err != nil {
+			log.Printf("task %s: failed to record report: %v", id, err)
+		}
+	}
+	if err != nil {
+		log.Printf("task %s failed: %v", id, err)
+		t.Status = model.StatusFailed
+		t.Error = err.Error()
+	} else {
+		log.Printf("task %s succeeded", id)
+		t.Status = model.StatusSuccess
+		t.Error = ""
+	}
+	if err := stm.Task.Finish(t.ID, string(t.Status), t.Error); err != nil {
+		log.Printf("task %s: failed to record result: %v", id, err)
+	}
 	// small sleep to avoid busy loops in tests
 	time.Sleep(10 * time.Millisecond)
 }
+
+// job builds the migration job for a task, applying its project's settings.
+func (w *Worker) job(stm *store.StoreManager, t *model.Task) (migrator.Job, error) {
+	var project *model.Project
+	if t.ProjectID != "" {
+		p, err := stm.Project.GetByID(t.ProjectID)
+		if err != nil {
+			return migrator.Job{}, fmt.Errorf("load project %s: %w", t.ProjectID, err)
+		}
+		project = p
+	}
+	return migrator.JobFromTask(t, project)
+}
+
+// publishAt queues the task again at t.
+func (w *Worker) publishAt(id string, t time.Time) {
+	time.AfterFunc(time.Until(t), func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := w.qclient.Publish(ctx, id); err != nil {
+			log.Printf("task %s: failed to queue deferred task: %v", id, err)
+		}
+	})
+}
+
+// windowNotOpenError is returned by checkProject for a task picked up before
+// its project's migration window opens.
+type windowNotOpenError struct {
+	opens time.Time
+}
+
+func (e *windowNotOpenError) Error() string {
+	return fmt.Sprintf("waiting for the project's migration window, which opens at %s", e.opens.UTC().Format(time.RFC3339))
+}
+
+// checkProject refuses to run tasks of a project whose plan has not been
+// approved, and tasks without a project, which nobody approved. Tasks picked
+// up before the project's migration window opens get a windowNotOpenError;
+// after it closed they fail. The first task of an approved project moves it
+// to migrating.
+func checkProject(stm *store.StoreManager, projectID string) error {
+	if projectID == "" {
+		return fmt.Errorf("task has no project; only tasks of an approved project run")
+	}
+	p, err := stm.Project.GetByID(projectID)
+	if err != nil {
+		return fmt.Errorf("load project %s: %w", projectID, err)
+	}
+	if !p.State.RunsTasks() {
+		return fmt.Errorf("project is %s; its plan must be approved before tasks run", p.State)
+	}
+	now := time.Now()
+	if p.ScheduleStart != nil && now.Before(*p.ScheduleStart) {
+		return &windowNotOpenError{opens: *p.ScheduleStart}
+	}
+	if err := p.CheckSchedule(now); err != nil {
+		return err
+	}
+	if p.State == model.ProjectApproved {
+		err := stm.Project.SetState(p.ID, model.ProjectApproved, model.ProjectMigrating, "", time.Now())
+		if err != nil && err != store.ErrStateChanged {
+			return fmt.Errorf("project state: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"example.com/go-migrator/internal/model"
+	"example.com/go-migrator/internal/store"
+)
+
+func TestCheckProject(t *testing.T) {
+	stm := store.NewStoreManager(newTestDB(t), nil).ForTenant("a")
+	tests := []struct {
+		state   model.ProjectState
+		wantErr string
+		after   model.ProjectState
+	}{
+		{model.ProjectDraft, "must be approved", model.ProjectDraft},
+		{model.ProjectPlanned, "must be approved", model.ProjectPlanned},
+		{model.ProjectApproved, "", model.ProjectMigrating},
+		{model.ProjectMigrating, "", model.ProjectMigrating},
+		{model.ProjectFinalizing, "must be approved", model.ProjectFinalizing},
+		{model.ProjectCompleted, "must be approved", model.ProjectCompleted},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.state), func(t *testing.T) {
+			p := &model.Project{Name: string(tt.state), State: tt.state}
+			if err := stm.Project.Create(p); err != nil {
+				t.Fatal(err)
+			}
+			err := checkProject(stm, p.ID)
+			if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("expected error %q, got %v", tt.wantErr, err)
+			}
+			got, _ := stm.Project.GetByID(p.ID)
+			if got.State != tt.after {
+				t.Fatalf("expected the project %s afterwards, got %s", tt.after, got.State)
+			}
+		})
+	}
+
+	if err := checkProject(stm, ""); err == nil {
+		t.Fatal("expected a task without a project to be refused")
+	}
+	if err := checkProject(stm, "missing"); err == nil {
+		t.Fatal("expected a task of an unknown project to be refused")
+	}
+}
+
+// fakeQueue records published task IDs.
+type fakeQueue struct {
+	published chan string
+}
+
+func (q *fakeQueue) Publish(ctx context.Context, id string) error {
+	q.published <- id
+	return nil
+}
+func (q *fakeQueue) Consume(ctx context.Context) (<-chan string, error) { return nil, nil }
+func (q *fakeQueue) Close() error                                       { return nil }
+
+func TestProcess_DefersTasksUntilTheWindowOpens(t *testing.T) {
+	db := newTestDB(t)
+	stm := store.NewStoreManager(db, nil).ForTenant("a")
+	opens := time.Now().Add(50 * time.Millisecond)
+	p := &model.Project{Name: "p", State: model.ProjectApproved, ScheduleStart: &opens}
+	if err := stm.Project.Create(p); err != nil {
+		t.Fatal(err)
+	}
+	task := &model.Task{ProjectID: p.ID, SourcePath: "users/u1/channels/c1", TargetPath: "Sales/general", Status: model.StatusPending}
+	if err := stm.Task.Create(task); err != nil {
+		t.Fatal(err)
+	}
+
+	q := &fakeQueue{published: make(chan string, 1)}
+	NewWorker(store.NewStoreManager(db, nil), q, 1).process(task.ID)
+
+	got, _ := stm.Task.GetByID(task.ID)
+	if got.Status != model.StatusPending || !strings.Contains(got.Error, "migration window") {
+		t.Fatalf("expected the task pending until the window opens, got %s %q", got.Status, got.Error)
+	}
+	if proj, _ := stm.Project.GetByID(p.ID); proj.State != model.ProjectApproved {
+		t.Fatalf("expected the project to stay approved, got %s", proj.State)
+	}
+	select {
+	case id := <-q.published:
+		if id != task.ID {
+			t.Fatalf("expected task %s queued again, got %s", task.ID, id)
+		}
+		if time.Now().Before(opens) {
+			t.Fatal("task queued again before the window opened")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("task was not queued again once the window opened")
+	}
+}
+
+func TestCheckProject_WindowClosed(t *testing.T) {
+	stm := store.NewStoreManager(newTestDB(t), nil).ForTenant("a")
+	closed := time.Now().Add(-time.Hour)
+	p := &model.Project{Name: "p", State: model.ProjectMigrating, ScheduleEnd: &closed}
+	if err := stm.Project.Create(p); err != nil {
+		t.Fatal(err)
+	}
+	err := checkProject(stm, p.ID)
+	var early *windowNotOpenError
+	if err == nil || errors.As(err, &early) {
+		t.Fatalf("expected a closed window to fail the task, got %v", err)
+	}
+}
+
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{TranslateError: true, Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	if err := store.AutoMigrate(db, "default"); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}